@@ -0,0 +1,111 @@
+// Package achievement holds the registry of badge rules and the streak
+// arithmetic they rely on. Rules only look at Stats, so evaluating them is
+// a pure function of the user's data: running it twice awards the same
+// badges, and a deleted workout takes back what it alone earned.
+package achievement
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/week"
+)
+
+// Stats is what rules are evaluated against.
+type Stats struct {
+	Workouts int `json:"workouts"`
+	// TotalVolume is lifetime volume in kg, grouped entries counted once
+	// per round.
+	TotalVolume float64 `json:"total_volume"`
+	// PersonalRecords counts entries that beat the heaviest earlier weight
+	// for the same exercise.
+	PersonalRecords int `json:"personal_records"`
+	// Streaks are in Monday-based weeks with at least one workout.
+	CurrentWeekStreak int `json:"current_week_streak"`
+	LongestWeekStreak int `json:"longest_week_streak"`
+}
+
+// Rule is a badge and the condition that earns it. Keys are stored, so
+// they must never change once released.
+type Rule struct {
+	Key         string            `json:"key"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Earned      func(*Stats) bool `json:"-"`
+}
+
+var registry = map[string]Rule{}
+
+// Register adds a rule. It panics on a duplicate key, which is a
+// programming error.
+func Register(rule Rule) {
+	if _, ok := registry[rule.Key]; ok {
+		panic(fmt.Sprintf("achievement: rule %q registered twice", rule.Key))
+	}
+	registry[rule.Key] = rule
+}
+
+// Lookup returns the rule with the given key.
+func Lookup(key string) (Rule, bool) {
+	rule, ok := registry[key]
+	return rule, ok
+}
+
+// Rules returns every registered rule, ordered by key.
+func Rules() []Rule {
+	rules := make([]Rule, 0, len(registry))
+	for _, rule := range registry {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Key < rules[j].Key })
+	return rules
+}
+
+// Evaluate returns the keys of every rule stats satisfies.
+func Evaluate(stats *Stats) []string {
+	var keys []string
+	for _, rule := range Rules() {
+		if rule.Earned(stats) {
+			keys = append(keys, rule.Key)
+		}
+	}
+	return keys
+}
+
+// WeekStreaks counts consecutive Monday-based weeks in loc containing at
+// least one of the given times. The current streak is still alive until
+// a full week passes without a workout, so it may end last week.
+func WeekStreaks(times []time.Time, loc *time.Location, now time.Time) (current, longest int) {
+	weeks := make(map[time.Time]bool, len(times))
+	for _, t := range times {
+		weeks[week.Start(t, loc)] = true
+	}
+
+	starts := make([]time.Time, 0, len(weeks))
+	for week := range weeks {
+		starts = append(starts, week)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	run := 0
+	for i, week := range starts {
+		if i > 0 && starts[i-1].AddDate(0, 0, 7).Equal(week) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+
+	thisWeek := week.Start(now, loc)
+	for week := thisWeek; ; week = week.AddDate(0, 0, -7) {
+		if weeks[week] {
+			current++
+		} else if !week.Equal(thisWeek) {
+			break
+		}
+	}
+
+	return current, longest
+}
@@ -0,0 +1,43 @@
+package achievement
+
+import "fmt"
+
+func init() {
+	for _, n := range []int{1, 10, 50, 100, 250, 500, 1000} {
+		name := fmt.Sprintf("%d workouts", n)
+		if n == 1 {
+			name = "First workout"
+		}
+		Register(Rule{
+			Key:         fmt.Sprintf("workouts_%d", n),
+			Name:        name,
+			Description: fmt.Sprintf("Log %d workouts.", n),
+			Earned:      func(s *Stats) bool { return s.Workouts >= n },
+		})
+	}
+
+	for _, weeks := range []int{4, 12, 26, 52} {
+		Register(Rule{
+			Key:         fmt.Sprintf("streak_%d_weeks", weeks),
+			Name:        fmt.Sprintf("%d-week streak", weeks),
+			Description: fmt.Sprintf("Train at least once a week for %d weeks in a row.", weeks),
+			Earned:      func(s *Stats) bool { return s.LongestWeekStreak >= weeks },
+		})
+	}
+
+	for _, tonnes := range []int{10, 100, 1000} {
+		Register(Rule{
+			Key:         fmt.Sprintf("volume_%dt", tonnes),
+			Name:        fmt.Sprintf("%d tonnes", tonnes),
+			Description: fmt.Sprintf("Lift a total of %d tonnes.", tonnes),
+			Earned:      func(s *Stats) bool { return s.TotalVolume >= float64(tonnes)*1000 },
+		})
+	}
+
+	Register(Rule{
+		Key:         "first_pr",
+		Name:        "First PR",
+		Description: "Beat your heaviest weight on any exercise.",
+		Earned:      func(s *Stats) bool { return s.PersonalRecords >= 1 },
+	})
+}
@@ -0,0 +1,285 @@
+// Package analytics aggregates workouts into per-workout and weekly
+// training summaries.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/tempo"
+	"github.com/strangecousinwst/goworkout/internal/week"
+)
+
+// DefaultRepSeconds is the assumed length of a rep logged without a tempo.
+const DefaultRepSeconds = 3
+
+// EntryVolume is the load moved by an entry: sets × reps × weight. Entries
+// without both reps and weight don't count towards volume. For an entry in
+// a group this is the volume of a single round.
+func EntryVolume(e *store.WorkoutEntry) float64 {
+	if e.Reps == nil || e.Weight == nil {
+		return 0
+	}
+	return float64(e.Sets) * float64(*e.Reps) * *e.Weight
+}
+
+// Rounds returns how many times an entry is performed: once when
+// ungrouped, otherwise once per round of its group.
+func Rounds(group *store.EntryGroup) int {
+	if group == nil || group.Rounds < 1 {
+		return 1
+	}
+	return group.Rounds
+}
+
+// WorkoutVolume sums the volume of every entry in the workout, counting
+// grouped entries once per round.
+func WorkoutVolume(w *store.Workout) float64 {
+	var volume float64
+	w.EachEntry(func(e *store.WorkoutEntry, group *store.EntryGroup) {
+		volume += EntryVolume(e) * float64(Rounds(group))
+	})
+	return volume
+}
+
+// EntryTimeUnderTension is the time in seconds the entry's sets keep the
+// muscle loaded, from its tempo × reps. Entries without both a valid tempo
+// and reps have none. Like EntryVolume it covers a single round.
+func EntryTimeUnderTension(e *store.WorkoutEntry) int {
+	if e.Reps == nil || e.Tempo == "" {
+		return 0
+	}
+	t, err := tempo.Parse(e.Tempo)
+	if err != nil {
+		return 0
+	}
+	return e.Sets * t.TimeUnderTension(*e.Reps)
+}
+
+// entryWorkSeconds estimates how long the entry's sets take in one round:
+// time under tension when there is a tempo, the logged duration for timed
+// sets, and otherwise DefaultRepSeconds per rep.
+func entryWorkSeconds(e *store.WorkoutEntry) int {
+	if tut := EntryTimeUnderTension(e); tut > 0 {
+		return tut
+	}
+	if e.DurationSeconds != nil {
+		return e.Sets * *e.DurationSeconds
+	}
+	if e.Reps != nil {
+		return e.Sets * *e.Reps * DefaultRepSeconds
+	}
+	return 0
+}
+
+// Density splits a session's estimated time into work and rest.
+type Density struct {
+	TimeUnderTensionSeconds int `json:"time_under_tension_seconds"`
+	WorkSeconds             int `json:"work_seconds"`
+	RestSeconds             int `json:"rest_seconds"`
+	// Ratio is work / (work + rest), 0 when nothing could be estimated.
+	Ratio float64 `json:"ratio"`
+}
+
+// SessionDensity estimates work and rest from the prescription: an
+// entry's rest is taken between its sets, and a group's rest between its
+// rounds. Changeovers between exercises aren't counted.
+func SessionDensity(w *store.Workout) Density {
+	var d Density
+	seen := make(map[*store.EntryGroup]bool)
+
+	w.EachEntry(func(e *store.WorkoutEntry, group *store.EntryGroup) {
+		rounds := Rounds(group)
+		d.TimeUnderTensionSeconds += EntryTimeUnderTension(e) * rounds
+		d.WorkSeconds += entryWorkSeconds(e) * rounds
+		if e.RestSeconds != nil && e.Sets > 1 {
+			d.RestSeconds += *e.RestSeconds * (e.Sets - 1) * rounds
+		}
+
+		if group != nil && !seen[group] {
+			seen[group] = true
+			if group.RestBetweenRoundsSeconds != nil {
+				d.RestSeconds += *group.RestBetweenRoundsSeconds * (rounds - 1)
+			}
+		}
+	})
+
+	if total := d.WorkSeconds + d.RestSeconds; total > 0 {
+		d.Ratio = math.Round(float64(d.WorkSeconds)/float64(total)*100) / 100
+	}
+	return d
+}
+
+type WorkoutSummary struct {
+	WorkoutID       int                  `json:"workout_id"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	Volume          float64              `json:"volume"`
+	AvgHeartRate    *int                 `json:"avg_heart_rate"`
+	MaxHeartRate    *int                 `json:"max_heart_rate"`
+	TRIMP           float64              `json:"trimp"`
+	Zones           []heartrate.Zone     `json:"zones,omitempty"`
+	TimeInZones     []heartrate.ZoneTime `json:"time_in_zones,omitempty"`
+	Density         Density              `json:"density"`
+	// The fields below need a body weight; see ApplyBodyWeight.
+	BodyWeight        *float64 `json:"body_weight,omitempty"`
+	BodyweightVolume  float64  `json:"bodyweight_volume"`
+	EstimatedCalories *float64 `json:"estimated_calories,omitempty"`
+}
+
+// SummarizeWorkout computes volume, density and heart-rate load for one
+// workout.
+// Time in zones needs both a series and a complete profile; TRIMP falls
+// back to the workout's average HR when there is no series.
+func SummarizeWorkout(w *store.Workout, samples []heartrate.Sample, profile heartrate.Profile) WorkoutSummary {
+	summary := WorkoutSummary{
+		WorkoutID:       w.ID,
+		DurationMinutes: w.DurationMinutes,
+		Volume:          WorkoutVolume(w),
+		Density:         SessionDensity(w),
+		AvgHeartRate:    w.AvgHeartRate,
+		MaxHeartRate:    w.MaxHeartRate,
+	}
+
+	if len(samples) > 0 {
+		summary.TRIMP = heartrate.TRIMP(samples, profile)
+
+		zones, err := heartrate.Zones(profile)
+		if err == nil {
+			summary.Zones = zones
+			summary.TimeInZones = heartrate.TimeInZones(samples, zones)
+		}
+	} else if w.AvgHeartRate != nil {
+		summary.TRIMP = heartrate.TRIMPFromAverage(*w.AvgHeartRate, w.DurationMinutes, profile)
+	}
+	summary.TRIMP = round(summary.TRIMP)
+
+	return summary
+}
+
+// workoutLoad is the heart-rate load of a workout in a range, from its
+// entry in loads when it has a series and otherwise, like
+// SummarizeWorkout, from its average HR.
+func workoutLoad(w *store.Workout, loads map[int]heartrate.Load, profile heartrate.Profile) heartrate.Load {
+	load, ok := loads[w.ID]
+	if !ok && w.AvgHeartRate != nil {
+		load.TRIMP = heartrate.TRIMPFromAverage(*w.AvgHeartRate, w.DurationMinutes, profile)
+	}
+	load.TRIMP = round(load.TRIMP)
+	return load
+}
+
+type WeekSummary struct {
+	WeekStart       time.Time            `json:"week_start"`
+	Workouts        int                  `json:"workouts"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	CaloriesBurned  int                  `json:"calories_burned"`
+	DistanceMeters  float64              `json:"distance_meters"`
+	Volume          float64              `json:"volume"`
+	TRIMP           float64              `json:"trimp"`
+	TimeInZones     []heartrate.ZoneTime `json:"time_in_zones,omitempty"`
+	// TimeUnderTensionSeconds only covers entries logged with a tempo.
+	TimeUnderTensionSeconds int `json:"time_under_tension_seconds"`
+	// ActivityTypes counts the week's workouts per activity type.
+	ActivityTypes map[string]int `json:"activity_types"`
+}
+
+// Weekly buckets workouts into Monday-based weeks covering [from, to).
+// Weeks without workouts are included so charts don't have gaps.
+func Weekly(workouts []store.Workout, loads map[int]heartrate.Load, profile heartrate.Profile, from, to time.Time, loc *time.Location) []WeekSummary {
+	var weeks []WeekSummary
+	index := make(map[int64]int)
+	for start := week.Start(from, loc); start.Before(to); start = start.AddDate(0, 0, 7) {
+		index[start.Unix()] = len(weeks)
+		weeks = append(weeks, WeekSummary{WeekStart: start, ActivityTypes: map[string]int{}})
+	}
+
+	for i := range workouts {
+		w := &workouts[i]
+		n, ok := index[week.Start(w.StartedAt, loc).Unix()]
+		if !ok {
+			continue
+		}
+
+		summary := &weeks[n]
+		load := workoutLoad(w, loads, profile)
+
+		summary.Workouts++
+		summary.ActivityTypes[w.ActivityType]++
+		summary.DurationMinutes += w.DurationMinutes
+		summary.CaloriesBurned += w.CaloriesBurned
+		if w.DistanceMeters != nil {
+			summary.DistanceMeters += *w.DistanceMeters
+		}
+		summary.Volume += WorkoutVolume(w)
+		summary.TimeUnderTensionSeconds += SessionDensity(w).TimeUnderTensionSeconds
+		summary.TRIMP = round(summary.TRIMP + load.TRIMP)
+		summary.TimeInZones = heartrate.AddZoneTimes(summary.TimeInZones, load.TimeInZones)
+	}
+
+	return weeks
+}
+
+// TypeSummary totals the workouts of one activity type.
+type TypeSummary struct {
+	ActivityType    string  `json:"activity_type"`
+	Workouts        int     `json:"workouts"`
+	DurationMinutes int     `json:"duration_minutes"`
+	CaloriesBurned  int     `json:"calories_burned"`
+	DistanceMeters  float64 `json:"distance_meters"`
+	Volume          float64 `json:"volume"`
+	TRIMP           float64 `json:"trimp"`
+	// DurationShare is the type's fraction of all training time.
+	DurationShare float64 `json:"duration_share"`
+}
+
+// ByActivityType breaks workouts down by activity type, the most trained
+// first. Types without workouts are left out.
+func ByActivityType(workouts []store.Workout, loads map[int]heartrate.Load, profile heartrate.Profile) []TypeSummary {
+	var types []TypeSummary
+	index := make(map[string]int)
+	totalMinutes := 0
+
+	for i := range workouts {
+		w := &workouts[i]
+		n, ok := index[w.ActivityType]
+		if !ok {
+			n = len(types)
+			index[w.ActivityType] = n
+			types = append(types, TypeSummary{ActivityType: w.ActivityType})
+		}
+
+		t := &types[n]
+		load := workoutLoad(w, loads, profile)
+
+		t.Workouts++
+		t.DurationMinutes += w.DurationMinutes
+		t.CaloriesBurned += w.CaloriesBurned
+		if w.DistanceMeters != nil {
+			t.DistanceMeters += *w.DistanceMeters
+		}
+		t.Volume += WorkoutVolume(w)
+		t.TRIMP = round(t.TRIMP + load.TRIMP)
+		totalMinutes += w.DurationMinutes
+	}
+
+	for i := range types {
+		if totalMinutes > 0 {
+			types[i].DurationShare = math.Round(float64(types[i].DurationMinutes)/float64(totalMinutes)*100) / 100
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].DurationMinutes != types[j].DurationMinutes {
+			return types[i].DurationMinutes > types[j].DurationMinutes
+		}
+		return types[i].Workouts > types[j].Workouts
+	})
+
+	return types
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+// TrendPoint is a measurement with the average of the trailing window
+// ending at it.
+type TrendPoint struct {
+	MeasuredAt time.Time `json:"measured_at"`
+	Value      float64   `json:"value"`
+	Average    float64   `json:"average"`
+}
+
+// Trend smooths measurements, which must be oldest first, with a trailing
+// moving average over window. A time window rather than a count keeps
+// irregular logging (three weigh-ins one week, none the next) from skewing
+// the line.
+func Trend(measurements []store.Measurement, window time.Duration) []TrendPoint {
+	points := make([]TrendPoint, len(measurements))
+
+	start := 0
+	var sum float64
+	for i, m := range measurements {
+		sum += m.Value
+		// the window is (m.MeasuredAt - window, m.MeasuredAt]
+		for start < i && !measurements[start].MeasuredAt.After(m.MeasuredAt.Add(-window)) {
+			sum -= measurements[start].Value
+			start++
+		}
+		points[i] = TrendPoint{
+			MeasuredAt: m.MeasuredAt,
+			Value:      m.Value,
+			Average:    math.Round(sum/float64(i-start+1)*100) / 100,
+		}
+	}
+
+	return points
+}
+
+// bodyweightFractions is roughly how much of the athlete's body weight
+// each bodyweight exercise moves, keyed by normalized exercise name.
+var bodyweightFractions = map[string]float64{
+	"pullup":          1.0,
+	"chinup":          1.0,
+	"muscleup":        1.0,
+	"dip":             0.95,
+	"pistolsquat":     0.85,
+	"airsquat":        0.7,
+	"bodyweightsquat": 0.7,
+	"lunge":           0.7,
+	"pushup":          0.64,
+	"invertedrow":     0.6,
+	"burpee":          0.5,
+}
+
+// BodyweightFraction returns the share of body weight moved by a bodyweight
+// exercise, matching names like "Pull-ups" and "push up".
+func BodyweightFraction(exerciseName string) (float64, bool) {
+	name := strings.ToLower(exerciseName)
+	name = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name)
+	name = strings.TrimSuffix(name, "s")
+	fraction, ok := bodyweightFractions[name]
+	return fraction, ok
+}
+
+// BodyweightVolume is the load moved by bodyweight exercises at the given
+// body weight, counting grouped entries once per round. Any added weight
+// (a weighted pull-up) is already part of WorkoutVolume and isn't
+// repeated here.
+func BodyweightVolume(w *store.Workout, bodyWeightKg float64) float64 {
+	var volume float64
+	w.EachEntry(func(e *store.WorkoutEntry, group *store.EntryGroup) {
+		fraction, ok := BodyweightFraction(e.ExerciseName)
+		if !ok || e.Reps == nil {
+			return
+		}
+		volume += float64(e.Sets) * float64(*e.Reps) * bodyWeightKg * fraction * float64(Rounds(group))
+	})
+	return volume
+}
+
+// MET values for resistance training by effort.
+const (
+	metLight    = 3.5
+	metModerate = 5.0
+	metVigorous = 8.0
+)
+
+// EstimateCalories estimates energy burned as MET × body weight × hours.
+// The MET comes from the average heart rate as a share of max when both
+// are known, and is otherwise that of moderate resistance training.
+func EstimateCalories(w *store.Workout, bodyWeightKg float64, profile heartrate.Profile) float64 {
+	met := metModerate
+	if w.AvgHeartRate != nil && profile.MaxHR > 0 {
+		intensity := float64(*w.AvgHeartRate) / float64(profile.MaxHR)
+		switch {
+		case intensity < 0.6:
+			met = metLight
+		case intensity >= 0.75:
+			met = metVigorous
+		}
+	}
+	return math.Round(met * bodyWeightKg * float64(w.DurationMinutes) / 60)
+}
+
+// ApplyBodyWeight adds the figures that depend on body weight to a
+// workout summary.
+func ApplyBodyWeight(summary *WorkoutSummary, w *store.Workout, bodyWeightKg float64, profile heartrate.Profile) {
+	summary.BodyWeight = &bodyWeightKg
+	summary.BodyweightVolume = round(BodyweightVolume(w, bodyWeightKg))
+	if w.CaloriesBurned == 0 && w.DurationMinutes > 0 {
+		estimate := EstimateCalories(w, bodyWeightKg, profile)
+		summary.EstimatedCalories = &estimate
+	}
+}
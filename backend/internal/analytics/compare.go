@@ -0,0 +1,154 @@
+package analytics
+
+import (
+	"math"
+	"strings"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+// ExerciseTotals is everything a workout did of one exercise, summed over
+// its entries with grouped entries counted once per round.
+type ExerciseTotals struct {
+	Exercise string `json:"exercise"`
+	Sets     int    `json:"sets"`
+	// Reps is the total over all sets.
+	Reps int `json:"reps"`
+	// TopWeight is the heaviest weight used, nil when none was logged.
+	TopWeight       *float64 `json:"top_weight"`
+	Volume          float64  `json:"volume"`
+	DurationSeconds int      `json:"duration_seconds"`
+	DistanceMeters  float64  `json:"distance_meters"`
+}
+
+// ExerciseDelta is how workout B changed an exercise from workout A.
+type ExerciseDelta struct {
+	Sets int `json:"sets"`
+	Reps int `json:"reps"`
+	// TopWeight is nil unless both workouts logged a weight.
+	TopWeight       *float64 `json:"top_weight"`
+	Volume          float64  `json:"volume"`
+	DurationSeconds int      `json:"duration_seconds"`
+	DistanceMeters  float64  `json:"distance_meters"`
+}
+
+// ExerciseComparison is an exercise done in both workouts.
+type ExerciseComparison struct {
+	Exercise string         `json:"exercise"`
+	A        ExerciseTotals `json:"a"`
+	B        ExerciseTotals `json:"b"`
+	Delta    ExerciseDelta  `json:"delta"`
+}
+
+// Comparison sets workout B against workout A, so positive deltas mean B
+// did more.
+type Comparison struct {
+	// Exercises are those in both workouts, in the order of B.
+	Exercises []ExerciseComparison `json:"exercises"`
+	// Added are only in B, Dropped only in A.
+	Added       []ExerciseTotals `json:"added"`
+	Dropped     []ExerciseTotals `json:"dropped"`
+	VolumeA     float64          `json:"volume_a"`
+	VolumeB     float64          `json:"volume_b"`
+	VolumeDelta float64          `json:"volume_delta"`
+	// VolumeChangePercent is nil when A moved no volume.
+	VolumeChangePercent *float64 `json:"volume_change_percent"`
+}
+
+// Compare aligns the entries of two workouts by exercise name, ignoring
+// case and surrounding spaces, and works out the change from a to b.
+func Compare(a, b *store.Workout) Comparison {
+	totalsA, orderA := exerciseTotals(a)
+	totalsB, orderB := exerciseTotals(b)
+
+	c := Comparison{
+		Exercises: []ExerciseComparison{},
+		Added:     []ExerciseTotals{},
+		Dropped:   []ExerciseTotals{},
+		VolumeA:   round2(WorkoutVolume(a)),
+		VolumeB:   round2(WorkoutVolume(b)),
+	}
+
+	for _, key := range orderB {
+		tb := totalsB[key]
+		ta, ok := totalsA[key]
+		if !ok {
+			c.Added = append(c.Added, *tb)
+			continue
+		}
+		c.Exercises = append(c.Exercises, ExerciseComparison{
+			Exercise: tb.Exercise,
+			A:        *ta,
+			B:        *tb,
+			Delta:    delta(ta, tb),
+		})
+	}
+	for _, key := range orderA {
+		if _, ok := totalsB[key]; !ok {
+			c.Dropped = append(c.Dropped, *totalsA[key])
+		}
+	}
+
+	c.VolumeDelta = round2(c.VolumeB - c.VolumeA)
+	if c.VolumeA > 0 {
+		percent := round(c.VolumeDelta / c.VolumeA * 100)
+		c.VolumeChangePercent = &percent
+	}
+	return c
+}
+
+// exerciseTotals sums the workout's entries per exercise, returning the
+// keys in the order each exercise first appears.
+func exerciseTotals(w *store.Workout) (map[string]*ExerciseTotals, []string) {
+	totals := make(map[string]*ExerciseTotals)
+	var order []string
+
+	w.EachEntry(func(e *store.WorkoutEntry, group *store.EntryGroup) {
+		name := strings.TrimSpace(e.ExerciseName)
+		key := strings.ToLower(name)
+		t, ok := totals[key]
+		if !ok {
+			t = &ExerciseTotals{Exercise: name}
+			totals[key] = t
+			order = append(order, key)
+		}
+
+		sets := e.Sets * Rounds(group)
+		t.Sets += sets
+		if e.Reps != nil {
+			t.Reps += sets * *e.Reps
+		}
+		if e.Weight != nil && (t.TopWeight == nil || *e.Weight > *t.TopWeight) {
+			weight := *e.Weight
+			t.TopWeight = &weight
+		}
+		t.Volume = round2(t.Volume + EntryVolume(e)*float64(Rounds(group)))
+		if e.DurationSeconds != nil {
+			t.DurationSeconds += sets * *e.DurationSeconds
+		}
+		if e.DistanceMeters != nil {
+			t.DistanceMeters = round2(t.DistanceMeters + float64(sets)**e.DistanceMeters)
+		}
+	})
+
+	return totals, order
+}
+
+func delta(a, b *ExerciseTotals) ExerciseDelta {
+	d := ExerciseDelta{
+		Sets:            b.Sets - a.Sets,
+		Reps:            b.Reps - a.Reps,
+		Volume:          round2(b.Volume - a.Volume),
+		DurationSeconds: b.DurationSeconds - a.DurationSeconds,
+		DistanceMeters:  round2(b.DistanceMeters - a.DistanceMeters),
+	}
+	if a.TopWeight != nil && b.TopWeight != nil {
+		weight := round2(*b.TopWeight - *a.TopWeight)
+		d.TopWeight = &weight
+	}
+	return d
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/strangecousinwst/goworkout/internal/achievement"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+type AchievementAPI struct {
+	achievementStore store.AchievementStore
+	logger           *log.Logger
+}
+
+func NewAchievementAPI(achievementStore store.AchievementStore, logger *log.Logger) *AchievementAPI {
+	return &AchievementAPI{
+		achievementStore: achievementStore,
+		logger:           logger,
+	}
+}
+
+// HandleGetAchievements returns the caller's badges, the ones still to
+// earn and the stats they are judged on, including the current streak.
+func (h *AchievementAPI) HandleGetAchievements(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	earned, err := h.achievementStore.GetAchievementsForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting achievements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	stats, err := h.achievementStore.GetAchievementStats(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting achievement stats: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	held := make(map[string]bool, len(earned))
+	for _, a := range earned {
+		held[a.Key] = true
+	}
+	locked := []achievement.Rule{}
+	for _, rule := range achievement.Rules() {
+		if !held[rule.Key] {
+			locked = append(locked, rule)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"achievements": earned,
+		"locked":       locked,
+		"stats":        stats,
+	})
+}
+
+// newAchievements returns the badges in after that weren't in before.
+func newAchievements(before, after []store.Achievement) []store.Achievement {
+	held := make(map[string]bool, len(before))
+	for _, a := range before {
+		held[a.Key] = true
+	}
+
+	unlocked := []store.Achievement{}
+	for _, a := range after {
+		if !held[a.Key] {
+			unlocked = append(unlocked, a)
+		}
+	}
+	return unlocked
+}
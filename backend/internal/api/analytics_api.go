@@ -0,0 +1,160 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/analytics"
+	"github.com/strangecousinwst/goworkout/internal/authz"
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+	"github.com/strangecousinwst/goworkout/internal/week"
+)
+
+const maxAnalyticsWeeks = 104
+
+type AnalyticsAPI struct {
+	analyticsStore   store.AnalyticsStore
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	authz            *authz.Checker
+	logger           *log.Logger
+}
+
+func NewAnalyticsAPI(analyticsStore store.AnalyticsStore, workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, checker *authz.Checker, logger *log.Logger) *AnalyticsAPI {
+	return &AnalyticsAPI{
+		analyticsStore:   analyticsStore,
+		workoutStore:     workoutStore,
+		measurementStore: measurementStore,
+		authz:            checker,
+		logger:           logger,
+	}
+}
+
+// HandleGetWeekly returns one summary per week for the last ?weeks= weeks
+// (12 by default), including the current one. Weeks run Monday to Sunday
+// in the user's timezone.
+func (h *AnalyticsAPI) HandleGetWeekly(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	window, ok := h.loadWeeks(w, r)
+	if !ok {
+		return
+	}
+
+	summaries := analytics.Weekly(window.workouts, window.loads, currentUser.HeartRateProfile(), window.from, window.to, currentUser.Location())
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"weeks": summaries})
+}
+
+// HandleGetActivityTypes breaks the last ?weeks= weeks (12 by default) of
+// training down by activity type.
+func (h *AnalyticsAPI) HandleGetActivityTypes(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	window, ok := h.loadWeeks(w, r)
+	if !ok {
+		return
+	}
+
+	types := analytics.ByActivityType(window.workouts, window.loads, currentUser.HeartRateProfile())
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"from": window.from, "to": window.to, "activity_types": types})
+}
+
+// analyticsWindow is the caller's training over [from, to).
+type analyticsWindow struct {
+	from, to time.Time
+	workouts []store.Workout
+	loads    map[int]heartrate.Load
+}
+
+// loadWeeks loads the caller's workouts and heart-rate loads of the last
+// ?weeks= weeks, writing an error response when that fails.
+func (h *AnalyticsAPI) loadWeeks(w http.ResponseWriter, r *http.Request) (*analyticsWindow, bool) {
+	currentUser := middleware.GetUser(r)
+
+	weeks, err := utils.ReadQueryInt(r, "weeks", 12)
+	if err != nil || weeks < 1 || weeks > maxAnalyticsWeeks {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "weeks must be between 1 and 104"})
+		return nil, false
+	}
+
+	window := &analyticsWindow{}
+	window.to = week.Start(time.Now(), currentUser.Location()).AddDate(0, 0, 7)
+	window.from = window.to.AddDate(0, 0, -7*weeks)
+
+	window.workouts, err = h.analyticsStore.GetWorkoutsBetween(currentUser.ID, window.from, window.to)
+	if err != nil {
+		h.logger.Printf("ERROR: getWorkoutsBetween: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	window.loads, err = h.analyticsStore.GetHeartRateLoadsBetween(currentUser.ID, window.from, window.to, currentUser.HeartRateProfile())
+	if err != nil {
+		h.logger.Printf("ERROR: getHeartRateLoadsBetween: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	return window, true
+}
+
+// HandleGetWorkoutAnalytics returns volume, time in heart-rate zones and
+// TRIMP for a single workout.
+func (h *AnalyticsAPI) HandleGetWorkoutAnalytics(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
+		return
+	}
+
+	// zones and body weight come from the owner's own settings
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, h.authz, h.logger, currentUser, workoutID, authz.Own) {
+		return
+	}
+
+	workout, err := h.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil || workout == nil {
+		h.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	samples, err := h.workoutStore.GetHeartRateSamples(workoutID)
+	if err != nil {
+		h.logger.Printf("ERROR: getHeartRateSamples: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	profile := currentUser.HeartRateProfile()
+	summary := analytics.SummarizeWorkout(workout, samples, profile)
+
+	bodyWeight, err := h.bodyWeightAt(currentUser.ID, workout.StartedAt)
+	if err != nil {
+		h.logger.Printf("ERROR: getting body weight: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if bodyWeight != nil {
+		analytics.ApplyBodyWeight(&summary, workout, bodyWeight.Value, profile)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"analytics": summary})
+}
+
+// bodyWeightAt returns the body weight logged most recently before t,
+// falling back to the latest one for users who only started weighing in
+// after the workout. It returns nil when no weight was ever logged.
+func (h *AnalyticsAPI) bodyWeightAt(userID int, t time.Time) (*store.Measurement, error) {
+	m, err := h.measurementStore.GetLatestMeasurement(userID, store.MeasurementBodyWeight, t)
+	if err != nil || m != nil {
+		return m, err
+	}
+	return h.measurementStore.GetLatestMeasurement(userID, store.MeasurementBodyWeight, time.Now())
+}
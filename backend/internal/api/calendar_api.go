@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/strangecousinwst/goworkout/internal/ical"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/schedule"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/tokens"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+// calendarTokenTTL is long because calendar apps keep polling the same URL
+// for as long as the subscription exists. Tokens are revoked explicitly.
+const calendarTokenTTL = 10 * 365 * 24 * time.Hour
+
+// Scheduled sessions are published from a little in the past, so recently
+// skipped or missed ones don't vanish at once, to a year ahead.
+const (
+	calendarPastDays   = 30
+	calendarFutureDays = 365
+)
+
+type CalendarAPI struct {
+	workoutStore  store.WorkoutStore
+	scheduleStore store.ScheduleStore
+	tokenStore    store.TokenStore
+	userStore     store.UserStore
+	logger        *log.Logger
+}
+
+func NewCalendarAPI(workoutStore store.WorkoutStore, scheduleStore store.ScheduleStore, tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *CalendarAPI {
+	return &CalendarAPI{
+		workoutStore:  workoutStore,
+		scheduleStore: scheduleStore,
+		tokenStore:    tokenStore,
+		userStore:     userStore,
+		logger:        logger,
+	}
+}
+
+// HandleCreateCalendarToken issues the secret feed URL for the caller.
+// Any previous calendar token stops working, so this doubles as rotation.
+func (h *CalendarAPI) HandleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteAllTokensForUser(currentUser.ID, tokens.ScopeCalendar)
+	if err != nil {
+		h.logger.Printf("ERROR: deleting calendar tokens: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(currentUser.ID, calendarTokenTTL, tokens.ScopeCalendar)
+	if err != nil || token == nil {
+		h.logger.Printf("ERROR: creating calendar token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"calendar_token": token,
+		"path":           fmt.Sprintf("/calendar/%s.ics", token.PlainText),
+	})
+}
+
+// HandleRevokeCalendarToken disables the caller's feed URL without touching
+// their login tokens.
+func (h *CalendarAPI) HandleRevokeCalendarToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteAllTokensForUser(currentUser.ID, tokens.ScopeCalendar)
+	if err != nil {
+		h.logger.Printf("ERROR: deleting calendar tokens: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetCalendarFeed serves the iCalendar feed. Calendar apps can't send
+// an Authorization header, so the token in the path is the credential.
+func (h *CalendarAPI) HandleGetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	user, err := h.userStore.GetUserToken(tokens.ScopeCalendar, token)
+	if err != nil || user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "calendar not found"})
+		return
+	}
+
+	now := time.Now()
+	occurrences, err := loadOccurrences(h.scheduleStore, user, now.AddDate(0, 0, -calendarPastDays), now.AddDate(0, 0, calendarFutureDays))
+	if err != nil {
+		h.logger.Printf("ERROR: expanding schedule for calendar: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		h.logger.Printf("WARN: clearing write deadline for calendar feed: %v", err)
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+
+	cal, err := ical.NewWriter(w, "Workouts")
+	for i := 0; err == nil && i < len(occurrences); i++ {
+		// completed sessions show up as the logged workout instead
+		if occurrences[i].Status != schedule.StatusCompleted {
+			err = cal.WriteEvent(occurrenceEvent(&occurrences[i]))
+		}
+	}
+	if err == nil {
+		err = h.workoutStore.StreamWorkoutsForUser(user.ID, func(workout *store.Workout) error {
+			return cal.WriteEvent(workoutEvent(workout))
+		})
+	}
+	if err == nil {
+		err = cal.Close()
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: streaming calendar for user %d: %v", user.ID, err)
+	}
+}
+
+func workoutEvent(workout *store.Workout) *ical.Event {
+	event := &ical.Event{
+		UID:         fmt.Sprintf("workout-%d@goworkout", workout.ID),
+		Start:       workout.StartedAt,
+		Summary:     workout.Title,
+		Description: workoutEventDescription(workout),
+		Status:      "CONFIRMED",
+	}
+	if workout.DurationMinutes > 0 {
+		event.End = workout.StartedAt.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+	}
+	return event
+}
+
+func occurrenceEvent(o *schedule.Occurrence) *ical.Event {
+	event := &ical.Event{
+		UID:     fmt.Sprintf("schedule-%d-%s@goworkout", o.ScheduleID, o.Date),
+		Start:   o.Start,
+		Summary: o.Title,
+		Status:  "TENTATIVE",
+	}
+	if o.End.After(o.Start) {
+		event.End = o.End
+	}
+	if o.Status == schedule.StatusSkipped {
+		event.Status = "CANCELLED"
+	}
+	return event
+}
+
+// workoutEventDescription lists the entries one per line, e.g.
+// "Bench Press: 3 x 10 @ 80 kg".
+func workoutEventDescription(workout *store.Workout) string {
+	var b strings.Builder
+	if workout.Description != "" {
+		b.WriteString(workout.Description)
+		b.WriteString("\n\n")
+	}
+
+	var lastGroup *store.EntryGroup
+	workout.EachEntry(func(entry *store.WorkoutEntry, group *store.EntryGroup) {
+		if group != nil && group != lastGroup {
+			b.WriteString(fmt.Sprintf("%s, %d rounds:\n", strings.ReplaceAll(group.Kind, "_", " "), group.Rounds))
+		}
+		lastGroup = group
+		if group != nil {
+			b.WriteString("  ")
+		}
+
+		b.WriteString(entry.ExerciseName)
+		b.WriteString(": ")
+		b.WriteString(strconv.Itoa(entry.Sets))
+		b.WriteString(" x ")
+		if entry.Reps != nil {
+			b.WriteString(strconv.Itoa(*entry.Reps))
+		} else if entry.DurationSeconds != nil {
+			b.WriteString((time.Duration(*entry.DurationSeconds) * time.Second).String())
+		}
+		if entry.Weight != nil {
+			b.WriteString(" @ " + strconv.FormatFloat(*entry.Weight, 'f', -1, 64) + " kg")
+		}
+		if entry.DistanceMeters != nil {
+			b.WriteString(", " + strconv.FormatFloat(*entry.DistanceMeters/1000, 'f', 2, 64) + " km")
+		}
+		b.WriteString("\n")
+	})
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+// maxChallengeDays keeps challenges to at most a year.
+const maxChallengeDays = 366
+
+type ChallengeAPI struct {
+	challengeStore store.ChallengeStore
+	orgStore       store.OrgStore
+	logger         *log.Logger
+}
+
+func NewChallengeAPI(challengeStore store.ChallengeStore, orgStore store.OrgStore, logger *log.Logger) *ChallengeAPI {
+	return &ChallengeAPI{
+		challengeStore: challengeStore,
+		orgStore:       orgStore,
+		logger:         logger,
+	}
+}
+
+type challengeResponse struct {
+	*store.Challenge
+	Status string `json:"status"`
+}
+
+// HandleCreateChallenge creates a challenge running from starts_on to the
+// end of ends_on. Challenges of an organization (org_id) are created by
+// its owners and coaches and use its timezone; open challenges use the
+// creator's.
+func (h *ChallengeAPI) HandleCreateChallenge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OrgID        *int     `json:"org_id"`
+		Name         string   `json:"name"`
+		Description  string   `json:"description"`
+		Metric       string   `json:"metric"`
+		ExerciseName string   `json:"exercise_name"`
+		DailyTarget  *float64 `json:"daily_target"`
+		StartsOn     string   `json:"starts_on"`
+		EndsOn       string   `json:"ends_on"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	c := &store.Challenge{
+		CreatedBy:   &currentUser.ID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Metric:      req.Metric,
+		DailyTarget: req.DailyTarget,
+	}
+
+	if c.Name == "" || len(c.Name) > 255 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required and at most 255 characters"})
+		return
+	}
+	if !store.ValidChallengeMetric(c.Metric) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "metric must be one of distance, reps, volume"})
+		return
+	}
+	if name := strings.TrimSpace(req.ExerciseName); name != "" {
+		c.ExerciseName = &name
+	}
+	if c.DailyTarget != nil && *c.DailyTarget <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "daily_target must be positive"})
+		return
+	}
+
+	loc := currentUser.Location()
+	if req.OrgID != nil {
+		org, ok := h.managedOrg(w, currentUser.ID, *req.OrgID)
+		if !ok {
+			return
+		}
+		c.OrgID = &org.ID
+		loc = org.Location()
+	}
+	c.Timezone = loc.String()
+
+	startsOn, err := time.ParseInLocation(store.DateLayout, req.StartsOn, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "starts_on must be a date like 2025-10-01"})
+		return
+	}
+	endsOn, err := time.ParseInLocation(store.DateLayout, req.EndsOn, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "ends_on must be a date like 2025-10-31"})
+		return
+	}
+	c.StartsOn, c.EndsOn = req.StartsOn, req.EndsOn
+	c.StartsAt = startsOn
+	c.EndsAt = endsOn.AddDate(0, 0, 1)
+	if endsOn.Before(startsOn) || c.EndsAt.After(startsOn.AddDate(0, 0, maxChallengeDays)) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "ends_on must be on or after starts_on and within a year of it"})
+		return
+	}
+	now := time.Now()
+	if c.Ended(now) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "ends_on must not be in the past"})
+		return
+	}
+
+	err = h.challengeStore.CreateChallenge(c)
+	if err != nil {
+		h.logger.Printf("ERROR: creating challenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"challenge": challengeResponse{Challenge: c, Status: c.Status(now)}})
+}
+
+// managedOrg loads an organization the user manages, writing an error
+// response otherwise. Organizations of others are reported as missing.
+func (h *ChallengeAPI) managedOrg(w http.ResponseWriter, userID, orgID int) (*store.Organization, bool) {
+	membership, err := h.orgStore.GetMembership(orgID, userID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting membership: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if membership == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "organization does not exist"})
+		return nil, false
+	}
+	if !membership.CanManage() {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only owners and coaches can create organization challenges"})
+		return nil, false
+	}
+
+	org, err := h.orgStore.GetOrgByID(orgID)
+	if err != nil || org == nil {
+		h.logger.Printf("ERROR: getting organization %d: %v", orgID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return org, true
+}
+
+// HandleGetChallenges lists the open challenges and those of the caller's
+// organizations.
+func (h *ChallengeAPI) HandleGetChallenges(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	challenges, err := h.challengeStore.GetChallengesForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting challenges: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	now := time.Now()
+	type listedChallenge struct {
+		store.UserChallenge
+		Status string `json:"status"`
+	}
+	listed := make([]listedChallenge, len(challenges))
+	for i, c := range challenges {
+		listed[i] = listedChallenge{UserChallenge: c, Status: c.Status(now)}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"challenges": listed})
+}
+
+// HandleGetChallenge returns challenge {id} with its standings. Once the
+// challenge has ended its results are frozen and the final ranks recorded.
+func (h *ChallengeAPI) HandleGetChallenge(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.visibleChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if c.Ended(now) && c.FinalizedAt == nil {
+		err := h.challengeStore.FinalizeChallenge(c.ID)
+		if err == nil {
+			c, err = h.challengeStore.GetChallengeByID(c.ID)
+		}
+		if err != nil || c == nil {
+			h.logger.Printf("ERROR: finalizing challenge: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	standings, err := h.challengeStore.GetStandings(c.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting standings: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"challenge": challengeResponse{Challenge: c, Status: c.Status(now)},
+		"standings": standings,
+	})
+}
+
+func (h *ChallengeAPI) HandleJoinChallenge(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.visibleChallenge(w, r)
+	if !ok {
+		return
+	}
+	if c.Ended(time.Now()) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "challenge has ended"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err := h.challengeStore.Join(c.ID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "you have already joined this challenge"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: joining challenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleLeaveChallenge takes the caller out of a challenge that hasn't
+// ended; final results keep everyone who took part.
+func (h *ChallengeAPI) HandleLeaveChallenge(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.visibleChallenge(w, r)
+	if !ok {
+		return
+	}
+	if c.Ended(time.Now()) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "challenge has ended"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err := h.challengeStore.Leave(c.ID, currentUser.ID)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: leaving challenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteChallenge deletes a challenge. Its creator may, as may the
+// owners of its organization.
+func (h *ChallengeAPI) HandleDeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.visibleChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	allowed := c.CreatedBy != nil && *c.CreatedBy == currentUser.ID
+	if !allowed && c.OrgID != nil {
+		membership, err := h.orgStore.GetMembership(*c.OrgID, currentUser.ID)
+		if err != nil {
+			h.logger.Printf("ERROR: getting membership: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		allowed = membership != nil && membership.Role == store.OrgRoleOwner
+	}
+	if !allowed {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to delete this challenge"})
+		return
+	}
+
+	err := h.challengeStore.DeleteChallenge(c.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting challenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// visibleChallenge loads challenge {id}, writing an error response unless
+// the caller may see it. Challenges of organizations the caller isn't in
+// are reported as missing.
+func (h *ChallengeAPI) visibleChallenge(w http.ResponseWriter, r *http.Request) (*store.Challenge, bool) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge ID"})
+		return nil, false
+	}
+
+	c, err := h.challengeStore.GetChallengeByID(challengeID)
+	if err != nil {
+		h.logger.Printf("ERROR: getChallengeByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	if c != nil && c.OrgID != nil {
+		membership, err := h.orgStore.GetMembership(*c.OrgID, middleware.GetUser(r).ID)
+		if err != nil {
+			h.logger.Printf("ERROR: getting membership: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return nil, false
+		}
+		if membership == nil {
+			c = nil
+		}
+	}
+	if c == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge does not exist"})
+		return nil, false
+	}
+
+	return c, true
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type CoachAPI struct {
+	coachStore  store.CoachStore
+	socialStore store.SocialStore
+	logger      *log.Logger
+}
+
+func NewCoachAPI(coachStore store.CoachStore, socialStore store.SocialStore, logger *log.Logger) *CoachAPI {
+	return &CoachAPI{
+		coachStore:  coachStore,
+		socialStore: socialStore,
+		logger:      logger,
+	}
+}
+
+// HandleGrantCoach invites user {id} to coach the caller with the given
+// permissions, or changes the permissions of an existing grant. New
+// invitations are pending until the coach accepts them.
+func (h *CoachAPI) HandleGrantCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Permissions store.Permissions `json:"permissions"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Permissions == (store.Permissions{}) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "grant at least one of read, write or assign"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if coachID == currentUser.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't coach yourself"})
+		return
+	}
+
+	coach, err := h.socialStore.GetUserSummary(coachID)
+	if err != nil {
+		h.logger.Printf("ERROR: getUserSummary: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if coach == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user does not exist"})
+		return
+	}
+
+	grant, err := h.coachStore.CreateGrant(currentUser.ID, coachID, req.Permissions)
+	if err == sql.ErrNoRows {
+		err = h.coachStore.UpdateGrant(currentUser.ID, coachID, req.Permissions)
+		if err != nil {
+			h.logger.Printf("ERROR: updating grant: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		h.writeGrant(w, currentUser.ID, coachID)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: creating grant: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	grant.User = *coach
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"grant": grant})
+}
+
+// writeGrant responds with the caller's grant to coachID.
+func (h *CoachAPI) writeGrant(w http.ResponseWriter, athleteID, coachID int) {
+	grants, err := h.coachStore.GetCoaches(athleteID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting coaches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, g := range grants {
+		if g.CoachID == coachID {
+			utils.WriteJSON(w, http.StatusOK, utils.Envelope{"grant": g})
+			return
+		}
+	}
+	utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "grant does not exist"})
+}
+
+// HandleRevokeCoach ends user {id}'s access to the caller's data.
+func (h *CoachAPI) HandleRevokeCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	h.deleteGrant(w, currentUser.ID, coachID)
+}
+
+// HandleLeaveAthlete declines user {id}'s invitation, or stops coaching
+// them.
+func (h *CoachAPI) HandleLeaveAthlete(w http.ResponseWriter, r *http.Request) {
+	athleteID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	h.deleteGrant(w, athleteID, currentUser.ID)
+}
+
+func (h *CoachAPI) deleteGrant(w http.ResponseWriter, athleteID, coachID int) {
+	err := h.coachStore.DeleteGrant(athleteID, coachID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "grant does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting grant: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAcceptAthlete accepts user {id}'s invitation to coach them.
+func (h *CoachAPI) HandleAcceptAthlete(w http.ResponseWriter, r *http.Request) {
+	athleteID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.coachStore.AcceptGrant(athleteID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: accepting grant: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetCoaches lists who the caller has granted access to.
+func (h *CoachAPI) HandleGetCoaches(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	grants, err := h.coachStore.GetCoaches(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting coaches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaches": grants})
+}
+
+// HandleGetAthletes lists the caller's athletes and pending invitations.
+func (h *CoachAPI) HandleGetAthletes(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	grants, err := h.coachStore.GetAthletes(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting athletes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"athletes": grants})
+}
+
+// HandleGetAuditLog lists what coaches did to the caller's workouts.
+func (h *CoachAPI) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.ReadQueryInt(r, "limit", defaultAuditLimit)
+	if err != nil || limit < 1 || limit > maxAuditLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	entries, err := h.coachStore.GetAuditLog(currentUser.ID, limit)
+	if err != nil {
+		h.logger.Printf("ERROR: getting audit log: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"audit": entries})
+}
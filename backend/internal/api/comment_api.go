@@ -0,0 +1,311 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/strangecousinwst/goworkout/internal/authz"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/ratelimit"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	maxCommentLength = 2000
+	maxEmojiBytes    = 32
+)
+
+type CommentAPI struct {
+	commentStore    store.CommentStore
+	authz           *authz.Checker
+	commentLimiter  *ratelimit.Limiter
+	reactionLimiter *ratelimit.Limiter
+	logger          *log.Logger
+}
+
+func NewCommentAPI(commentStore store.CommentStore, checker *authz.Checker, logger *log.Logger) *CommentAPI {
+	return &CommentAPI{
+		commentStore:    commentStore,
+		authz:           checker,
+		commentLimiter:  ratelimit.New(10, time.Minute),
+		reactionLimiter: ratelimit.New(60, time.Minute),
+		logger:          logger,
+	}
+}
+
+// HandleGetComments lists the comments on workout {id} as threads.
+func (h *CommentAPI) HandleGetComments(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := h.commentStore.GetCommentsForWorkout(workoutID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting comments: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comments": comments})
+}
+
+// HandleCreateComment comments on workout {id}, or replies to a top-level
+// comment on it when parent_id is set.
+func (h *CommentAPI) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Body     string `json:"body"`
+		ParentID *int   `json:"parent_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body is required"})
+		return
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body must be at most 2000 characters"})
+		return
+	}
+
+	if req.ParentID != nil {
+		parent, err := h.commentStore.GetCommentByID(*req.ParentID)
+		if err != nil {
+			h.logger.Printf("ERROR: getting parent comment: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if parent == nil || parent.WorkoutID != workoutID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "parent comment does not exist"})
+			return
+		}
+		if parent.ParentID != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "replies can't be replied to"})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+	if !allowRate(w, h.commentLimiter, currentUser.ID) {
+		return
+	}
+
+	comment := &store.Comment{
+		WorkoutID: workoutID,
+		ParentID:  req.ParentID,
+		Author:    store.UserSummary{ID: currentUser.ID},
+		Body:      req.Body,
+	}
+	err = h.commentStore.CreateComment(comment)
+	if err != nil {
+		h.logger.Printf("ERROR: creating comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"comment": comment})
+}
+
+// HandleDeleteComment deletes a comment and its replies. Authors may
+// delete their own comments and owners any comment on their workout.
+func (h *CommentAPI) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	commentID, err := strconv.Atoi(chi.URLParam(r, "commentID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid comment ID"})
+		return
+	}
+
+	comment, err := h.commentStore.GetCommentByID(commentID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if comment == nil || comment.WorkoutID != workoutID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment does not exist"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if comment.Author.ID != currentUser.ID {
+		err = h.authz.Workout(currentUser, workoutID, authz.Own)
+		if errors.Is(err, authz.ErrForbidden) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you can only delete your own comments"})
+			return
+		}
+		if err != nil {
+			h.logger.Printf("ERROR: authorizing comment deletion: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	err = h.commentStore.DeleteComment(commentID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetReactions counts the reactions on workout {id} per emoji.
+func (h *CommentAPI) HandleGetReactions(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	reactions, err := h.commentStore.GetReactions(workoutID, currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting reactions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reactions": reactions})
+}
+
+// HandleAddReaction reacts to workout {id} with the URL-escaped {emoji}.
+func (h *CommentAPI) HandleAddReaction(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	emoji, ok := readEmoji(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if !allowRate(w, h.reactionLimiter, currentUser.ID) {
+		return
+	}
+
+	err := h.commentStore.AddReaction(workoutID, currentUser.ID, emoji)
+	if err != nil {
+		h.logger.Printf("ERROR: adding reaction: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CommentAPI) HandleRemoveReaction(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := h.viewableWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	emoji, ok := readEmoji(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err := h.commentStore.RemoveReaction(workoutID, currentUser.ID, emoji)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you haven't reacted with this emoji"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: removing reaction: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// viewableWorkout reads workout {id} and checks the caller may see it;
+// anyone who can see a workout can comment on it and react to it.
+func (h *CommentAPI) viewableWorkout(w http.ResponseWriter, r *http.Request) (int, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
+		return 0, false
+	}
+
+	if !authorizeWorkout(w, h.authz, h.logger, middleware.GetUser(r), workoutID, authz.View) {
+		return 0, false
+	}
+	return workoutID, true
+}
+
+// allowRate applies limiter to the user, answering 429 with Retry-After
+// when they are over it.
+func allowRate(w http.ResponseWriter, limiter *ratelimit.Limiter, userID int) bool {
+	ok, retryAfter := limiter.Allow(userID)
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "slow down, try again shortly"})
+	return false
+}
+
+func readEmoji(w http.ResponseWriter, r *http.Request) (string, bool) {
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil || !validEmoji(emoji) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "reaction must be a single emoji"})
+		return "", false
+	}
+	return emoji, true
+}
+
+// validEmoji accepts a short run of pictographic symbols, including the
+// joiners, variation selectors and skin tone modifiers that compose them.
+// It doesn't check that the run is a single grapheme.
+func validEmoji(s string) bool {
+	if s == "" || len(s) > maxEmojiBytes || !utf8.ValidString(s) {
+		return false
+	}
+
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			return false
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r), unicode.Is(unicode.Me, r):
+		case r == '\u200d', r == '\ufe0f': // zero width joiner, emoji presentation
+		default:
+			return false
+		}
+	}
+	return true
+}
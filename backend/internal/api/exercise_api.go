@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	maxExerciseNameLength = 255
+	defaultSuggestLimit   = 10
+	maxSuggestLimit       = 50
+)
+
+type ExerciseAPI struct {
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+func NewExerciseAPI(workoutStore store.WorkoutStore, logger *log.Logger) *ExerciseAPI {
+	return &ExerciseAPI{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// HandleSuggestExercises autocompletes ?q= from the exercise names the
+// caller has logged, so variants like "Benchpress" and "bench press" lead
+// back to the name already in use.
+func (h *ExerciseAPI) HandleSuggestExercises(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxExerciseNameLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "q is required and at most 255 characters"})
+		return
+	}
+
+	limit, err := utils.ReadQueryInt(r, "limit", defaultSuggestLimit)
+	if err != nil || limit < 1 || limit > maxSuggestLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 50"})
+		return
+	}
+
+	suggestions, err := h.workoutStore.SuggestExercises(middleware.GetUser(r).ID, q, limit)
+	if err != nil {
+		h.logger.Printf("ERROR: suggesting exercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"suggestions": suggestions})
+}
+
+// HandlePreviewExerciseMerge reports which of the caller's entries and
+// goals a merge with the same body would rename, without renaming them.
+func (h *ExerciseAPI) HandlePreviewExerciseMerge(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := readExerciseMerge(w, r)
+	if !ok {
+		return
+	}
+
+	merge, err := h.workoutStore.PreviewExerciseMerge(middleware.GetUser(r).ID, from, to)
+	if err != nil {
+		h.logger.Printf("ERROR: previewing exercise merge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"merge": merge})
+}
+
+// HandleMergeExercises renames all of the caller's entries and goals
+// logged as "from", in any case, to "to" in one go. Merging a name into a
+// recasing of itself settles every variant on that spelling.
+func (h *ExerciseAPI) HandleMergeExercises(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := readExerciseMerge(w, r)
+	if !ok {
+		return
+	}
+
+	merge, err := h.workoutStore.MergeExercises(middleware.GetUser(r).ID, from, to)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no entries are logged under this name"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: merging exercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"merge": merge})
+}
+
+// readExerciseMerge decodes a {"from", "to"} body, writing an error
+// response when it isn't a usable rename.
+func readExerciseMerge(w http.ResponseWriter, r *http.Request) (from, to string, ok bool) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return "", "", false
+	}
+
+	to = strings.TrimSpace(req.To)
+	err = validateExerciseMerge(req.From, to)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return "", "", false
+	}
+
+	return req.From, to, true
+}
+
+// validateExerciseMerge checks a rename. from is taken as stored so that
+// names with stray whitespace can be merged away.
+func validateExerciseMerge(from, to string) error {
+	switch {
+	case from == "":
+		return errors.New("from is required")
+	case to == "":
+		return errors.New("to is required")
+	case utf8.RuneCountInString(to) > maxExerciseNameLength:
+		return errors.New("to must be at most 255 characters")
+	case from == to:
+		return errors.New("from and to must differ")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateExerciseMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr string
+	}{
+		{name: "rename", from: "BB Bench", to: "Bench Press"},
+		// entries match from in any case, so this settles every casing
+		// of the name on one spelling
+		{name: "case variant", from: "bench press", to: "Bench Press"},
+		{name: "stray whitespace in from", from: "Bench Press ", to: "Bench Press"},
+		{name: "same name", from: "Bench Press", to: "Bench Press", wantErr: "from and to must differ"},
+		{name: "no from", from: "", to: "Bench Press", wantErr: "from is required"},
+		{name: "no to", from: "BB Bench", to: "", wantErr: "to is required"},
+		{name: "to too long", from: "BB Bench", to: strings.Repeat("a", 256), wantErr: "to must be at most 255 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExerciseMerge(tt.from, tt.to)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateExerciseMerge(%q, %q): %v", tt.from, tt.to, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateExerciseMerge(%q, %q) = %v, want %q", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
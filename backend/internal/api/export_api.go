@@ -0,0 +1,306 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/export"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	// maxConcurrentExports bounds how many async exports write files at
+	// once.
+	maxConcurrentExports = 2
+	// exportTTL is how long a finished export stays downloadable before
+	// its file and job are deleted.
+	exportTTL = 7 * 24 * time.Hour
+	// exportExpiryInterval is how often expired exports are looked for.
+	exportExpiryInterval = time.Hour
+)
+
+type ExportAPI struct {
+	workoutStore store.WorkoutStore
+	exportStore  store.ExportStore
+	exportDir    string
+	slots        chan struct{}
+	logger       *log.Logger
+}
+
+func NewExportAPI(workoutStore store.WorkoutStore, exportStore store.ExportStore, exportDir string, logger *log.Logger) *ExportAPI {
+	return &ExportAPI{
+		workoutStore: workoutStore,
+		exportStore:  exportStore,
+		exportDir:    exportDir,
+		slots:        make(chan struct{}, maxConcurrentExports),
+		logger:       logger,
+	}
+}
+
+func readExportFormat(r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatJSON
+	}
+	return format, export.ValidFormat(format)
+}
+
+// HandleExportWorkouts streams the caller's full history in the requested
+// format as it is read from the database.
+func (h *ExportAPI) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	format, ok := readExportFormat(r)
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv, json or ndjson"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	// a long history can take longer than the server's write timeout
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		h.logger.Printf("WARN: clearing write deadline for export: %v", err)
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="workouts.%s"`, format))
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		h.logger.Printf("ERROR: creating export writer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.workoutStore.StreamWorkoutsForUser(currentUser.ID, writer.WriteWorkout)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// headers are gone by now, all we can do is cut the response short
+		h.logger.Printf("ERROR: streaming export for user %d: %v", currentUser.ID, err)
+	}
+}
+
+// HandleCreateExport starts an export in the background and returns the
+// job, which can be polled until its file is ready to download.
+func (h *ExportAPI) HandleCreateExport(w http.ResponseWriter, r *http.Request) {
+	format, ok := readExportFormat(r)
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv, json or ndjson"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	job := &store.Export{UserID: currentUser.ID, Format: format}
+	err := h.exportStore.CreateExport(job)
+	if err != nil {
+		h.logger.Printf("ERROR: creatingExport: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	go h.runExport(*job)
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"export": job})
+}
+
+func (h *ExportAPI) exportPath(job *store.Export) string {
+	return filepath.Join(h.exportDir, fmt.Sprintf("export-%d.%s", job.ID, job.Format))
+}
+
+// RecoverExports fails the jobs a previous process left pending or
+// running, since nothing will ever finish them, and removes the temporary
+// files they were writing. Call it at startup, before serving requests.
+func (h *ExportAPI) RecoverExports() error {
+	n, err := h.exportStore.FailUnfinishedExports("export was interrupted by a server restart; please start a new one")
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		h.logger.Printf("INFO: marked %d interrupted exports as failed", n)
+	}
+
+	tmps, err := filepath.Glob(filepath.Join(h.exportDir, "export-*.tmp"))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmps {
+		err = os.Remove(tmp)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireExports deletes exports that finished more than exportTTL ago,
+// along with their files.
+func (h *ExportAPI) ExpireExports() error {
+	expired, err := h.exportStore.DeleteExportsFinishedBefore(time.Now().Add(-exportTTL))
+	if err != nil {
+		return err
+	}
+
+	for i := range expired {
+		err = os.Remove(h.exportPath(&expired[i]))
+		if err != nil && !os.IsNotExist(err) {
+			h.logger.Printf("ERROR: removing expired export %d: %v", expired[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// RunExpiry calls ExpireExports every exportExpiryInterval, forever. Run
+// it in its own goroutine.
+func (h *ExportAPI) RunExpiry() {
+	ticker := time.NewTicker(exportExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		err := h.ExpireExports()
+		if err != nil {
+			h.logger.Printf("ERROR: expiring exports: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (h *ExportAPI) runExport(job store.Export) {
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	err := h.exportStore.UpdateExportStatus(job.ID, store.ExportStatusRunning, "")
+	if err != nil {
+		h.logger.Printf("ERROR: marking export %d as running: %v", job.ID, err)
+		return
+	}
+
+	err = h.writeExportFile(&job)
+	if err != nil {
+		h.logger.Printf("ERROR: writing export %d: %v", job.ID, err)
+
+		err = h.exportStore.UpdateExportStatus(job.ID, store.ExportStatusFailed, "export failed")
+		if err != nil {
+			h.logger.Printf("ERROR: marking export %d as failed: %v", job.ID, err)
+		}
+		return
+	}
+
+	err = h.exportStore.UpdateExportStatus(job.ID, store.ExportStatusCompleted, "")
+	if err != nil {
+		h.logger.Printf("ERROR: marking export %d as completed: %v", job.ID, err)
+	}
+}
+
+// writeExportFile writes to a temporary file first so a download never
+// sees a half written export.
+func (h *ExportAPI) writeExportFile(job *store.Export) error {
+	err := os.MkdirAll(h.exportDir, 0o750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(h.exportDir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer, err := export.NewWriter(job.Format, tmp)
+	if err != nil {
+		return err
+	}
+
+	err = h.workoutStore.StreamWorkoutsForUser(job.UserID, writer.WriteWorkout)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), h.exportPath(job))
+}
+
+func (h *ExportAPI) getOwnExport(w http.ResponseWriter, r *http.Request) *store.Export {
+	exportID, err := utils.ReadIDParam(r)
+	if err != nil {
+		h.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid export ID"})
+		return nil
+	}
+
+	job, err := h.exportStore.GetExportByID(exportID)
+	if err != nil {
+		h.logger.Printf("ERROR: getExportByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	currentUser := middleware.GetUser(r)
+	if job == nil || job.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "export does not exist"})
+		return nil
+	}
+
+	return job
+}
+
+func (h *ExportAPI) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+	job := h.getOwnExport(w, r)
+	if job == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"export": job})
+}
+
+func (h *ExportAPI) HandleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	job := h.getOwnExport(w, r)
+	if job == nil {
+		return
+	}
+
+	if job.Status != store.ExportStatusCompleted {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "export is not ready yet", "status": job.Status})
+		return
+	}
+
+	file, err := os.Open(h.exportPath(job))
+	if err != nil {
+		h.logger.Printf("ERROR: opening export %d: %v", job.ID, err)
+		utils.WriteJSON(w, http.StatusGone, utils.Envelope{"error": "export file is no longer available"})
+		return
+	}
+	defer file.Close()
+
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		h.logger.Printf("WARN: clearing write deadline for export download: %v", err)
+	}
+
+	var modTime time.Time
+	if job.CompletedAt != nil {
+		modTime = *job.CompletedAt
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(job.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="workouts.%s"`, job.Format))
+	http.ServeContent(w, r, "", modTime, file)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/goal"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+// maxGoalDays keeps deadlines within a couple of years.
+const maxGoalDays = 2 * 366
+
+type GoalAPI struct {
+	goalStore        store.GoalStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewGoalAPI(goalStore store.GoalStore, measurementStore store.MeasurementStore, logger *log.Logger) *GoalAPI {
+	return &GoalAPI{
+		goalStore:        goalStore,
+		measurementStore: measurementStore,
+		logger:           logger,
+	}
+}
+
+type goalResponse struct {
+	*store.Goal
+	Progress goal.Progress `json:"progress"`
+}
+
+func newGoalResponse(g *store.Goal, now time.Time) goalResponse {
+	return goalResponse{Goal: g, Progress: goal.Evaluate(g, now)}
+}
+
+// HandleCreateGoal sets a goal running from now until the end of its
+// deadline day in the caller's timezone.
+func (h *GoalAPI) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind         string  `json:"kind"`
+		Title        string  `json:"title"`
+		ExerciseName string  `json:"exercise_name"`
+		TargetValue  float64 `json:"target_value"`
+		TargetReps   *int    `json:"target_reps"`
+		Deadline     string  `json:"deadline"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+	now := time.Now()
+
+	g := &store.Goal{
+		UserID:      currentUser.ID,
+		Kind:        req.Kind,
+		Title:       strings.TrimSpace(req.Title),
+		TargetValue: req.TargetValue,
+		StartsAt:    now,
+	}
+
+	switch req.Kind {
+	case store.GoalWeeklyFrequency, store.GoalMonthlyVolume, store.GoalBodyWeight, store.GoalDistance:
+	case store.GoalLift:
+		name := strings.TrimSpace(req.ExerciseName)
+		if name == "" {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "lift goals need an exercise_name"})
+			return
+		}
+		g.ExerciseName = &name
+		g.TargetReps = req.TargetReps
+		if g.TargetReps == nil {
+			reps := 1
+			g.TargetReps = &reps
+		}
+		if *g.TargetReps < 1 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target_reps must be at least 1"})
+			return
+		}
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be one of weekly_frequency, monthly_volume, lift, body_weight, distance"})
+		return
+	}
+
+	if g.TargetValue <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target_value must be positive"})
+		return
+	}
+
+	deadline, err := time.ParseInLocation(store.DateLayout, req.Deadline, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "deadline must be a date like 2025-06-02"})
+		return
+	}
+	g.Deadline = req.Deadline
+	g.EndsAt = deadline.AddDate(0, 0, 1)
+	if !g.EndsAt.After(now) || g.EndsAt.After(now.AddDate(0, 0, maxGoalDays)) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "deadline must be between today and two years from now"})
+		return
+	}
+
+	if g.Kind == store.GoalBodyWeight {
+		// a body-weight goal is only meaningful relative to where you start
+		latest, err := h.measurementStore.GetLatestMeasurement(currentUser.ID, store.MeasurementBodyWeight, now)
+		if err != nil {
+			h.logger.Printf("ERROR: getting body weight: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if latest == nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "log your body weight before setting a body_weight goal"})
+			return
+		}
+	}
+
+	if g.Title == "" {
+		g.Title = defaultGoalTitle(g)
+	}
+
+	err = h.goalStore.CreateGoal(g)
+	if errors.Is(err, store.ErrGoalReached) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": goalReachedMessage(g)})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: creating goal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"goal": newGoalResponse(g, now)})
+}
+
+func (h *GoalAPI) HandleGetGoals(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	goals, err := h.goalStore.GetGoalsForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting goals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	now := time.Now()
+	responses := make([]goalResponse, len(goals))
+	for i := range goals {
+		responses[i] = newGoalResponse(&goals[i], now)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goals": responses})
+}
+
+func (h *GoalAPI) HandleGetGoalByID(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.ownGoal(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goal": newGoalResponse(g, time.Now())})
+}
+
+func (h *GoalAPI) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.ownGoal(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.goalStore.DeleteGoal(g.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting goal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownGoal loads the goal named by {id}, writing an error response unless it
+// exists and belongs to the current user.
+func (h *GoalAPI) ownGoal(w http.ResponseWriter, r *http.Request) (*store.Goal, bool) {
+	goalID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal ID"})
+		return nil, false
+	}
+
+	g, err := h.goalStore.GetGoalByID(goalID)
+	if err != nil {
+		h.logger.Printf("ERROR: getGoalByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if g == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal does not exist"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if g.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to access this goal"})
+		return nil, false
+	}
+
+	return g, true
+}
+
+func defaultGoalTitle(g *store.Goal) string {
+	switch g.Kind {
+	case store.GoalWeeklyFrequency:
+		return "Train " + formatNumber(g.TargetValue) + " times a week"
+	case store.GoalMonthlyVolume:
+		return "Lift " + formatNumber(g.TargetValue) + " kg a month"
+	case store.GoalLift:
+		return *g.ExerciseName + " " + formatNumber(g.TargetValue) + " kg × " + formatNumber(float64(*g.TargetReps))
+	case store.GoalBodyWeight:
+		return "Weigh " + formatNumber(g.TargetValue) + " kg"
+	default:
+		return "Cover " + formatNumber(g.TargetValue/1000) + " km"
+	}
+}
+
+// goalReachedMessage explains why a goal its start value already meets
+// can't be set.
+func goalReachedMessage(g *store.Goal) string {
+	if g.Kind == store.GoalLift {
+		return "target_value must be above your best " + *g.ExerciseName + " so far, " + formatNumber(g.StartValue) + " kg"
+	}
+	return "target_value must differ from your current body weight, " + formatNumber(g.StartValue) + " kg"
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,667 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/applehealth"
+	"github.com/strangecousinwst/goworkout/internal/fit"
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/importer"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	maxFITFileBytes         = 32 << 20
+	maxCSVFileBytes         = 32 << 20
+	maxAppleHealthFileBytes = 2 << 30
+
+	sourceAppleHealth = "apple_health"
+	sourceFIT         = "fit"
+	// appleHealthBatchSize is how many records of a kind an Apple Health
+	// import buffers before writing them in one transaction.
+	appleHealthBatchSize = 500
+)
+
+type ImportAPI struct {
+	workoutStore     store.WorkoutStore
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewImportAPI(workoutStore store.WorkoutStore, measurementStore store.MeasurementStore, logger *log.Logger) *ImportAPI {
+	return &ImportAPI{
+		workoutStore:     workoutStore,
+		measurementStore: measurementStore,
+		logger:           logger,
+	}
+}
+
+// HandleImportFIT takes a raw .fit file as the request body and creates one
+// workout per session found in it. Sessions already imported are skipped,
+// so the same file can be uploaded again safely.
+func (h *ImportAPI) HandleImportFIT(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	file, err := fit.Decode(http.MaxBytesReader(w, r.Body, maxFITFileBytes))
+	if err != nil {
+		h.logger.Printf("ERROR: decodingFIT: %v", err)
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "file is too large"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid FIT file"})
+		return
+	}
+
+	if len(file.Sessions) == 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "FIT file does not contain any sessions"})
+		return
+	}
+
+	imported := []*store.Workout{}
+	skipped := 0
+	for i, workout := range workoutsFromFIT(file) {
+		workout.UserID = currentUser.ID
+
+		_, err = h.workoutStore.CreateWorkoutWithHeartRate(workout, heartRateSeries(file, i))
+		if errors.Is(err, store.ErrDuplicateSource) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			h.logger.Printf("ERROR: creatingWorkout from FIT: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to import workout", "workouts": imported, "skipped": skipped})
+			return
+		}
+		imported = append(imported, workout)
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workouts": imported, "skipped": skipped})
+}
+
+// HandleImportCSV imports a CSV export from another app. It takes a
+// multipart form with the CSV in "file" and these fields (which may also be
+// given as query parameters):
+//
+//	source    strong, hevy or fitnotes
+//	dry_run   "true" to only preview what would be imported
+//	mappings  JSON object mapping source exercise names to our names
+//	timezone  IANA zone for timestamps without one, defaults to UTC
+//	units     "imperial" when a Strong export is in lbs/miles
+func (h *ImportAPI) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVFileBytes)
+	err := r.ParseMultipartForm(maxCSVFileBytes)
+	if err != nil {
+		h.logger.Printf("ERROR: parsing CSV import form: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expected a multipart form with a CSV file"})
+		return
+	}
+
+	source := r.FormValue("source")
+	adapter, ok := importer.Lookup(source)
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "source must be one of: " + strings.Join(importer.Sources(), ", ")})
+		return
+	}
+
+	opts := importer.Options{Location: time.UTC, Imperial: r.FormValue("units") == "imperial"}
+	if tz := r.FormValue("timezone"); tz != "" {
+		opts.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid timezone"})
+			return
+		}
+	}
+
+	var mappings map[string]string
+	if raw := r.FormValue("mappings"); raw != "" {
+		err = json.Unmarshal([]byte(raw), &mappings)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mappings must be a JSON object of exercise names"})
+			return
+		}
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	rows, err := adapter.Parse(file, opts)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": fmt.Sprintf("could not read %s export: %v", source, err)})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	plan, err := h.prepareImport(currentUser.ID, rows, mappings)
+	if err != nil {
+		h.logger.Printf("ERROR: preparing CSV import: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if r.FormValue("dry_run") == "true" {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"dry_run": true, "preview": plan})
+		return
+	}
+
+	// the whole file goes in one transaction, with the write hooks run
+	// once afterwards rather than per workout
+	for _, workout := range plan.Workouts {
+		workout.UserID = currentUser.ID
+	}
+
+	_, err = h.workoutStore.ImportWorkouts(plan.Workouts)
+	if err != nil {
+		h.logger.Printf("ERROR: importing workouts from CSV: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to import workouts"})
+		return
+	}
+
+	if len(plan.Workouts) > 0 {
+		err = h.workoutStore.RunWriteHooks(currentUser.ID)
+		if err != nil {
+			h.logger.Printf("ERROR: running write hooks after CSV import: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"dry_run": false, "imported": plan})
+}
+
+// HandleImportAppleHealth takes the export.xml from an Apple Health export,
+// optionally gzipped, as the request body. Workouts and body-mass samples
+// are created in batches as they are read; anything already imported is
+// skipped, so the same file can be uploaded again safely.
+func (h *ImportAPI) HandleImportAppleHealth(w http.ResponseWriter, r *http.Request) {
+	// exports run to hundreds of megabytes, well past the server timeouts
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Time{})
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Time{})
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: clearing deadlines for Apple Health import: %v", err)
+	}
+
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxAppleHealthFileBytes))
+	var xmlReader io.Reader = body
+	if magic, _ := body.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid gzip data"})
+			return
+		}
+		defer gz.Close()
+		xmlReader = gz
+	}
+
+	currentUser := middleware.GetUser(r)
+	var imported, skipped struct {
+		Workouts     int `json:"workouts"`
+		Measurements int `json:"measurements"`
+	}
+
+	// records are written in batches with the write hooks held back, then
+	// the hooks run once at the end; running them per record makes
+	// recomputing achievements and goals quadratic in the export size
+	var workouts []*store.Workout
+	var measurements []*store.Measurement
+	flushWorkouts := func() error {
+		if len(workouts) == 0 {
+			return nil
+		}
+		created, err := h.workoutStore.ImportWorkouts(workouts)
+		if err != nil {
+			return &storeError{err}
+		}
+		imported.Workouts += created
+		skipped.Workouts += len(workouts) - created
+		workouts = workouts[:0]
+		return nil
+	}
+	flushMeasurements := func() error {
+		if len(measurements) == 0 {
+			return nil
+		}
+		created, err := h.measurementStore.ImportMeasurements(measurements)
+		if err != nil {
+			return &storeError{err}
+		}
+		imported.Measurements += created
+		skipped.Measurements += len(measurements) - created
+		measurements = measurements[:0]
+		return nil
+	}
+
+	err = applehealth.Parse(xmlReader, applehealth.Handler{
+		Workout: func(aw *applehealth.Workout) error {
+			workouts = append(workouts, workoutFromAppleHealth(currentUser.ID, aw))
+			if len(workouts) < appleHealthBatchSize {
+				return nil
+			}
+			return flushWorkouts()
+		},
+		BodyMass: func(sample *applehealth.BodyMass) error {
+			kilograms := math.Round(sample.Kilograms*100) / 100
+			if kilograms <= 0 {
+				// measurements must be positive; devices do log zeros
+				skipped.Measurements++
+				return nil
+			}
+
+			measurements = append(measurements, &store.Measurement{
+				UserID:     currentUser.ID,
+				Kind:       store.MeasurementBodyWeight,
+				Value:      kilograms,
+				MeasuredAt: sample.MeasuredAt,
+				Source:     sourceAppleHealth,
+				SourceID:   sample.UUID,
+			})
+			if len(measurements) < appleHealthBatchSize {
+				return nil
+			}
+			return flushMeasurements()
+		},
+	})
+	if err == nil {
+		err = flushWorkouts()
+	}
+	if err == nil {
+		err = flushMeasurements()
+	}
+
+	// whatever was written, even before a failure, still needs the hooks
+	if imported.Workouts > 0 {
+		hookErr := h.workoutStore.RunWriteHooks(currentUser.ID)
+		if hookErr != nil && err == nil {
+			err = &storeError{hookErr}
+		}
+	}
+	if imported.Measurements > 0 {
+		hookErr := h.measurementStore.RunWriteHooks(currentUser.ID)
+		if hookErr != nil && err == nil {
+			err = &storeError{hookErr}
+		}
+	}
+
+	if err != nil {
+		h.logger.Printf("ERROR: importing Apple Health export: %v", err)
+
+		var storeErr *storeError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &storeErr):
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to import record", "imported": imported, "skipped": skipped})
+		case errors.As(err, &maxBytesErr):
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "file is too large", "imported": imported, "skipped": skipped})
+		default:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid Apple Health export", "imported": imported, "skipped": skipped})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"imported": imported, "skipped": skipped})
+}
+
+// storeError marks a failure writing to the database, as opposed to a
+// problem with the uploaded file.
+type storeError struct {
+	err error
+}
+
+func (e *storeError) Error() string { return e.err.Error() }
+
+func (e *storeError) Unwrap() error { return e.err }
+
+func workoutFromAppleHealth(userID int, aw *applehealth.Workout) *store.Workout {
+	seconds := int(math.Round(aw.Duration.Seconds()))
+
+	description := "Imported from Apple Health"
+	if aw.SourceName != "" {
+		description += " (" + aw.SourceName + ")"
+	}
+
+	return &store.Workout{
+		UserID:          userID,
+		Title:           aw.Title(),
+		Description:     description,
+		ActivityType:    appleHealthActivityTypes[strings.TrimPrefix(aw.ActivityType, "HKWorkoutActivityType")],
+		StartedAt:       aw.Start,
+		DurationMinutes: int(math.Round(aw.Duration.Minutes())),
+		CaloriesBurned:  int(math.Round(aw.Calories)),
+		DistanceMeters:  positiveFloat(math.Round(aw.DistanceMeters*100) / 100),
+		AvgHeartRate:    positiveInt(int(math.Round(aw.AvgHeartRate))),
+		MaxHeartRate:    positiveInt(int(math.Round(aw.MaxHeartRate))),
+		Source:          sourceAppleHealth,
+		SourceID:        aw.UUID,
+		Entries: []store.WorkoutEntry{{
+			ExerciseName:    aw.Title(),
+			Sets:            1,
+			DurationSeconds: &seconds,
+			DistanceMeters:  positiveFloat(math.Round(aw.DistanceMeters*100) / 100),
+			OrderIndex:      1,
+		}},
+	}
+}
+
+// appleHealthActivityTypes maps HealthKit activity types, without their
+// prefix, onto ours. Anything else is "other".
+var appleHealthActivityTypes = map[string]string{
+	"Running":                       store.ActivityRunning,
+	"Walking":                       store.ActivityWalking,
+	"Hiking":                        store.ActivityWalking,
+	"Cycling":                       store.ActivityCycling,
+	"Swimming":                      store.ActivitySwimming,
+	"Rowing":                        store.ActivityRowing,
+	"TraditionalStrengthTraining":   store.ActivityStrength,
+	"FunctionalStrengthTraining":    store.ActivityStrength,
+	"HighIntensityIntervalTraining": store.ActivityHIIT,
+	"CrossTraining":                 store.ActivityCrossFit,
+	"Yoga":                          store.ActivityYoga,
+	"Pilates":                       store.ActivityPilates,
+}
+
+// fitActivityTypes maps FIT sports onto activity types. Anything else is
+// "other".
+var fitActivityTypes = map[fit.Sport]string{
+	fit.SportRunning:  store.ActivityRunning,
+	fit.SportCycling:  store.ActivityCycling,
+	fit.SportSwimming: store.ActivitySwimming,
+	fit.SportWalking:  store.ActivityWalking,
+	fit.SportRowing:   store.ActivityRowing,
+	fit.SportHiking:   store.ActivityWalking,
+}
+
+func (h *ImportAPI) prepareImport(userID int, rows []importer.Row, mappings map[string]string) (*importer.Plan, error) {
+	known, err := h.workoutStore.GetExerciseNamesForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []store.WorkoutStart
+	if len(rows) > 0 {
+		from, to := rows[0].SessionStart, rows[0].SessionStart
+		for _, row := range rows {
+			if row.SessionStart.Before(from) {
+				from = row.SessionStart
+			}
+			if row.SessionStart.After(to) {
+				to = row.SessionStart
+			}
+		}
+
+		existing, err = h.workoutStore.GetWorkoutStarts(userID, from.Add(-time.Minute), to.Add(time.Minute))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return importer.Prepare(rows, importer.NewMapper(mappings, known), existing), nil
+}
+
+// workoutsFromFIT maps every session onto a workout. Strength sessions get
+// one entry per run of identical sets, everything else gets one entry per
+// lap carrying its duration and distance.
+func workoutsFromFIT(file *fit.File) []*store.Workout {
+	workouts := make([]*store.Workout, 0, len(file.Sessions))
+
+	for i := range file.Sessions {
+		session := &file.Sessions[i]
+		end := session.Timestamp
+		if len(file.Sessions) == 1 {
+			// a lone session owns every message in the file
+			end = time.Time{}
+		}
+
+		workout := &store.Workout{
+			Title:           session.Sport.String(),
+			Description:     "Imported from FIT file",
+			Source:          sourceFIT,
+			SourceID:        fitSourceID(file, session),
+			StartedAt:       session.StartTime,
+			DurationMinutes: int(math.Round(session.TotalTimerTime.Minutes())),
+			CaloriesBurned:  session.TotalCalories,
+			AvgHeartRate:    positiveInt(session.AvgHeartRate),
+			MaxHeartRate:    positiveInt(session.MaxHeartRate),
+			DistanceMeters:  positiveFloat(session.TotalDistance),
+		}
+
+		if workout.AvgHeartRate == nil || workout.MaxHeartRate == nil {
+			avgHR, maxHR := heartRateFromRecords(file.Records, session.StartTime, end)
+			if workout.AvgHeartRate == nil {
+				workout.AvgHeartRate = positiveInt(avgHR)
+			}
+			if workout.MaxHeartRate == nil {
+				workout.MaxHeartRate = positiveInt(maxHR)
+			}
+		}
+
+		sets := setsWithin(file.Sets, session.StartTime, end)
+		if session.IsStrength() || len(sets) > 0 {
+			workout.Title = "Strength Training"
+			workout.ActivityType = store.ActivityStrength
+			workout.Entries = entriesFromSets(sets)
+		} else {
+			workout.ActivityType = fitActivityTypes[session.Sport]
+			workout.Entries = entriesFromLaps(session, lapsWithin(file.Laps, session.StartTime, end))
+		}
+
+		workouts = append(workouts, workout)
+	}
+
+	return workouts
+}
+
+// fitSourceID identifies a session across uploads by the serial number of
+// the device that recorded it and its start time, which together stay the
+// same however the file is exported or renamed.
+func fitSourceID(file *fit.File, session *fit.Session) string {
+	var serial uint32
+	if file.FileID != nil {
+		serial = file.FileID.SerialNumber
+	}
+
+	start := session.StartTime
+	if start.IsZero() {
+		start = session.Timestamp
+	}
+	return fmt.Sprintf("%d-%d", serial, start.Unix())
+}
+
+func entriesFromSets(sets []fit.Set) []store.WorkoutEntry {
+	var entries []store.WorkoutEntry
+
+	for _, set := range sets {
+		if set.Type != fit.SetTypeActive {
+			continue
+		}
+
+		entry := store.WorkoutEntry{
+			ExerciseName: set.Category.String(),
+			Sets:         1,
+			Weight:       positiveFloat(set.Weight),
+			OrderIndex:   len(entries) + 1,
+		}
+		if set.Repetitions > 0 {
+			reps := set.Repetitions
+			entry.Reps = &reps
+		} else {
+			seconds := int(math.Round(set.Duration.Seconds()))
+			entry.DurationSeconds = &seconds
+		}
+
+		// consecutive identical sets collapse into one entry
+		if n := len(entries); n > 0 && sameSet(&entries[n-1], &entry) {
+			entries[n-1].Sets++
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func sameSet(a, b *store.WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		a.DurationSeconds == nil && b.DurationSeconds == nil &&
+		equalInt(a.Reps, b.Reps) &&
+		equalFloat(a.Weight, b.Weight)
+}
+
+func entriesFromLaps(session *fit.Session, laps []fit.Lap) []store.WorkoutEntry {
+	if len(laps) == 0 {
+		laps = []fit.Lap{{
+			TotalTimerTime: session.TotalTimerTime,
+			TotalDistance:  session.TotalDistance,
+			AvgHeartRate:   session.AvgHeartRate,
+			MaxHeartRate:   session.MaxHeartRate,
+		}}
+	}
+
+	entries := make([]store.WorkoutEntry, 0, len(laps))
+	for i, lap := range laps {
+		seconds := int(math.Round(lap.TotalTimerTime.Seconds()))
+
+		notes := fmt.Sprintf("Lap %d", i+1)
+		if lap.AvgHeartRate > 0 {
+			notes += fmt.Sprintf(", avg HR %d bpm, max HR %d bpm", lap.AvgHeartRate, lap.MaxHeartRate)
+		}
+
+		entries = append(entries, store.WorkoutEntry{
+			ExerciseName:    session.Sport.String(),
+			Sets:            1,
+			DurationSeconds: &seconds,
+			DistanceMeters:  positiveFloat(lap.TotalDistance),
+			Notes:           notes,
+			OrderIndex:      i + 1,
+		})
+	}
+
+	return entries
+}
+
+func heartRateFromRecords(records []fit.Record, start, end time.Time) (int, int) {
+	var sum, count, maxHR int
+	for _, record := range records {
+		if record.HeartRate == 0 || !within(record.Timestamp, start, end) {
+			continue
+		}
+
+		sum += record.HeartRate
+		count++
+		if record.HeartRate > maxHR {
+			maxHR = record.HeartRate
+		}
+	}
+
+	if count == 0 {
+		return 0, 0
+	}
+	return int(math.Round(float64(sum) / float64(count))), maxHR
+}
+
+// heartRateSeries turns the records of the n-th session into a series
+// offset from the session start, keeping the first reading of each second.
+func heartRateSeries(file *fit.File, n int) []heartrate.Sample {
+	session := &file.Sessions[n]
+	start, end := session.StartTime, session.Timestamp
+	if len(file.Sessions) == 1 {
+		end = time.Time{}
+	}
+
+	var samples []heartrate.Sample
+	for _, record := range file.Records {
+		if record.HeartRate == 0 || record.HeartRate >= 260 || !within(record.Timestamp, start, end) {
+			continue
+		}
+		if start.IsZero() {
+			start = record.Timestamp
+		}
+
+		offset := int(record.Timestamp.Sub(start).Seconds())
+		if offset < 0 || (len(samples) > 0 && offset <= samples[len(samples)-1].OffsetSeconds) {
+			continue
+		}
+		samples = append(samples, heartrate.Sample{OffsetSeconds: offset, BPM: record.HeartRate})
+	}
+
+	return samples
+}
+
+func setsWithin(sets []fit.Set, start, end time.Time) []fit.Set {
+	var result []fit.Set
+	for _, set := range sets {
+		if within(set.StartTime, start, end) {
+			result = append(result, set)
+		}
+	}
+	return result
+}
+
+func lapsWithin(laps []fit.Lap, start, end time.Time) []fit.Lap {
+	var result []fit.Lap
+	for _, lap := range laps {
+		if within(lap.StartTime, start, end) {
+			result = append(result, lap)
+		}
+	}
+	return result
+}
+
+// within reports whether t falls in [start, end]. A zero end leaves the
+// range open.
+func within(t, start, end time.Time) bool {
+	if end.IsZero() {
+		return true
+	}
+	return !t.Before(start) && !t.After(end)
+}
+
+func positiveInt(v int) *int {
+	if v <= 0 {
+		return nil
+	}
+	return &v
+}
+
+func positiveFloat(v float64) *float64 {
+	if v <= 0 {
+		return nil
+	}
+	return &v
+}
+
+func equalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/analytics"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	defaultMeasurementDays = 90
+	maxMeasurementDays     = 5 * 366
+	defaultTrendWindowDays = 7
+	maxTrendWindowDays     = 90
+)
+
+type MeasurementAPI struct {
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewMeasurementAPI(measurementStore store.MeasurementStore, logger *log.Logger) *MeasurementAPI {
+	return &MeasurementAPI{
+		measurementStore: measurementStore,
+		logger:           logger,
+	}
+}
+
+type measurementRequest struct {
+	Kind       *string    `json:"kind"`
+	Value      *float64   `json:"value"`
+	MeasuredAt *time.Time `json:"measured_at"`
+}
+
+// apply copies the fields that were sent onto m and validates the result.
+func (req *measurementRequest) apply(m *store.Measurement) error {
+	if req.Kind != nil {
+		m.Kind = *req.Kind
+	}
+	if req.Value != nil {
+		m.Value = *req.Value
+	}
+	if req.MeasuredAt != nil {
+		m.MeasuredAt = *req.MeasuredAt
+	}
+
+	if !store.ValidMeasurementKind(m.Kind) {
+		return errors.New("kind must be one of body_weight, body_fat, waist, chest, arms, thighs")
+	}
+	if m.Value <= 0 {
+		return errors.New("value must be positive")
+	}
+	if m.Kind == store.MeasurementBodyFat && m.Value >= 100 {
+		return errors.New("body_fat is a percentage below 100")
+	}
+	if m.MeasuredAt.After(time.Now().Add(time.Hour)) {
+		return errors.New("measured_at must not be in the future")
+	}
+	return nil
+}
+
+func (h *MeasurementAPI) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	var req measurementRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	m := &store.Measurement{UserID: currentUser.ID, MeasuredAt: time.Now()}
+	err = req.apply(m)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = h.measurementStore.CreateMeasurement(m)
+	if err != nil {
+		h.logger.Printf("ERROR: creating measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"measurement": m})
+}
+
+// HandleGetMeasurements lists the caller's measurements, oldest first,
+// optionally filtered by ?kind= and limited to ?days= back (90 by default).
+func (h *MeasurementAPI) HandleGetMeasurements(w http.ResponseWriter, r *http.Request) {
+	kind, from, ok := h.readRange(w, r, false)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	measurements, err := h.measurementStore.GetMeasurementsForUser(currentUser.ID, kind, from, time.Now().Add(time.Hour))
+	if err != nil {
+		h.logger.Printf("ERROR: getting measurements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurements": measurements})
+}
+
+func (h *MeasurementAPI) HandleGetMeasurementByID(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.ownMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": m})
+}
+
+func (h *MeasurementAPI) HandleUpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.ownMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	var req measurementRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	err = req.apply(m)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = h.measurementStore.UpdateMeasurement(m)
+	if err != nil {
+		h.logger.Printf("ERROR: updating measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": m})
+}
+
+func (h *MeasurementAPI) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.ownMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.measurementStore.DeleteMeasurement(m.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting measurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetTrend returns one ?kind= of measurement over the last ?days=
+// with a trailing moving average over ?window= days (7 by default), plus
+// the change in the average across the period.
+func (h *MeasurementAPI) HandleGetTrend(w http.ResponseWriter, r *http.Request) {
+	kind, from, ok := h.readRange(w, r, true)
+	if !ok {
+		return
+	}
+
+	window, err := utils.ReadQueryInt(r, "window", defaultTrendWindowDays)
+	if err != nil || window < 1 || window > maxTrendWindowDays {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "window must be between 1 and 90 days"})
+		return
+	}
+
+	// load a window's worth of earlier data so the first averages in the
+	// range aren't based on a single value
+	currentUser := middleware.GetUser(r)
+	measurements, err := h.measurementStore.GetMeasurementsForUser(currentUser.ID, kind, from.AddDate(0, 0, -window), time.Now().Add(time.Hour))
+	if err != nil {
+		h.logger.Printf("ERROR: getting measurements for trend: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	points := analytics.Trend(measurements, time.Duration(window)*24*time.Hour)
+	for len(points) > 0 && points[0].MeasuredAt.Before(from) {
+		points = points[1:]
+	}
+
+	var change *float64
+	if len(points) > 1 {
+		c := points[len(points)-1].Average - points[0].Average
+		change = &c
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"kind":        kind,
+		"unit":        store.MeasurementUnits[kind],
+		"window_days": window,
+		"points":      points,
+		"change":      change,
+	})
+}
+
+// readRange reads ?kind= and ?days= and returns the start of the range,
+// writing an error response when either is invalid.
+func (h *MeasurementAPI) readRange(w http.ResponseWriter, r *http.Request, kindRequired bool) (string, time.Time, bool) {
+	kind := r.URL.Query().Get("kind")
+	if (kind != "" || kindRequired) && !store.ValidMeasurementKind(kind) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be one of body_weight, body_fat, waist, chest, arms, thighs"})
+		return "", time.Time{}, false
+	}
+
+	days, err := utils.ReadQueryInt(r, "days", defaultMeasurementDays)
+	if err != nil || days < 1 || days > maxMeasurementDays {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "days must be between 1 and 1830"})
+		return "", time.Time{}, false
+	}
+
+	return kind, time.Now().AddDate(0, 0, -days), true
+}
+
+// ownMeasurement loads the measurement named by {id}, writing an error
+// response unless it exists and belongs to the current user.
+func (h *MeasurementAPI) ownMeasurement(w http.ResponseWriter, r *http.Request) (*store.Measurement, bool) {
+	measurementID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid measurement ID"})
+		return nil, false
+	}
+
+	m, err := h.measurementStore.GetMeasurementByID(measurementID)
+	if err != nil {
+		h.logger.Printf("ERROR: getMeasurementByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if m == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement does not exist"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if m.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to access this measurement"})
+		return nil, false
+	}
+
+	return m, true
+}
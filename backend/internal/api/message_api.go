@@ -0,0 +1,314 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/strangecousinwst/goworkout/internal/authz"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/ratelimit"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	maxMessageLength     = 4000
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 200
+)
+
+type MessageAPI struct {
+	messageStore store.MessageStore
+	workoutStore store.WorkoutStore
+	authz        *authz.Checker
+	limiter      *ratelimit.Limiter
+	logger       *log.Logger
+}
+
+func NewMessageAPI(messageStore store.MessageStore, workoutStore store.WorkoutStore, checker *authz.Checker, logger *log.Logger) *MessageAPI {
+	return &MessageAPI{
+		messageStore: messageStore,
+		workoutStore: workoutStore,
+		authz:        checker,
+		limiter:      ratelimit.New(30, time.Minute),
+		logger:       logger,
+	}
+}
+
+// HandleGetThreads lists the caller's threads with unread counts.
+func (h *MessageAPI) HandleGetThreads(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	threads, err := h.messageStore.GetThreadsForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting threads: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"threads": threads})
+}
+
+// HandleGetUnreadCount counts the caller's unread messages across threads.
+func (h *MessageAPI) HandleGetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	count, err := h.messageStore.CountUnread(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: counting unread messages: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"unread_count": count})
+}
+
+// HandleCreateThread opens the thread with user_id about the optional
+// workout_id and entry_id, reusing the existing one with the same anchor,
+// and posts body to it when given.
+func (h *MessageAPI) HandleCreateThread(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID    int    `json:"user_id"`
+		WorkoutID *int   `json:"workout_id"`
+		EntryID   *int   `json:"entry_id"`
+		Body      string `json:"body"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if !h.authorizeMessaging(w, currentUser, req.UserID) {
+		return
+	}
+
+	if req.EntryID != nil && req.WorkoutID == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "entry_id needs the workout_id it belongs to"})
+		return
+	}
+	if req.WorkoutID != nil && !h.validAnchor(w, currentUser, req.UserID, *req.WorkoutID, req.EntryID) {
+		return
+	}
+
+	thread := &store.Thread{
+		UserIDs:   [2]int{currentUser.ID, req.UserID},
+		WorkoutID: req.WorkoutID,
+		EntryID:   req.EntryID,
+	}
+	err = h.messageStore.FindOrCreateThread(thread)
+	if err != nil {
+		h.logger.Printf("ERROR: creating thread: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if strings.TrimSpace(req.Body) == "" {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"thread": thread})
+		return
+	}
+
+	message, ok := h.postMessage(w, currentUser, thread.ID, req.Body)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"thread": thread, "message": message})
+}
+
+// validAnchor checks that a thread may be about the workout: it belongs to
+// one of the two users and the caller can see it. The entry, if any, must
+// be part of it.
+func (h *MessageAPI) validAnchor(w http.ResponseWriter, user *store.User, otherID, workoutID int, entryID *int) bool {
+	if !authorizeWorkout(w, h.authz, h.logger, user, workoutID, authz.View) {
+		return false
+	}
+
+	workout, err := h.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil || workout == nil {
+		h.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if workout.UserID != user.ID && workout.UserID != otherID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "threads can only be about your own or the other user's workouts"})
+		return false
+	}
+
+	if entryID == nil {
+		return true
+	}
+	found := false
+	workout.EachEntry(func(entry *store.WorkoutEntry, _ *store.EntryGroup) {
+		found = found || entry.ID == *entryID
+	})
+	if !found {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "entry is not part of the workout"})
+		return false
+	}
+	return true
+}
+
+// HandleGetThread returns thread {id} with a page of its messages, newest
+// first. Pass the returned next_cursor as ?cursor= for older messages; it
+// is null on the last page.
+func (h *MessageAPI) HandleGetThread(w http.ResponseWriter, r *http.Request) {
+	thread, ok := h.participantThread(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := utils.ReadQueryInt(r, "limit", defaultMessagesLimit)
+	if err != nil || limit < 1 || limit > maxMessagesLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 200"})
+		return
+	}
+	before, err := utils.ReadQueryInt(r, "cursor", 0)
+	if err != nil || before < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid cursor"})
+		return
+	}
+
+	// one extra row tells us whether there is another page
+	messages, err := h.messageStore.GetMessages(thread.ID, before, limit+1)
+	if err != nil {
+		h.logger.Printf("ERROR: getting messages: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	var next *string
+	if len(messages) > limit {
+		messages = messages[:limit]
+		cursor := strconv.Itoa(messages[limit-1].ID)
+		next = &cursor
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"thread": thread, "messages": messages, "next_cursor": next})
+}
+
+// HandleSendMessage posts a message to thread {id}.
+func (h *MessageAPI) HandleSendMessage(w http.ResponseWriter, r *http.Request) {
+	thread, ok := h.participantThread(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	message, ok := h.postMessage(w, middleware.GetUser(r), thread.ID, req.Body)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": message})
+}
+
+func (h *MessageAPI) postMessage(w http.ResponseWriter, sender *store.User, threadID int, body string) (*store.Message, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body is required"})
+		return nil, false
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body must be at most 4000 characters"})
+		return nil, false
+	}
+	if !allowRate(w, h.limiter, sender.ID) {
+		return nil, false
+	}
+
+	message := &store.Message{ThreadID: threadID, SenderID: sender.ID, Body: body}
+	err := h.messageStore.CreateMessage(message)
+	if err != nil {
+		h.logger.Printf("ERROR: creating message: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return message, true
+}
+
+// HandleMarkRead marks thread {id} read up to message_id, or entirely
+// when it is omitted.
+func (h *MessageAPI) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	thread, ok := h.participantThread(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MessageID int `json:"message_id"`
+	}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.MessageID < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+	err := h.messageStore.MarkRead(thread.ID, currentUser.ID, req.MessageID)
+	if err != nil {
+		h.logger.Printf("ERROR: marking thread read: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// participantThread loads thread {id}, writing an error response unless
+// the caller takes part in it and may still message the other user, so a
+// coach whose grant was revoked can no longer read the thread either.
+// Threads of others are reported as missing.
+func (h *MessageAPI) participantThread(w http.ResponseWriter, r *http.Request) (*store.Thread, bool) {
+	threadID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid thread ID"})
+		return nil, false
+	}
+
+	thread, err := h.messageStore.GetThreadByID(threadID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting thread: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	currentUser := middleware.GetUser(r)
+	if thread == nil || !thread.HasParticipant(currentUser.ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "thread does not exist"})
+		return nil, false
+	}
+	if !h.authorizeMessaging(w, currentUser, thread.Other(currentUser.ID)) {
+		return nil, false
+	}
+
+	return thread, true
+}
+
+func (h *MessageAPI) authorizeMessaging(w http.ResponseWriter, user *store.User, otherID int) bool {
+	err := h.authz.Messaging(user, otherID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authz.ErrNotRelated):
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+	default:
+		h.logger.Printf("ERROR: authorizing messaging: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	return false
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+	"github.com/strangecousinwst/goworkout/internal/week"
+)
+
+const (
+	leaderboardWeek  = "week"
+	leaderboardMonth = "month"
+	leaderboardAll   = "all"
+)
+
+type OrgAPI struct {
+	orgStore    store.OrgStore
+	socialStore store.SocialStore
+	logger      *log.Logger
+}
+
+func NewOrgAPI(orgStore store.OrgStore, socialStore store.SocialStore, logger *log.Logger) *OrgAPI {
+	return &OrgAPI{
+		orgStore:    orgStore,
+		socialStore: socialStore,
+		logger:      logger,
+	}
+}
+
+func validOrgRole(role string) bool {
+	return role == store.OrgRoleOwner || role == store.OrgRoleCoach || role == store.OrgRoleMember
+}
+
+// HandleCreateOrg creates an organization owned by the caller.
+func (h *OrgAPI) HandleCreateOrg(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		Timezone string `json:"timezone"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required and at most 255 characters"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if req.Timezone == "" {
+		req.Timezone = currentUser.Timezone
+	}
+	// "Local" would mean the server's zone
+	_, err = time.LoadLocation(req.Timezone)
+	if req.Timezone == "Local" || err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "timezone must be an IANA zone like Europe/Lisbon"})
+		return
+	}
+
+	org := &store.Organization{Name: req.Name, Timezone: req.Timezone}
+	err = h.orgStore.CreateOrg(org, currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: creating organization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"organization": store.UserOrganization{Organization: *org, Role: store.OrgRoleOwner}})
+}
+
+// HandleGetOrgs lists the organizations the caller belongs to.
+func (h *OrgAPI) HandleGetOrgs(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	orgs, err := h.orgStore.GetOrgsForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting organizations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organizations": orgs})
+}
+
+// HandleGetOrg returns organization {id} with the caller's membership.
+func (h *OrgAPI) HandleGetOrg(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	org, ok := h.loadOrg(w, membership.OrgID)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organization": org, "membership": membership})
+}
+
+func (h *OrgAPI) HandleGetMembers(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	members, err := h.orgStore.GetMembers(membership.OrgID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting members: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"members": members})
+}
+
+// HandleAddMember adds a user to the organization. Owners and coaches add
+// members; only owners add coaches and owners.
+func (h *OrgAPI) HandleAddMember(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = store.OrgRoleMember
+	}
+	if !validOrgRole(req.Role) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "role must be owner, coach or member"})
+		return
+	}
+
+	if !membership.CanManage() || (req.Role != store.OrgRoleMember && membership.Role != store.OrgRoleOwner) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to add this member"})
+		return
+	}
+
+	user, err := h.socialStore.GetUserSummary(req.UserID)
+	if err != nil {
+		h.logger.Printf("ERROR: getUserSummary: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "user does not exist"})
+		return
+	}
+
+	err = h.orgStore.AddMember(membership.OrgID, req.UserID, req.Role)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "user is already a member"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: adding member: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateMemberRole changes a member's role; only owners may, and an
+// organization always keeps at least one owner.
+func (h *OrgAPI) HandleUpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	userID, ok := readMemberParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || !validOrgRole(req.Role) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "role must be owner, coach or member"})
+		return
+	}
+
+	if membership.Role != store.OrgRoleOwner {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only owners can change roles"})
+		return
+	}
+
+	target, ok := h.loadMember(w, membership.OrgID, userID)
+	if !ok {
+		return
+	}
+	if target.Role == store.OrgRoleOwner && req.Role != store.OrgRoleOwner && !h.hasOtherOwner(w, membership.OrgID) {
+		return
+	}
+
+	err = h.orgStore.UpdateMemberRole(membership.OrgID, userID, req.Role)
+	if err != nil {
+		h.logger.Printf("ERROR: updating member role: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRemoveMember removes a member. Anyone may leave; owners remove
+// anyone, coaches remove plain members. The last owner can't go.
+func (h *OrgAPI) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	userID, ok := readMemberParam(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := h.loadMember(w, membership.OrgID, userID)
+	if !ok {
+		return
+	}
+
+	allowed := userID == membership.UserID ||
+		membership.Role == store.OrgRoleOwner ||
+		(membership.Role == store.OrgRoleCoach && target.Role == store.OrgRoleMember)
+	if !allowed {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to remove this member"})
+		return
+	}
+	if target.Role == store.OrgRoleOwner && !h.hasOtherOwner(w, membership.OrgID) {
+		return
+	}
+
+	err := h.orgStore.RemoveMember(membership.OrgID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Printf("ERROR: removing member: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateLeaderboardOptIn puts the caller on or takes them off the
+// organization's leaderboards.
+func (h *OrgAPI) HandleUpdateLeaderboardOptIn(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+
+	var req struct {
+		OnLeaderboard *bool `json:"on_leaderboard"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.OnLeaderboard == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "on_leaderboard must be true or false"})
+		return
+	}
+
+	err = h.orgStore.SetOnLeaderboard(membership.OrgID, membership.UserID, *req.OnLeaderboard)
+	if err != nil {
+		h.logger.Printf("ERROR: updating leaderboard opt-in: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	updated := *membership
+	updated.OnLeaderboard = *req.OnLeaderboard
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"membership": updated})
+}
+
+// leaderboardEntry is a ranked leaderboard row; tied scores share a rank.
+type leaderboardEntry struct {
+	Rank int `json:"rank"`
+	store.LeaderboardRow
+}
+
+// HandleGetLeaderboard ranks the organization's opted-in members by
+// ?metric= (volume, workouts or lift, which needs ?exercise=) over
+// ?period= (week, month or all) containing ?date=, today by default.
+// Weeks and months follow the organization's timezone.
+func (h *OrgAPI) HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	membership := middleware.GetMembership(r)
+	query := r.URL.Query()
+
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = store.LeaderboardVolume
+	}
+	if !store.ValidLeaderboardMetric(metric) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "metric must be volume, workouts or lift"})
+		return
+	}
+	exercise := strings.TrimSpace(query.Get("exercise"))
+	if metric == store.LeaderboardLift && exercise == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "lift leaderboards need an exercise"})
+		return
+	}
+
+	org, ok := h.loadOrg(w, membership.OrgID)
+	if !ok {
+		return
+	}
+	loc := org.Location()
+
+	date := time.Now().In(loc)
+	if value := query.Get("date"); value != "" {
+		var err error
+		date, err = time.ParseInLocation(store.DateLayout, value, loc)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "date must look like 2025-06-02"})
+			return
+		}
+	}
+
+	period := query.Get("period")
+	var from, to time.Time
+	switch period {
+	case "", leaderboardWeek:
+		period = leaderboardWeek
+		from = week.Start(date, loc)
+		to = from.AddDate(0, 0, 7)
+	case leaderboardMonth:
+		from = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, loc)
+		to = from.AddDate(0, 1, 0)
+	case leaderboardAll:
+		from = time.Unix(0, 0)
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "period must be week, month or all"})
+		return
+	}
+
+	rows, err := h.orgStore.GetLeaderboard(membership.OrgID, metric, exercise, from, to)
+	if err != nil {
+		h.logger.Printf("ERROR: getting leaderboard: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ranked := make([]leaderboardEntry, len(rows))
+	for i, row := range rows {
+		rank := i + 1
+		if i > 0 && row.Value == rows[i-1].Value {
+			rank = ranked[i-1].Rank
+		}
+		ranked[i] = leaderboardEntry{Rank: rank, LeaderboardRow: row}
+	}
+
+	envelope := utils.Envelope{
+		"metric":      metric,
+		"period":      period,
+		"leaderboard": ranked,
+	}
+	if metric == store.LeaderboardLift {
+		envelope["exercise"] = exercise
+	}
+	if period != leaderboardAll {
+		envelope["from"] = from
+		envelope["to"] = to
+	}
+	utils.WriteJSON(w, http.StatusOK, envelope)
+}
+
+func (h *OrgAPI) loadOrg(w http.ResponseWriter, orgID int) (*store.Organization, bool) {
+	org, err := h.orgStore.GetOrgByID(orgID)
+	if err != nil || org == nil {
+		h.logger.Printf("ERROR: getting organization %d: %v", orgID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return org, true
+}
+
+func (h *OrgAPI) loadMember(w http.ResponseWriter, orgID, userID int) (*store.Membership, bool) {
+	member, err := h.orgStore.GetMembership(orgID, userID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting membership: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if member == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member does not exist"})
+		return nil, false
+	}
+	return member, true
+}
+
+// hasOtherOwner checks that an owner can step down without leaving the
+// organization ownerless, writing the error response when not.
+func (h *OrgAPI) hasOtherOwner(w http.ResponseWriter, orgID int) bool {
+	owners, err := h.orgStore.CountOwners(orgID)
+	if err != nil {
+		h.logger.Printf("ERROR: counting owners: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if owners < 2 {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "an organization needs at least one owner"})
+		return false
+	}
+	return true
+}
+
+func readMemberParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return 0, false
+	}
+	return userID, true
+}
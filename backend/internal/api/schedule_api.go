@@ -0,0 +1,428 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/strangecousinwst/goworkout/internal/authz"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/rrule"
+	"github.com/strangecousinwst/goworkout/internal/schedule"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	defaultScheduleDays = 28
+	maxScheduleDays     = 366
+)
+
+type ScheduleAPI struct {
+	scheduleStore store.ScheduleStore
+	workoutStore  store.WorkoutStore
+	authz         *authz.Checker
+	logger        *log.Logger
+}
+
+func NewScheduleAPI(scheduleStore store.ScheduleStore, workoutStore store.WorkoutStore, checker *authz.Checker, logger *log.Logger) *ScheduleAPI {
+	return &ScheduleAPI{
+		scheduleStore: scheduleStore,
+		workoutStore:  workoutStore,
+		authz:         checker,
+		logger:        logger,
+	}
+}
+
+// scheduleResponse adds the local start time, which store.Schedule keeps
+// as a zone-less time.Time.
+type scheduleResponse struct {
+	*store.Schedule
+	Start string `json:"start"`
+}
+
+func newScheduleResponse(s *store.Schedule) scheduleResponse {
+	if s.Exceptions == nil {
+		s.Exceptions = []store.ScheduleException{}
+	}
+	return scheduleResponse{Schedule: s, Start: s.StartsAt.Format(store.LocalDateTimeLayout)}
+}
+
+type createScheduleRequest struct {
+	Title             string `json:"title"`
+	Description       string `json:"description"`
+	TemplateWorkoutID *int   `json:"template_workout_id"`
+	// Start is the local time of the first occurrence, e.g.
+	// "2025-06-02T07:00", in the user's timezone.
+	Start           string `json:"start"`
+	DurationMinutes int    `json:"duration_minutes"`
+	RRule           string `json:"rrule"`
+	// UserID assigns the schedule to an athlete the caller coaches with
+	// assign access.
+	UserID *int `json:"user_id"`
+}
+
+// HandleCreateSchedule creates a recurring schedule, optionally based on one
+// of the user's workouts as a template. Coaches assign schedules to their
+// athletes the same way, basing them on any workout they can see.
+func (h *ScheduleAPI) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req createScheduleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decoding create schedule request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	userID := currentUser.ID
+	templateAccess := authz.Own
+	if req.UserID != nil && *req.UserID != currentUser.ID {
+		err = h.authz.Athlete(currentUser, *req.UserID, store.PermissionAssign)
+		if errors.Is(err, authz.ErrNoGrant) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			h.logger.Printf("ERROR: authorizing schedule assignment: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		userID = *req.UserID
+		templateAccess = authz.View
+	}
+
+	start, err := time.Parse(store.LocalDateTimeLayout, req.Start)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start must be a local time like 2025-06-02T07:00"})
+		return
+	}
+
+	rule, err := rrule.Parse(req.RRule)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if req.DurationMinutes < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "duration_minutes must not be negative"})
+		return
+	}
+
+	if req.TemplateWorkoutID != nil {
+		err := h.authz.Workout(currentUser, *req.TemplateWorkoutID, templateAccess)
+		if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "template workout does not exist"})
+			return
+		}
+		if err != nil {
+			h.logger.Printf("ERROR: authorizing template workout: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		template, err := h.workoutStore.GetWorkoutByID(*req.TemplateWorkoutID)
+		if err != nil || template == nil {
+			h.logger.Printf("ERROR: getWorkoutByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if req.Title == "" {
+			req.Title = template.Title
+		}
+		if req.Description == "" {
+			req.Description = template.Description
+		}
+		if req.DurationMinutes == 0 {
+			req.DurationMinutes = template.DurationMinutes
+		}
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "title is required"})
+		return
+	}
+
+	s := &store.Schedule{
+		UserID:            userID,
+		TemplateWorkoutID: req.TemplateWorkoutID,
+		Title:             req.Title,
+		Description:       req.Description,
+		StartsAt:          start,
+		DurationMinutes:   req.DurationMinutes,
+		RRule:             rule.String(),
+	}
+	if userID != currentUser.ID {
+		s.CreatedBy = &currentUser.ID
+	}
+
+	err = h.scheduleStore.CreateSchedule(s)
+	if err != nil {
+		h.logger.Printf("ERROR: createSchedule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create schedule"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"schedule": newScheduleResponse(s)})
+}
+
+func (h *ScheduleAPI) HandleGetSchedules(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	schedules, err := h.scheduleStore.GetSchedulesForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getSchedulesForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response := make([]scheduleResponse, len(schedules))
+	for i := range schedules {
+		response[i] = newScheduleResponse(&schedules[i])
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"schedules": response})
+}
+
+func (h *ScheduleAPI) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.ownSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.scheduleStore.DeleteSchedule(s.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: deleteSchedule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete schedule"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetOccurrences returns planned sessions between ?from= and ?to=
+// (local dates, both inclusive; the next four weeks by default), each
+// matched to the workout that fulfilled it, if any.
+func (h *ScheduleAPI) HandleGetOccurrences(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	loc := currentUser.Location()
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, defaultScheduleDays)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.ParseInLocation(store.DateLayout, value, loc)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be a date like 2025-06-02"})
+			return
+		}
+		if r.URL.Query().Get("to") == "" {
+			to = from.AddDate(0, 0, defaultScheduleDays)
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.ParseInLocation(store.DateLayout, value, loc)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "to must be a date like 2025-06-02"})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !to.After(from) || to.After(from.AddDate(0, 0, maxScheduleDays)) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "to must be after from and at most a year later"})
+		return
+	}
+
+	occurrences, err := loadOccurrences(h.scheduleStore, currentUser, from, to)
+	if err != nil {
+		h.logger.Printf("ERROR: expanding schedule: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"timezone": loc.String(), "occurrences": occurrences})
+}
+
+// loadOccurrences expands all of the user's schedules over [from, to) and
+// matches them to logged workouts.
+func loadOccurrences(scheduleStore store.ScheduleStore, user *store.User, from, to time.Time) ([]schedule.Occurrence, error) {
+	schedules, err := scheduleStore.GetSchedulesForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := user.Location()
+	occurrences := schedule.Expand(schedules, loc, from, to)
+	if len(occurrences) == 0 {
+		return []schedule.Occurrence{}, nil
+	}
+
+	// a workout can only match an occurrence on the same local day
+	first := occurrences[0].Start
+	last := occurrences[len(occurrences)-1].Start
+	dayFrom := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	dayTo := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, loc)
+
+	workouts, err := scheduleStore.GetLoggedWorkoutsBetween(user.ID, dayFrom, dayTo)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Match(occurrences, workouts, loc, time.Now())
+	return occurrences, nil
+}
+
+// HandleSkipOccurrence skips the occurrence originally planned for {date}.
+func (h *ScheduleAPI) HandleSkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	s, date, ok := h.ownOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	exception := &store.ScheduleException{
+		ScheduleID:     s.ID,
+		OccurrenceDate: date,
+		Status:         store.ExceptionSkipped,
+	}
+
+	err := h.scheduleStore.SetScheduleException(exception)
+	if err != nil {
+		h.logger.Printf("ERROR: setScheduleException: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exception": exception})
+}
+
+// HandleRescheduleOccurrence moves the occurrence originally planned for
+// {date} to a new local time given as {"start": "2025-06-03T18:00"}.
+func (h *ScheduleAPI) HandleRescheduleOccurrence(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Start string `json:"start"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decoding reschedule request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	s, date, ok := h.ownOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	start, err := time.ParseInLocation(store.LocalDateTimeLayout, req.Start, currentUser.Location())
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start must be a local time like 2025-06-03T18:00"})
+		return
+	}
+
+	exception := &store.ScheduleException{
+		ScheduleID:     s.ID,
+		OccurrenceDate: date,
+		Status:         store.ExceptionRescheduled,
+		RescheduledTo:  &start,
+	}
+
+	err = h.scheduleStore.SetScheduleException(exception)
+	if err != nil {
+		h.logger.Printf("ERROR: setScheduleException: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exception": exception})
+}
+
+// HandleRestoreOccurrence undoes a skip or reschedule.
+func (h *ScheduleAPI) HandleRestoreOccurrence(w http.ResponseWriter, r *http.Request) {
+	s, date, ok := h.ownOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.scheduleStore.DeleteScheduleException(s.ID, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "occurrence was not skipped or rescheduled"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleteScheduleException: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownSchedule loads the schedule named by {id}, writing an error response
+// unless it exists and belongs to the current user.
+func (h *ScheduleAPI) ownSchedule(w http.ResponseWriter, r *http.Request) (*store.Schedule, bool) {
+	scheduleID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid schedule ID"})
+		return nil, false
+	}
+
+	s, err := h.scheduleStore.GetScheduleByID(scheduleID)
+	if err != nil {
+		h.logger.Printf("ERROR: getScheduleByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if s == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "schedule does not exist"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if s.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to change this schedule"})
+		return nil, false
+	}
+
+	return s, true
+}
+
+// ownOccurrence is ownSchedule plus a check that {date} is a date the
+// schedule actually has an occurrence on.
+func (h *ScheduleAPI) ownOccurrence(w http.ResponseWriter, r *http.Request) (*store.Schedule, string, bool) {
+	s, ok := h.ownSchedule(w, r)
+	if !ok {
+		return nil, "", false
+	}
+
+	date, err := time.Parse(store.DateLayout, chi.URLParam(r, "date"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "date must look like 2025-06-02"})
+		return nil, "", false
+	}
+
+	rule, err := rrule.Parse(s.RRule)
+	if err != nil {
+		h.logger.Printf("ERROR: parsing stored rrule of schedule %d: %v", s.ID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, "", false
+	}
+
+	if !schedule.IsOccurrence(s, rule, date, middleware.GetUser(r).Location()) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "schedule has no occurrence on that date"})
+		return nil, "", false
+	}
+
+	return s, date.Format(store.DateLayout), true
+}
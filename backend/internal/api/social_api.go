@@ -0,0 +1,250 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/strangecousinwst/goworkout/internal/feed"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+type SocialAPI struct {
+	socialStore store.SocialStore
+	logger      *log.Logger
+}
+
+func NewSocialAPI(socialStore store.SocialStore, logger *log.Logger) *SocialAPI {
+	return &SocialAPI{
+		socialStore: socialStore,
+		logger:      logger,
+	}
+}
+
+// HandleFollow follows the user {id}. Private accounts get a pending
+// request instead, reported in the response status.
+func (h *SocialAPI) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	followee, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if followee.ID == currentUser.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't follow yourself"})
+		return
+	}
+
+	status, err := h.socialStore.Follow(currentUser.ID, followee.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: following user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"follow": store.Follow{User: *followee, Status: status}})
+}
+
+// HandleUnfollow stops following {id} or withdraws a pending request.
+func (h *SocialAPI) HandleUnfollow(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.socialStore.Unfollow(currentUser.ID, followeeID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you don't follow this user"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: unfollowing user: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SocialAPI) HandleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.writeFollowers(w, r, store.FollowAccepted, "followers")
+}
+
+// HandleGetFollowRequests lists pending requests to follow the caller.
+func (h *SocialAPI) HandleGetFollowRequests(w http.ResponseWriter, r *http.Request) {
+	h.writeFollowers(w, r, store.FollowPending, "requests")
+}
+
+func (h *SocialAPI) writeFollowers(w http.ResponseWriter, r *http.Request, status, key string) {
+	currentUser := middleware.GetUser(r)
+
+	follows, err := h.socialStore.GetFollowers(currentUser.ID, status)
+	if err != nil {
+		h.logger.Printf("ERROR: getting followers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{key: follows})
+}
+
+func (h *SocialAPI) HandleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	follows, err := h.socialStore.GetFollowing(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting following: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"following": follows})
+}
+
+// HandleApproveFollowRequest accepts user {id}'s request to follow the
+// caller.
+func (h *SocialAPI) HandleApproveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.socialStore.AcceptFollow(followerID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follow request does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: accepting follow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRemoveFollower rejects a pending request from user {id} or removes
+// them as a follower.
+func (h *SocialAPI) HandleRemoveFollower(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.socialStore.Unfollow(followerID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "this user doesn't follow you"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: removing follower: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdatePrivacy makes the caller's account private or public.
+func (h *SocialAPI) HandleUpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IsPrivate *bool `json:"is_private"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.IsPrivate == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "is_private must be true or false"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.socialStore.SetPrivate(currentUser.ID, *req.IsPrivate)
+	if err != nil {
+		h.logger.Printf("ERROR: updating privacy: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user := *currentUser
+	user.IsPrivate = *req.IsPrivate
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleGetFeed returns recent workouts of the users the caller follows,
+// newest first. Pass the returned next_cursor as ?cursor= for the next
+// page; it is null on the last one.
+func (h *SocialAPI) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.ReadQueryInt(r, "limit", defaultFeedLimit)
+	if err != nil || limit < 1 || limit > maxFeedLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	var after *store.FeedCursor
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		after, err = feed.DecodeCursor(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	currentUser := middleware.GetUser(r)
+	// one extra row tells us whether there is another page
+	workouts, err := h.socialStore.GetFeed(currentUser.ID, after, limit+1)
+	if err != nil {
+		h.logger.Printf("ERROR: getting feed: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	var next *string
+	if len(workouts) > limit {
+		workouts = workouts[:limit]
+		cursor := feed.EncodeCursor(&workouts[limit-1].Workout)
+		next = &cursor
+	}
+
+	items := make([]feed.Item, len(workouts))
+	for i := range workouts {
+		items[i] = feed.NewItem(&workouts[i])
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"items": items, "next_cursor": next})
+}
+
+// readUser loads the user named by {id}, writing an error response when
+// there is none.
+func (h *SocialAPI) readUser(w http.ResponseWriter, r *http.Request) (*store.UserSummary, bool) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user ID"})
+		return nil, false
+	}
+
+	user, err := h.socialStore.GetUserSummary(userID)
+	if err != nil {
+		h.logger.Printf("ERROR: getUserSummary: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user does not exist"})
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/utils"
+)
+
+type TagAPI struct {
+	tagStore store.TagStore
+	logger   *log.Logger
+}
+
+func NewTagAPI(tagStore store.TagStore, logger *log.Logger) *TagAPI {
+	return &TagAPI{
+		tagStore: tagStore,
+		logger:   logger,
+	}
+}
+
+// HandleGetTags lists the caller's tags with how many workouts carry each.
+func (h *TagAPI) HandleGetTags(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	tags, err := h.tagStore.GetTagsForUser(currentUser.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting tags: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tags": tags})
+}
+
+// HandleRenameTag renames tag {id} on every workout carrying it. Renaming
+// onto another existing tag is a conflict; merge them instead.
+func (h *TagAPI) HandleRenameTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.ownTag(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	name, err := normalizeTagName(req.Name)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.tagStore.GetTagByName(tag.UserID, name)
+	if err != nil {
+		h.logger.Printf("ERROR: getTagByName: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if existing != nil && existing.ID != tag.ID {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "a tag with this name already exists; merge the tags instead", "tag": existing})
+		return
+	}
+
+	err = h.tagStore.RenameTag(tag.ID, name)
+	if err != nil {
+		h.logger.Printf("ERROR: renaming tag: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	tag.Name = name
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tag": tag})
+}
+
+// HandleMergeTag moves the workouts tagged {id} over to into_tag_id and
+// deletes tag {id}.
+func (h *TagAPI) HandleMergeTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.ownTag(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IntoTagID int `json:"into_tag_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+	if req.IntoTagID == tag.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a tag can't be merged into itself"})
+		return
+	}
+
+	into, err := h.tagStore.GetTagByID(req.IntoTagID)
+	if err != nil {
+		h.logger.Printf("ERROR: getTagByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if into == nil || into.UserID != tag.UserID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "into_tag_id must be another of your tags"})
+		return
+	}
+
+	err = h.tagStore.MergeTags(tag.ID, into.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: merging tags: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	into, err = h.tagStore.GetTagByID(into.ID)
+	if err != nil || into == nil {
+		h.logger.Printf("ERROR: getTagByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tag": into})
+}
+
+// HandleDeleteTag deletes tag {id}, removing it from its workouts.
+func (h *TagAPI) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := h.ownTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.tagStore.DeleteTag(tag.ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: deleting tag: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownTag loads the tag named by {id}, writing an error response unless it
+// exists and belongs to the current user.
+func (h *TagAPI) ownTag(w http.ResponseWriter, r *http.Request) (*store.Tag, bool) {
+	tagID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid tag ID"})
+		return nil, false
+	}
+
+	tag, err := h.tagStore.GetTagByID(tagID)
+	if err != nil {
+		h.logger.Printf("ERROR: getTagByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if tag == nil || tag.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag does not exist"})
+		return nil, false
+	}
+
+	return tag, true
+}
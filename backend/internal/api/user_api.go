@@ -6,7 +6,10 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/middleware"
 	"github.com/strangecousinwst/goworkout/internal/store"
 	"github.com/strangecousinwst/goworkout/internal/utils"
 )
@@ -101,3 +104,114 @@ func (h *UserAPI) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
 }
+
+func (h *UserAPI) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": currentUser})
+}
+
+type heartRateProfileResponse struct {
+	heartrate.Profile
+	Zones []heartrate.Zone `json:"zones"`
+}
+
+func newHeartRateProfileResponse(profile heartrate.Profile) heartRateProfileResponse {
+	zones, err := heartrate.Zones(profile)
+	if err != nil {
+		// not enough data for the chosen model yet
+		zones = []heartrate.Zone{}
+	}
+	return heartRateProfileResponse{Profile: profile, Zones: zones}
+}
+
+func (h *UserAPI) HandleGetHeartRateProfile(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"heart_rate": newHeartRateProfileResponse(currentUser.HeartRateProfile())})
+}
+
+// HandleUpdateHeartRateProfile sets max, resting and threshold HR and the
+// zone model used for time-in-zone breakdowns. Omitted fields are kept,
+// a 0 clears the value.
+func (h *UserAPI) HandleUpdateHeartRateProfile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MaxHeartRate       *int    `json:"max_heart_rate"`
+		RestingHeartRate   *int    `json:"resting_heart_rate"`
+		ThresholdHeartRate *int    `json:"threshold_heart_rate"`
+		ZoneModel          *string `json:"zone_model"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decoding heart rate profile request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	user := *currentUser
+
+	if req.MaxHeartRate != nil {
+		user.MaxHeartRate = positiveInt(*req.MaxHeartRate)
+	}
+	if req.RestingHeartRate != nil {
+		user.RestingHeartRate = positiveInt(*req.RestingHeartRate)
+	}
+	if req.ThresholdHeartRate != nil {
+		user.ThresholdHeartRate = positiveInt(*req.ThresholdHeartRate)
+	}
+	if req.ZoneModel != nil {
+		user.HeartRateZoneModel = *req.ZoneModel
+	}
+
+	profile := user.HeartRateProfile()
+	err = profile.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	user.HeartRateZoneModel = profile.Model
+
+	err = h.userStore.UpdateUser(&user)
+	if err != nil {
+		h.logger.Printf("ERROR: updating heart rate profile: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"heart_rate": newHeartRateProfileResponse(profile)})
+}
+
+// HandleUpdateTimezone sets the IANA timezone used to place schedules and
+// weekly analytics on the user's calendar days.
+func (h *UserAPI) HandleUpdateTimezone(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Timezone string `json:"timezone"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decoding timezone request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	// "Local" would mean the server's zone, not the user's
+	_, err = time.LoadLocation(req.Timezone)
+	if req.Timezone == "" || req.Timezone == "Local" || err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "timezone must be an IANA zone like Europe/Lisbon"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	user := *currentUser
+	user.Timezone = req.Timezone
+
+	err = h.userStore.UpdateUser(&user)
+	if err != nil {
+		h.logger.Printf("ERROR: updating timezone: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
@@ -4,23 +4,44 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
-
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/strangecousinwst/goworkout/internal/analytics"
+	"github.com/strangecousinwst/goworkout/internal/authz"
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
 	"github.com/strangecousinwst/goworkout/internal/middleware"
+	"github.com/strangecousinwst/goworkout/internal/quicklog"
 	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/tempo"
 	"github.com/strangecousinwst/goworkout/internal/utils"
+	"github.com/strangecousinwst/goworkout/internal/wod"
 )
 
+// maxHeartRateSamples allows a full day of one-second samples.
+const maxHeartRateSamples = 24 * 60 * 60
+
 type WorkoutAPI struct {
-	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	workoutStore     store.WorkoutStore
+	achievementStore store.AchievementStore
+	tokenStore       store.TokenStore
+	authz            *authz.Checker
+	logger           *log.Logger
 }
 
-func NewWorkoutAPI(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutAPI {
+func NewWorkoutAPI(workoutStore store.WorkoutStore, achievementStore store.AchievementStore, tokenStore store.TokenStore, checker *authz.Checker, logger *log.Logger) *WorkoutAPI {
 	return &WorkoutAPI{
-		workoutStore: workoutStore,
-		logger:       logger,
+		workoutStore:     workoutStore,
+		achievementStore: achievementStore,
+		tokenStore:       tokenStore,
+		authz:            checker,
+		logger:           logger,
 	}
 }
 
@@ -34,11 +55,30 @@ func (wh *WorkoutAPI) HandleGetUserWorkouts(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	wh.logger.Printf("INFO: [WorkoutAPI.HandleGetUserWorkouts] Fetching workouts for user ID: %d", currentUser.ID)
+	// coaches with read access list an athlete's workouts with ?user_id=
+	userID, err := utils.ReadQueryInt(r, "user_id", currentUser.ID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if userID != currentUser.ID && !wh.authorizeAthlete(w, currentUser, userID, store.PermissionRead) {
+		return
+	}
+
+	filter := store.WorkoutFilter{
+		ActivityType: r.URL.Query().Get("type"),
+		Tag:          strings.TrimSpace(r.URL.Query().Get("tag")),
+	}
+	if filter.ActivityType != "" && !store.ValidActivityType(filter.ActivityType) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidActivityType.Error()})
+		return
+	}
 
-	workouts, err := wh.workoutStore.GetWorkoutsForUser(currentUser.ID)
+	wh.logger.Printf("INFO: [WorkoutAPI.HandleGetUserWorkouts] Fetching workouts for user ID: %d", userID)
+
+	workouts, err := wh.workoutStore.GetWorkoutsForUser(userID, filter)
 	if err != nil {
-		wh.logger.Printf("ERROR: [WorkoutAPI.HandleGetUserWorkouts] Failed to get workouts for user ID %d: %v", currentUser.ID, err)
+		wh.logger.Printf("ERROR: [WorkoutAPI.HandleGetUserWorkouts] Failed to get workouts for user ID %d: %v", userID, err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workouts"})
 		return
 	}
@@ -47,13 +87,98 @@ func (wh *WorkoutAPI) HandleGetUserWorkouts(w http.ResponseWriter, r *http.Reque
 		workouts = []store.Workout{} // Return empty array instead of null for JSON
 	}
 
-	wh.logger.Printf("INFO: [WorkoutAPI.HandleGetUserWorkouts] Successfully fetched %d workouts for user ID: %d", len(workouts), currentUser.ID)
+	wh.logger.Printf("INFO: [WorkoutAPI.HandleGetUserWorkouts] Successfully fetched %d workouts for user ID: %d", len(workouts), userID)
 	// Your SvelteKit frontend expects an array directly, or an object with a "workouts" key.
 	// Let's assume it expects an object like {"workouts": [...]} based on your SvelteKit load function.
 	// If it expects a direct array, change WriteJSON to: utils.WriteJSON(w, http.StatusOK, workouts)
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
 }
 
+const (
+	maxSearchQueryLength = 200
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 100
+)
+
+// HandleSearchWorkouts full-text searches the workouts the caller may see
+// for ?q=, best match first. It takes the list filters ?type= and ?tag=,
+// ?user_id= for one person's workouts and ?from= and ?to= dates in the
+// caller's timezone. Pass the returned next_offset as ?offset= for the
+// next page; it is null on the last one.
+func (wh *WorkoutAPI) HandleSearchWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	query := r.URL.Query()
+
+	search := store.WorkoutSearch{
+		Query:        strings.TrimSpace(query.Get("q")),
+		ActivityType: query.Get("type"),
+		Tag:          strings.TrimSpace(query.Get("tag")),
+	}
+	if search.Query == "" || utf8.RuneCountInString(search.Query) > maxSearchQueryLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "q is required and at most 200 characters"})
+		return
+	}
+	if search.ActivityType != "" && !store.ValidActivityType(search.ActivityType) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidActivityType.Error()})
+		return
+	}
+
+	var err error
+	search.UserID, err = utils.ReadQueryInt(r, "user_id", 0)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	loc := currentUser.Location()
+	for _, param := range []string{"from", "to"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation(store.DateLayout, value, loc)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": param + " must be a date like 2025-06-02"})
+			return
+		}
+		if param == "from" {
+			search.From = date
+		} else {
+			search.To = date.AddDate(0, 0, 1)
+		}
+	}
+
+	search.Limit, err = utils.ReadQueryInt(r, "limit", defaultSearchLimit)
+	if err != nil || search.Limit < 1 || search.Limit > maxSearchLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+	search.Offset, err = utils.ReadQueryInt(r, "offset", 0)
+	if err != nil || search.Offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset must not be negative"})
+		return
+	}
+
+	// one extra row tells us whether there is another page
+	limit := search.Limit
+	search.Limit++
+	results, err := wh.workoutStore.SearchWorkouts(currentUser.ID, search)
+	if err != nil {
+		wh.logger.Printf("ERROR: searching workouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	var next *int
+	if len(results) > limit {
+		results = results[:limit]
+		offset := search.Offset + limit
+		next = &offset
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results, "next_offset": next})
+}
+
 func (wh *WorkoutAPI) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -62,8 +187,13 @@ func (wh *WorkoutAPI) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.View) {
+		return
+	}
+
 	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
-	if err != nil {
+	if err != nil || workout == nil {
 		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "invalid server error"})
 		return
@@ -72,6 +202,47 @@ func (wh *WorkoutAPI) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Reques
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
+// HandleCompareWorkouts compares workout ?b= against workout ?a=
+// exercise by exercise, for following progress between two sessions of a
+// routine. The caller must be allowed to view both.
+func (wh *WorkoutAPI) HandleCompareWorkouts(w http.ResponseWriter, r *http.Request) {
+	var ids [2]int
+	for i, param := range []string{"a", "b"} {
+		id, err := utils.ReadQueryInt(r, param, 0)
+		if err != nil || id < 1 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": param + " must be a workout ID"})
+			return
+		}
+		ids[i] = id
+	}
+	if ids[0] == ids[1] {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a and b must be different workouts"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	var workouts [2]*store.Workout
+	for i, id := range ids {
+		if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, id, authz.View) {
+			return
+		}
+
+		workout, err := wh.workoutStore.GetWorkoutByID(id)
+		if err != nil || workout == nil {
+			wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		workouts[i] = workout
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"a":          workouts[0],
+		"b":          workouts[1],
+		"comparison": analytics.Compare(workouts[0], workouts[1]),
+	})
+}
+
 func (wh *WorkoutAPI) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
 	var workout store.Workout
 	err := json.NewDecoder(r.Body).Decode(&workout)
@@ -86,16 +257,189 @@ func (wh *WorkoutAPI) HandleCreateWorkout(w http.ResponseWriter, r *http.Request
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in"})
 	}
 
-	workout.UserID = currentUser.ID
+	wh.createWorkout(w, currentUser, &workout)
+}
+
+// createWorkout validates and saves a workout sent by currentUser,
+// writing the response.
+func (wh *WorkoutAPI) createWorkout(w http.ResponseWriter, currentUser *store.User, workout *store.Workout) {
+	// a coach with write access may log a workout for an athlete by
+	// setting user_id; it stays attributed to the coach
+	if workout.UserID != 0 && workout.UserID != currentUser.ID {
+		if !wh.authorizeAthlete(w, currentUser, workout.UserID, store.PermissionWrite) {
+			return
+		}
+	} else {
+		workout.UserID = currentUser.ID
+	}
+	workout.CreatedBy = &currentUser.ID
+	workout.UpdatedBy = nil
+
+	if workout.Visibility != "" && !authz.ValidVisibility(workout.Visibility) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be private, followers or public"})
+		return
+	}
+	if workout.Visibility != "" && workout.Visibility != store.VisibilityPrivate && workout.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can change a workout's visibility"})
+		return
+	}
+	if workout.ActivityType != "" && !store.ValidActivityType(workout.ActivityType) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidActivityType.Error()})
+		return
+	}
 
-	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	var err error
+	workout.Tags, err = normalizeTags(workout.Tags)
+	if err == nil {
+		err = validateEntries(workout.Entries)
+	}
+	if err == nil {
+		err = validateGroups(workout.Groups)
+	}
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if workout.WOD != nil {
+		err = workout.WOD.Validate()
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	// badges are awarded by a store write hook; compare before and after
+	// to tell the client which ones this workout unlocked
+	before, err := wh.achievementStore.GetAchievementsForUser(workout.UserID)
+	if err != nil {
+		wh.logger.Printf("ERROR: getAchievementsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	createdWorkout, err := wh.workoutStore.CreateWorkout(workout)
 	if err != nil {
 		wh.logger.Printf("ERROR: creatingWorkout: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+	after, err := wh.achievementStore.GetAchievementsForUser(workout.UserID)
+	if err != nil {
+		// the workout is saved; don't fail the request over the badges
+		wh.logger.Printf("ERROR: getAchievementsForUser: %v", err)
+		after = before
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"workout":          createdWorkout,
+		"new_achievements": newAchievements(before, after),
+	})
+}
+
+// maxQuickLogLength is about a hundred lines.
+const maxQuickLogLength = 5000
+
+// quickLogRequest is quick-log text plus the optional workout fields of a
+// full create.
+type quickLogRequest struct {
+	Text         string     `json:"text"`
+	UserID       int        `json:"user_id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	StartedAt    *time.Time `json:"started_at"`
+	ActivityType string     `json:"activity_type"`
+	Visibility   string     `json:"visibility"`
+	Tags         []string   `json:"tags"`
+}
+
+// readQuickLog decodes a quick-log request and parses its text, writing
+// an error response when either fails. Parse errors are listed with the
+// line, column and token they point at.
+func readQuickLog(w http.ResponseWriter, r *http.Request) (*quickLogRequest, []store.WorkoutEntry, bool) {
+	var req quickLogRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return nil, nil, false
+	}
+	if strings.TrimSpace(req.Text) == "" || utf8.RuneCountInString(req.Text) > maxQuickLogLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "text is required and at most 5000 characters"})
+		return nil, nil, false
+	}
+
+	entries, err := quicklog.Parse(req.Text)
+	var parseErrs quicklog.Errors
+	if errors.As(err, &parseErrs) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error(), "errors": parseErrs})
+		return nil, nil, false
+	}
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, nil, false
+	}
+	if len(entries) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "text has no entries"})
+		return nil, nil, false
+	}
+
+	return &req, entries, true
+}
+
+// HandleParseQuickLog previews what HandleQuickLog would log for the
+// same text, without saving anything. See package quicklog for the
+// syntax.
+func (wh *WorkoutAPI) HandleParseQuickLog(w http.ResponseWriter, r *http.Request) {
+	_, entries, ok := readQuickLog(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries": entries})
+}
+
+// HandleQuickLog creates a workout from quick-log text, one entry per
+// line. Any other field of a full create may be sent alongside; the start
+// defaults to now, and the duration and distance to the entries' totals.
+func (wh *WorkoutAPI) HandleQuickLog(w http.ResponseWriter, r *http.Request) {
+	req, entries, ok := readQuickLog(w, r)
+	if !ok {
+		return
+	}
+
+	workout := store.Workout{
+		UserID:       req.UserID,
+		Title:        strings.TrimSpace(req.Title),
+		Description:  req.Description,
+		StartedAt:    time.Now(),
+		ActivityType: req.ActivityType,
+		Visibility:   req.Visibility,
+		Tags:         req.Tags,
+		Entries:      entries,
+		Groups:       []store.EntryGroup{},
+	}
+	if req.StartedAt != nil {
+		workout.StartedAt = *req.StartedAt
+	}
+	if workout.Title == "" {
+		workout.Title = "Quick log"
+	}
+
+	seconds, meters := 0, 0.0
+	for _, entry := range entries {
+		if entry.DurationSeconds != nil {
+			seconds += entry.Sets * *entry.DurationSeconds
+		}
+		if entry.DistanceMeters != nil {
+			meters += float64(entry.Sets) * *entry.DistanceMeters
+		}
+	}
+	workout.DurationMinutes = (seconds + 59) / 60
+	if meters > 0 {
+		workout.DistanceMeters = &meters
+	}
+
+	wh.createWorkout(w, middleware.GetUser(r), &workout)
 }
 
 func (wh *WorkoutAPI) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
@@ -106,6 +450,11 @@ func (wh *WorkoutAPI) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Edit) {
+		return
+	}
+
 	existingWorkout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 	if err != nil {
 		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
@@ -122,9 +471,18 @@ func (wh *WorkoutAPI) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Req
 	var updateWorkoutRequest struct {
 		Title           *string              `json:"title"`
 		Description     *string              `json:"description"`
+		StartedAt       *time.Time           `json:"started_at"`
 		DurationMinutes *int                 `json:"duration_minutes"`
 		CaloriesBurned  *int                 `json:"calories_burned"`
+		DistanceMeters  *float64             `json:"distance_meters"`
+		AvgHeartRate    *int                 `json:"avg_heart_rate"`
+		MaxHeartRate    *int                 `json:"max_heart_rate"`
 		Entries         []store.WorkoutEntry `json:"entries"`
+		Groups          []store.EntryGroup   `json:"groups"`
+		WOD             *wod.WOD             `json:"wod"`
+		Visibility      *string              `json:"visibility"`
+		ActivityType    *string              `json:"activity_type"`
+		Tags            []string             `json:"tags"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
@@ -140,89 +498,471 @@ func (wh *WorkoutAPI) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Req
 	if updateWorkoutRequest.Description != nil {
 		existingWorkout.Description = *updateWorkoutRequest.Description
 	}
+	if updateWorkoutRequest.StartedAt != nil {
+		existingWorkout.StartedAt = *updateWorkoutRequest.StartedAt
+	}
 	if updateWorkoutRequest.DurationMinutes != nil {
 		existingWorkout.DurationMinutes = *updateWorkoutRequest.DurationMinutes
 	}
 	if updateWorkoutRequest.CaloriesBurned != nil {
 		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
 	}
+	if updateWorkoutRequest.DistanceMeters != nil {
+		existingWorkout.DistanceMeters = updateWorkoutRequest.DistanceMeters
+	}
+	if updateWorkoutRequest.AvgHeartRate != nil {
+		existingWorkout.AvgHeartRate = updateWorkoutRequest.AvgHeartRate
+	}
+	if updateWorkoutRequest.MaxHeartRate != nil {
+		existingWorkout.MaxHeartRate = updateWorkoutRequest.MaxHeartRate
+	}
 	if updateWorkoutRequest.Entries != nil {
+		err = validateEntries(updateWorkoutRequest.Entries)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
 		existingWorkout.Entries = updateWorkoutRequest.Entries
 	}
+	if updateWorkoutRequest.Groups != nil {
+		err = validateGroups(updateWorkoutRequest.Groups)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		existingWorkout.Groups = updateWorkoutRequest.Groups
+	}
+	if updateWorkoutRequest.WOD != nil {
+		err = updateWorkoutRequest.WOD.Validate()
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		existingWorkout.WOD = updateWorkoutRequest.WOD
+	}
+	if updateWorkoutRequest.Visibility != nil {
+		if !authz.ValidVisibility(*updateWorkoutRequest.Visibility) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "visibility must be private, followers or public"})
+			return
+		}
+		// who may see a workout is the owner's call alone, even for a
+		// coach with write access
+		if *updateWorkoutRequest.Visibility != existingWorkout.Visibility && existingWorkout.UserID != currentUser.ID {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can change a workout's visibility"})
+			return
+		}
+		existingWorkout.Visibility = *updateWorkoutRequest.Visibility
+	}
+	if updateWorkoutRequest.ActivityType != nil {
+		if !store.ValidActivityType(*updateWorkoutRequest.ActivityType) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": errInvalidActivityType.Error()})
+			return
+		}
+		existingWorkout.ActivityType = *updateWorkoutRequest.ActivityType
+	}
+	if updateWorkoutRequest.Tags != nil {
+		existingWorkout.Tags, err = normalizeTags(updateWorkoutRequest.Tags)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	existingWorkout.UpdatedBy = &currentUser.ID
+
+	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	if err != nil {
+		wh.logger.Printf("ERROR: updatingWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+}
+
+var errInvalidActivityType = errors.New("activity_type must be one of " + strings.Join(store.ActivityTypes, ", "))
+
+const (
+	maxTagsPerWorkout = 20
+	maxTagLength      = 50
+)
+
+// normalizeTags trims tag names and drops repeats, which match regardless
+// of case; the first spelling wins.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTagsPerWorkout {
+		return nil, fmt.Errorf("workouts can have at most %d tags", maxTagsPerWorkout)
+	}
+
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		name, err := normalizeTagName(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		return "", fmt.Errorf("tags must be between 1 and %d characters", maxTagLength)
+	}
+	return name, nil
+}
+
+// validateGroups checks superset/circuit groups sent by the client,
+// defaulting rounds to 1 when omitted.
+func validateGroups(groups []store.EntryGroup) error {
+	for i := range groups {
+		group := &groups[i]
+
+		switch group.Kind {
+		case store.GroupSuperset, store.GroupCircuit, store.GroupGiantSet:
+		default:
+			return errors.New("group kind must be superset, circuit or giant_set")
+		}
+
+		if group.Rounds == 0 {
+			group.Rounds = 1
+		}
+		if group.Rounds < 1 {
+			return errors.New("group rounds must be at least 1")
+		}
+		if group.RestBetweenRoundsSeconds != nil && *group.RestBetweenRoundsSeconds < 0 {
+			return errors.New("rest_between_rounds_seconds must not be negative")
+		}
+		if len(group.Entries) == 0 {
+			return errors.New("groups need at least one entry")
+		}
+		err := validateEntries(group.Entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateEntries checks rest and tempo, rewriting tempos in their
+// canonical "3-1-X-0" form.
+func validateEntries(entries []store.WorkoutEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+
+		if entry.RestSeconds != nil && *entry.RestSeconds < 0 {
+			return errors.New("rest_seconds must not be negative")
+		}
+		if entry.Tempo != "" {
+			t, err := tempo.Parse(entry.Tempo)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.ExerciseName, err)
+			}
+			entry.Tempo = t.String()
+		}
+	}
+
+	return nil
+}
+
+func (wh *WorkoutAPI) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout delete ID"})
+		return
+	}
 
 	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in"})
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Edit) {
+		return
+	}
+
+	err = wh.workoutStore.DeleteWorkout(workoutID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "workout not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: deletingWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateHeartRate replaces the workout's per-second heart-rate series.
+func (wh *WorkoutAPI) HandleUpdateHeartRate(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	var req struct {
+		Samples []heartrate.Sample `json:"samples"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+		wh.logger.Printf("ERROR: decodingHeartRateRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if len(req.Samples) > maxHeartRateSamples {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "too many heart-rate samples"})
+		return
+	}
+	for _, sample := range req.Samples {
+		if sample.OffsetSeconds < 0 || sample.BPM <= 0 || sample.BPM >= 260 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "samples need a non-negative offset_seconds and a bpm between 1 and 259"})
 			return
 		}
+	}
 
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Edit) {
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to update this workout"})
-		return
+	sort.Slice(req.Samples, func(i, j int) bool {
+		return req.Samples[i].OffsetSeconds < req.Samples[j].OffsetSeconds
+	})
+	for i := 1; i < len(req.Samples); i++ {
+		if req.Samples[i].OffsetSeconds == req.Samples[i-1].OffsetSeconds {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "samples must have unique offset_seconds"})
+			return
+		}
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	err = wh.workoutStore.ReplaceHeartRateSamples(workoutID, req.Samples)
 	if err != nil {
-		wh.logger.Printf("ERROR: updatingWorkout: %v", err)
+		wh.logger.Printf("ERROR: replacingHeartRateSamples: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+	avgHR, maxHR := heartrate.Summary(req.Samples)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"samples":        len(req.Samples),
+		"avg_heart_rate": avgHR,
+		"max_heart_rate": maxHR,
+	})
 }
 
-func (wh *WorkoutAPI) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http.Request) {
+// HandleGetHeartRate returns the workout's heart-rate series to its owner
+// and their coaches; people who can only view the workout don't get it.
+func (wh *WorkoutAPI) HandleGetHeartRate(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
 		wh.logger.Printf("ERROR: readIDParam: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout delete ID"})
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
 		return
 	}
 
 	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in"})
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Biometrics) {
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	samples, err := wh.workoutStore.GetHeartRateSamples(workoutID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
-			return
+		wh.logger.Printf("ERROR: getHeartRateSamples: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if samples == nil {
+		samples = []heartrate.Sample{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"samples": samples})
+}
+
+// wodResult is one ranked attempt at a named WOD.
+type wodResult struct {
+	Rank      int       `json:"rank"`
+	WorkoutID int       `json:"workout_id"`
+	StartedAt time.Time `json:"started_at"`
+	WOD       *wod.WOD  `json:"wod"`
+	Display   string    `json:"display"`
+}
+
+// HandleGetWODResults ranks the caller's attempts at a named WOD, best
+// first. Attempts logged in different formats can't be compared, so each
+// format is ranked on its own.
+func (wh *WorkoutAPI) HandleGetWODResults(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	name := strings.TrimSpace(chi.URLParam(r, "name"))
+	if name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "missing wod name"})
+		return
+	}
+
+	workouts, err := wh.workoutStore.GetWODResults(currentUser.ID, name)
+	if err != nil {
+		wh.logger.Printf("ERROR: getting wod results: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	byFormat := make(map[wod.Format][]*store.Workout)
+	for i := range workouts {
+		format := workouts[i].WOD.Format
+		byFormat[format] = append(byFormat[format], &workouts[i])
+	}
+
+	results := make(map[wod.Format][]wodResult, len(byFormat))
+	for format, attempts := range byFormat {
+		// stable keeps ties in most-recent-first order
+		sort.SliceStable(attempts, func(i, j int) bool {
+			return wod.Compare(format, attempts[i].WOD.Score, attempts[j].WOD.Score) < 0
+		})
+
+		ranked := make([]wodResult, len(attempts))
+		for i, attempt := range attempts {
+			rank := i + 1
+			if i > 0 && wod.Compare(format, attempt.WOD.Score, attempts[i-1].WOD.Score) == 0 {
+				rank = ranked[i-1].Rank
+			}
+			ranked[i] = wodResult{
+				Rank:      rank,
+				WorkoutID: attempt.ID,
+				StartedAt: attempt.StartedAt,
+				WOD:       attempt.WOD,
+				Display:   attempt.WOD.String(),
+			}
 		}
+		results[format] = ranked
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"name": name, "results": results})
+}
+
+// authorizeWorkout checks the caller's access to a workout, writing the
+// error response and returning false when it is denied.
+func authorizeWorkout(w http.ResponseWriter, checker *authz.Checker, logger *log.Logger, user *store.User, workoutID int, access authz.Access) bool {
+	err := checker.Workout(user, workoutID, access)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authz.ErrNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, authz.ErrForbidden):
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+	default:
+		logger.Printf("ERROR: authorizing workout %d: %v", workoutID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	return false
+}
+
+// authorizeAthlete checks that the caller coaches athleteID with scope,
+// writing the error response and returning false when not.
+func (wh *WorkoutAPI) authorizeAthlete(w http.ResponseWriter, coach *store.User, athleteID int, scope string) bool {
+	err := wh.authz.Athlete(coach, athleteID, scope)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authz.ErrNoGrant):
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+	default:
+		wh.logger.Printf("ERROR: authorizing athlete %d: %v", athleteID, err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	return false
+}
+
+// shareTokenTTL is how long a share link works unless revoked first.
+const shareTokenTTL = 365 * 24 * time.Hour
+
+// HandleCreateShareLink issues a link that opens the workout read-only
+// without logging in, whatever its visibility.
+func (wh *WorkoutAPI) HandleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
+		return
+	}
 
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Own) {
+		return
+	}
+
+	token, err := wh.tokenStore.CreateShareToken(currentUser.ID, workoutID, shareTokenTTL)
+	if err != nil {
+		wh.logger.Printf("ERROR: creating share token: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to delete this workout"})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"share_token": token,
+		"path":        "/shared/workouts/" + token.PlainText,
+	})
+}
+
+// HandleRevokeShareLinks disables every share link of the workout.
+func (wh *WorkoutAPI) HandleRevokeShareLinks(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "workout not found", http.StatusNotFound)
+	currentUser := middleware.GetUser(r)
+	if !authorizeWorkout(w, wh.authz, wh.logger, currentUser, workoutID, authz.Own) {
 		return
 	}
 
+	err = wh.tokenStore.DeleteShareTokens(workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: deletingWorkout: %v", err)
+		wh.logger.Printf("ERROR: deleting share tokens: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// HandleGetSharedWorkout serves a workout opened through a share link. The
+// token in the path is the only credential, so it is served outside the
+// authenticated routes and leaves out import metadata.
+func (wh *WorkoutAPI) HandleGetSharedWorkout(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	workoutID, err := wh.tokenStore.GetSharedWorkoutID(token)
+	if err != nil {
+		wh.logger.Printf("ERROR: getting shared workout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workoutID == 0 {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share link does not exist or was revoked"})
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	if err != nil || workout == nil {
+		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	workout.Source = ""
+	workout.SourceID = ""
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout, "read_only": true})
+}
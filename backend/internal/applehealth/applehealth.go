@@ -0,0 +1,315 @@
+// Package applehealth streams workouts and body-mass samples out of an
+// Apple Health export.xml. The file is read token by token and only one
+// element is decoded at a time, so memory use doesn't grow with file size.
+package applehealth
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	typeBodyMass          = "HKQuantityTypeIdentifierBodyMass"
+	typeHeartRate         = "HKQuantityTypeIdentifierHeartRate"
+	typeActiveEnergy      = "HKQuantityTypeIdentifierActiveEnergyBurned"
+	activityTypePrefix    = "HKWorkoutActivityType"
+	metadataExternalUUID  = "HKExternalUUID"
+	metadataMetadataUUID  = "HKMetadataKeyExternalUUID"
+	appleHealthTimeLayout = "2006-01-02 15:04:05 -0700"
+)
+
+// Workout is an HKWorkout record, converted to metric units.
+type Workout struct {
+	// UUID identifies the workout across exports. Apple only exports one
+	// for workouts written by some apps; for the rest it is derived from
+	// the source, activity type and time span.
+	UUID           string
+	ActivityType   string
+	SourceName     string
+	Start          time.Time
+	End            time.Time
+	Duration       time.Duration
+	DistanceMeters float64
+	Calories       float64
+	AvgHeartRate   float64
+	MaxHeartRate   float64
+}
+
+// Title turns the activity type into words, e.g.
+// "HKWorkoutActivityTypeTraditionalStrengthTraining" becomes
+// "Traditional Strength Training".
+func (w *Workout) Title() string {
+	name := strings.TrimPrefix(w.ActivityType, activityTypePrefix)
+	if name == "" {
+		return "Workout"
+	}
+	return strings.TrimSpace(camelCaseBoundary.ReplaceAllString(name, "$1 $2"))
+}
+
+var camelCaseBoundary = regexp.MustCompile(`([a-z])([A-Z])`)
+
+// BodyMass is a body-mass sample in kilograms.
+type BodyMass struct {
+	UUID       string
+	Kilograms  float64
+	MeasuredAt time.Time
+}
+
+// Handler receives records as they are read. Returning an error aborts the
+// parse.
+type Handler struct {
+	Workout  func(*Workout) error
+	BodyMass func(*BodyMass) error
+}
+
+type attr struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type statistics struct {
+	Type    string `xml:"type,attr"`
+	Sum     string `xml:"sum,attr"`
+	Average string `xml:"average,attr"`
+	Maximum string `xml:"maximum,attr"`
+	Unit    string `xml:"unit,attr"`
+}
+
+type workoutElement struct {
+	ActivityType          string       `xml:"workoutActivityType,attr"`
+	Duration              string       `xml:"duration,attr"`
+	DurationUnit          string       `xml:"durationUnit,attr"`
+	TotalDistance         string       `xml:"totalDistance,attr"`
+	TotalDistanceUnit     string       `xml:"totalDistanceUnit,attr"`
+	TotalEnergyBurned     string       `xml:"totalEnergyBurned,attr"`
+	TotalEnergyBurnedUnit string       `xml:"totalEnergyBurnedUnit,attr"`
+	SourceName            string       `xml:"sourceName,attr"`
+	StartDate             string       `xml:"startDate,attr"`
+	EndDate               string       `xml:"endDate,attr"`
+	Metadata              []attr       `xml:"MetadataEntry"`
+	Statistics            []statistics `xml:"WorkoutStatistics"`
+}
+
+// Parse reads an export.xml from r, calling h for each workout and
+// body-mass record. Every other element is skipped without decoding.
+func Parse(r io.Reader, h Handler) error {
+	d := xml.NewDecoder(r)
+	// the export's DOCTYPE declares entities the decoder doesn't know about
+	d.Strict = false
+
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "HealthData":
+			// root element, descend into it
+		case "Workout":
+			var el workoutElement
+			err = d.DecodeElement(&el, &se)
+			if err != nil {
+				return err
+			}
+			if h.Workout == nil {
+				continue
+			}
+
+			workout, err := newWorkout(&el)
+			if err != nil {
+				return err
+			}
+			err = h.Workout(workout)
+			if err != nil {
+				return err
+			}
+		case "Record":
+			if h.BodyMass == nil || attrValue(se, "type") != typeBodyMass {
+				err = d.Skip()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			sample, err := newBodyMass(se)
+			if err != nil {
+				return err
+			}
+			err = d.Skip()
+			if err != nil {
+				return err
+			}
+			err = h.BodyMass(sample)
+			if err != nil {
+				return err
+			}
+		default:
+			err = d.Skip()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newWorkout(el *workoutElement) (*Workout, error) {
+	start, err := parseTime(el.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(el.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Workout{
+		ActivityType: el.ActivityType,
+		SourceName:   el.SourceName,
+		Start:        start,
+		End:          end,
+		Duration:     end.Sub(start),
+	}
+
+	if el.Duration != "" {
+		w.Duration = toDuration(parseFloat(el.Duration), el.DurationUnit)
+	}
+	w.DistanceMeters = toMeters(parseFloat(el.TotalDistance), el.TotalDistanceUnit)
+	w.Calories = toKilocalories(parseFloat(el.TotalEnergyBurned), el.TotalEnergyBurnedUnit)
+
+	// since iOS 16 totals live in WorkoutStatistics children instead
+	for _, stat := range el.Statistics {
+		switch {
+		case stat.Type == typeActiveEnergy && w.Calories == 0:
+			w.Calories = toKilocalories(parseFloat(stat.Sum), stat.Unit)
+		case strings.HasPrefix(stat.Type, "HKQuantityTypeIdentifierDistance") && w.DistanceMeters == 0:
+			w.DistanceMeters = toMeters(parseFloat(stat.Sum), stat.Unit)
+		case stat.Type == typeHeartRate:
+			w.AvgHeartRate = parseFloat(stat.Average)
+			w.MaxHeartRate = parseFloat(stat.Maximum)
+		}
+	}
+
+	for _, entry := range el.Metadata {
+		if entry.Key == metadataExternalUUID || entry.Key == metadataMetadataUUID {
+			w.UUID = entry.Value
+		}
+	}
+	if w.UUID == "" {
+		w.UUID = derivedUUID(el.SourceName, el.ActivityType, el.StartDate, el.EndDate)
+	}
+
+	return w, nil
+}
+
+func newBodyMass(se xml.StartElement) (*BodyMass, error) {
+	measuredAt, err := parseTime(attrValue(se, "startDate"))
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := strconv.ParseFloat(attrValue(se, "value"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("applehealth: invalid body mass %q", attrValue(se, "value"))
+	}
+
+	switch attrValue(se, "unit") {
+	case "lb":
+		value *= 0.45359237
+	case "g":
+		value /= 1000
+	}
+
+	return &BodyMass{
+		UUID:       derivedUUID(attrValue(se, "sourceName"), typeBodyMass, attrValue(se, "startDate"), attrValue(se, "endDate")),
+		Kilograms:  value,
+		MeasuredAt: measuredAt,
+	}, nil
+}
+
+func attrValue(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(appleHealthTimeLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("applehealth: invalid date %q", value)
+	}
+	return t, nil
+}
+
+// parseFloat treats missing or malformed numbers as zero; Apple leaves
+// totals out rather than writing 0.
+func parseFloat(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func toDuration(value float64, unit string) time.Duration {
+	switch unit {
+	case "s":
+		return time.Duration(value * float64(time.Second))
+	case "hr":
+		return time.Duration(value * float64(time.Hour))
+	default: // "min"
+		return time.Duration(value * float64(time.Minute))
+	}
+}
+
+func toMeters(value float64, unit string) float64 {
+	switch unit {
+	case "km":
+		return value * 1000
+	case "mi":
+		return value * 1609.344
+	case "yd":
+		return value * 0.9144
+	case "ft":
+		return value * 0.3048
+	default: // "m"
+		return value
+	}
+}
+
+func toKilocalories(value float64, unit string) float64 {
+	if unit == "kJ" {
+		return value / 4.184
+	}
+	// "kcal" and "Cal" are the same unit
+	return value
+}
+
+// derivedUUID builds a stable name-based UUID (version 5 layout) from the
+// fields that identify a record, so re-importing the same export yields
+// the same IDs.
+func derivedUUID(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
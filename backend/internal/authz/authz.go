@@ -0,0 +1,175 @@
+// Package authz decides who may access a workout. Every handler that reads
+// or writes a workout by ID goes through Checker.Workout, so the
+// visibility rules and coaching grants live in one place.
+package authz
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+var (
+	ErrNotFound  = errors.New("workout does not exist")
+	ErrForbidden = errors.New("you do not have permission to access this workout")
+	// ErrNoGrant is returned by Checker.Athlete when the caller doesn't
+	// coach the athlete with the needed scope.
+	ErrNoGrant = errors.New("you do not have permission to act for this athlete")
+	// ErrNotRelated is returned by Checker.Messaging for users who may not
+	// message each other.
+	ErrNotRelated = errors.New("you can only message your coaches, athletes and mutual follows")
+)
+
+// Access is what the caller wants to do with a workout.
+type Access int
+
+const (
+	// View reads the workout as it is shown to others, or to a coach with
+	// read access.
+	View Access = iota
+	// Edit changes or deletes the workout, which coaches with write access
+	// may also do.
+	Edit
+	// Biometrics reads raw body data such as the heart-rate series. The
+	// workout's visibility doesn't extend to it: only the owner and
+	// coaches with read access may.
+	Biometrics
+	// Own covers everything only the owner may do, including reads that
+	// depend on the owner's private settings like heart-rate zones.
+	Own
+)
+
+// ValidVisibility reports whether v is a known visibility.
+func ValidVisibility(v string) bool {
+	switch v {
+	case store.VisibilityPrivate, store.VisibilityFollowers, store.VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// CanView applies the visibility rules: owners see everything, followers
+// see followers-only and public workouts, and anyone signed in sees public
+// ones.
+func CanView(viewerID, ownerID int, visibility string, following bool) bool {
+	switch {
+	case viewerID == ownerID:
+		return true
+	case visibility == store.VisibilityPublic:
+		return true
+	case visibility == store.VisibilityFollowers:
+		return following
+	default:
+		return false
+	}
+}
+
+type Checker struct {
+	workoutStore store.WorkoutStore
+	socialStore  store.SocialStore
+	coachStore   store.CoachStore
+}
+
+func NewChecker(workoutStore store.WorkoutStore, socialStore store.SocialStore, coachStore store.CoachStore) *Checker {
+	return &Checker{
+		workoutStore: workoutStore,
+		socialStore:  socialStore,
+		coachStore:   coachStore,
+	}
+}
+
+// Athlete returns nil when coach has an active grant from athleteID that
+// includes scope, ErrNoGrant when not, or the error that stopped it from
+// finding out.
+func (c *Checker) Athlete(coach *store.User, athleteID int, scope string) error {
+	if coach.IsAnonymous() {
+		return ErrNoGrant
+	}
+
+	grant, err := c.coachStore.GetActiveGrant(athleteID, coach.ID)
+	if err != nil {
+		return err
+	}
+	if grant == nil || !grant.Permissions.Allows(scope) {
+		return ErrNoGrant
+	}
+	return nil
+}
+
+// Workout returns nil when viewer may access workoutID as asked, ErrNotFound
+// or ErrForbidden when not, or the error that stopped it from finding out.
+func (c *Checker) Workout(viewer *store.User, workoutID int, access Access) error {
+	ownerID, visibility, err := c.workoutStore.GetWorkoutVisibility(workoutID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if viewer.ID == ownerID && !viewer.IsAnonymous() {
+		return nil
+	}
+	if access == Own || viewer.IsAnonymous() {
+		return ErrForbidden
+	}
+
+	scope := store.PermissionRead
+	if access == Edit {
+		scope = store.PermissionWrite
+	}
+	err = c.Athlete(viewer, ownerID, scope)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrNoGrant) {
+		return err
+	}
+	if access == Edit || access == Biometrics {
+		return ErrForbidden
+	}
+
+	following := false
+	if visibility == store.VisibilityFollowers {
+		following, err = c.socialStore.IsFollowing(viewer.ID, ownerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !CanView(viewer.ID, ownerID, visibility, following) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Messaging returns nil when user and otherID may message each other:
+// one coaches the other under an active grant, or they follow each other.
+// It returns ErrNotRelated when not.
+func (c *Checker) Messaging(user *store.User, otherID int) error {
+	if user.IsAnonymous() || user.ID == otherID {
+		return ErrNotRelated
+	}
+
+	for _, pair := range [][2]int{{user.ID, otherID}, {otherID, user.ID}} {
+		grant, err := c.coachStore.GetActiveGrant(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if grant != nil {
+			return nil
+		}
+	}
+
+	for _, pair := range [][2]int{{user.ID, otherID}, {otherID, user.ID}} {
+		following, err := c.socialStore.IsFollowing(pair[0], pair[1])
+		if err != nil {
+			return err
+		}
+		if !following {
+			return ErrNotRelated
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package export writes workouts as CSV, JSON or NDJSON one workout at a
+// time, so a full history can be streamed without holding it in memory.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatJSON:   "application/json",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// ValidFormat reports whether format is one we can export to.
+func ValidFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Writer encodes workouts one by one. Close must be called to finish the
+// document and flush buffered output.
+type Writer interface {
+	WriteWorkout(*store.Workout) error
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatJSON:
+		return &jsonWriter{w: bufio.NewWriter(w)}, nil
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+var csvHeader = []string{
+	"workout_id", "started_at", "title", "description", "duration_minutes", "calories_burned",
+	"distance_meters", "avg_heart_rate", "max_heart_rate", "activity_type", "tags",
+	"entry_id", "order_index", "exercise_name", "sets", "reps", "duration_seconds", "weight",
+	"entry_distance_meters", "notes", "rest_seconds", "tempo",
+	"group_id", "group_kind", "group_rounds", "group_rest_seconds",
+}
+
+// tagSeparator joins a workout's tags into its one tags cell. JSON
+// exports keep them as a list.
+const tagSeparator = ";"
+
+// csvWriter emits one row per entry, repeating the workout columns and,
+// for grouped entries, the group's. A workout without entries still gets a
+// row with empty entry columns.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	err := cw.w.Write(csvHeader)
+	if err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteWorkout(workout *store.Workout) error {
+	workoutColumns := []string{
+		strconv.Itoa(workout.ID),
+		workout.StartedAt.UTC().Format(time.RFC3339),
+		workout.Title,
+		workout.Description,
+		strconv.Itoa(workout.DurationMinutes),
+		strconv.Itoa(workout.CaloriesBurned),
+		formatFloat(workout.DistanceMeters),
+		formatInt(workout.AvgHeartRate),
+		formatInt(workout.MaxHeartRate),
+		workout.ActivityType,
+		strings.Join(workout.Tags, tagSeparator),
+	}
+
+	if len(workout.Entries) == 0 && len(workout.Groups) == 0 {
+		return cw.w.Write(append(workoutColumns, make([]string, len(csvHeader)-len(workoutColumns))...))
+	}
+
+	var err error
+	workout.EachEntry(func(entry *store.WorkoutEntry, group *store.EntryGroup) {
+		if err != nil {
+			return
+		}
+
+		row := append(workoutColumns[:len(workoutColumns):len(workoutColumns)],
+			strconv.Itoa(entry.ID),
+			strconv.Itoa(entry.OrderIndex),
+			entry.ExerciseName,
+			strconv.Itoa(entry.Sets),
+			formatInt(entry.Reps),
+			formatInt(entry.DurationSeconds),
+			formatFloat(entry.Weight),
+			formatFloat(entry.DistanceMeters),
+			entry.Notes,
+			formatInt(entry.RestSeconds),
+			entry.Tempo,
+		)
+		if group != nil {
+			row = append(row, strconv.Itoa(group.ID), group.Kind, strconv.Itoa(group.Rounds), formatInt(group.RestBetweenRoundsSeconds))
+		} else {
+			row = append(row, "", "", "", "")
+		}
+
+		err = cw.w.Write(row)
+	})
+
+	return err
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter produces {"workouts": [...]}, matching GET /workouts/.
+type jsonWriter struct {
+	w       *bufio.Writer
+	written int
+}
+
+func (jw *jsonWriter) WriteWorkout(workout *store.Workout) error {
+	prefix := ","
+	if jw.written == 0 {
+		prefix = `{"workouts":[`
+	}
+
+	js, err := json.Marshal(workout)
+	if err != nil {
+		return err
+	}
+
+	_, err = jw.w.WriteString(prefix)
+	if err != nil {
+		return err
+	}
+	_, err = jw.w.Write(js)
+	if err != nil {
+		return err
+	}
+
+	jw.written++
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	suffix := "]}\n"
+	if jw.written == 0 {
+		suffix = `{"workouts":[]}` + "\n"
+	}
+
+	_, err := jw.w.WriteString(suffix)
+	if err != nil {
+		return err
+	}
+	return jw.w.Flush()
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) WriteWorkout(workout *store.Workout) error {
+	return nw.enc.Encode(workout)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.buf.Flush()
+}
+
+func formatInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
@@ -0,0 +1,104 @@
+// Package feed turns followed users' workouts into feed items and encodes
+// the opaque cursors used to page through them.
+package feed
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/analytics"
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+// maxHighlights is how many exercises a summary names.
+const maxHighlights = 3
+
+// Summary is the at-a-glance version of a workout shown in the feed.
+type Summary struct {
+	DurationMinutes int      `json:"duration_minutes"`
+	Exercises       int      `json:"exercises"`
+	Sets            int      `json:"sets"`
+	Volume          float64  `json:"volume"`
+	DistanceMeters  *float64 `json:"distance_meters,omitempty"`
+	// Highlights names the first few exercises in workout order.
+	Highlights []string `json:"highlights"`
+	// Score is the WOD result as written on the whiteboard, if any.
+	Score string `json:"score,omitempty"`
+}
+
+type Item struct {
+	WorkoutID int               `json:"workout_id"`
+	Author    store.UserSummary `json:"author"`
+	Title     string            `json:"title"`
+	StartedAt time.Time         `json:"started_at"`
+	Summary   Summary           `json:"summary"`
+}
+
+// Summarize condenses a workout with its entries. Sets in groups count
+// once per round, like volume.
+func Summarize(w *store.Workout) Summary {
+	s := Summary{
+		DurationMinutes: w.DurationMinutes,
+		Volume:          analytics.WorkoutVolume(w),
+		DistanceMeters:  w.DistanceMeters,
+		Highlights:      []string{},
+	}
+
+	seen := make(map[string]bool)
+	w.EachEntry(func(e *store.WorkoutEntry, group *store.EntryGroup) {
+		s.Sets += e.Sets * analytics.Rounds(group)
+
+		key := strings.ToLower(strings.TrimSpace(e.ExerciseName))
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		s.Exercises++
+		if len(s.Highlights) < maxHighlights {
+			s.Highlights = append(s.Highlights, e.ExerciseName)
+		}
+	})
+
+	if w.WOD != nil {
+		s.Score = w.WOD.String()
+	}
+
+	return s
+}
+
+// NewItem builds the feed item for a workout.
+func NewItem(fw *store.FeedWorkout) Item {
+	return Item{
+		WorkoutID: fw.ID,
+		Author:    fw.Author,
+		Title:     fw.Title,
+		StartedAt: fw.StartedAt,
+		Summary:   Summarize(&fw.Workout),
+	}
+}
+
+// EncodeCursor returns the cursor for the page after w.
+func EncodeCursor(w *store.Workout) string {
+	raw := fmt.Sprintf("%d:%d", w.StartedAt.UnixNano(), w.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor from EncodeCursor.
+func DecodeCursor(cursor string) (*store.FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var nanos int64
+	var id int
+	_, err = fmt.Sscanf(string(raw), "%d:%d", &nanos, &id)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &store.FeedCursor{StartedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
@@ -0,0 +1,348 @@
+// Package fit decodes the subset of Garmin's Flexible and Interoperable Data
+// Transfer (FIT) format needed to import activities: file id, session,
+// lap, record and set messages. All other messages are read and discarded.
+package fit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFIT      = errors.New("fit: not a FIT file")
+	ErrBadChecksum = errors.New("fit: checksum mismatch")
+)
+
+// File holds the decoded messages of one or more chained FIT files.
+type File struct {
+	// FileID is from the first file, nil when it has none.
+	FileID   *FileID
+	Sessions []Session
+	Laps     []Lap
+	Records  []Record
+	Sets     []Set
+}
+
+type fieldDef struct {
+	num      byte
+	size     byte
+	baseType byte
+}
+
+type definition struct {
+	global    uint16
+	byteOrder binary.ByteOrder
+	fields    []fieldDef
+	devSize   int
+}
+
+// message is a decoded data message, keeping only fields with valid values.
+type message struct {
+	global uint16
+	fields map[byte]uint64
+}
+
+func (m message) uint(num byte) uint64 {
+	return m.fields[num]
+}
+
+func (m message) time(num byte) time.Time {
+	v, ok := m.fields[num]
+	if !ok {
+		return time.Time{}
+	}
+	return fitTime(v)
+}
+
+func (m message) millis(num byte) time.Duration {
+	return time.Duration(m.fields[num]) * time.Millisecond
+}
+
+func (m message) scaled(num byte, scale float64) float64 {
+	return float64(m.fields[num]) / scale
+}
+
+type decoder struct {
+	r    *bufio.Reader
+	crc  uint16
+	left uint32 // bytes of record data left in the current file
+
+	defs          [16]*definition
+	lastTimestamp uint32
+
+	file *File
+}
+
+// Decode reads a FIT file from r. Chained files are decoded one after the
+// other into the same result.
+func Decode(r io.Reader) (*File, error) {
+	d := &decoder{
+		r:    bufio.NewReader(r),
+		file: &File{},
+	}
+
+	for first := true; ; first = false {
+		if !first {
+			if _, err := d.r.Peek(1); err == io.EOF {
+				return d.file, nil
+			}
+		}
+
+		err := d.decodeFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *decoder) read(buf []byte) error {
+	_, err := io.ReadFull(d.r, buf)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	d.crc = checksum(d.crc, buf)
+	return nil
+}
+
+// readData reads record bytes, refusing to run past the size in the header.
+func (d *decoder) readData(buf []byte) error {
+	if uint32(len(buf)) > d.left {
+		return fmt.Errorf("fit: record overruns data size")
+	}
+	d.left -= uint32(len(buf))
+	return d.read(buf)
+}
+
+func (d *decoder) decodeFile() error {
+	d.crc = 0
+	d.defs = [16]*definition{}
+	d.lastTimestamp = 0
+
+	size := make([]byte, 1)
+	err := d.read(size)
+	if err != nil {
+		return err
+	}
+	if size[0] != 12 && size[0] != 14 {
+		return ErrNotFIT
+	}
+
+	header := make([]byte, size[0]-1)
+	err = d.read(header)
+	if err != nil {
+		return err
+	}
+	if string(header[7:11]) != ".FIT" {
+		return ErrNotFIT
+	}
+	d.left = binary.LittleEndian.Uint32(header[3:7])
+
+	if size[0] == 14 {
+		headerCRC := binary.LittleEndian.Uint16(header[11:13])
+		if headerCRC != 0 && headerCRC != checksum(0, append(size, header[:11]...)) {
+			return ErrBadChecksum
+		}
+	}
+
+	for d.left > 0 {
+		err = d.decodeRecord()
+		if err != nil {
+			return err
+		}
+	}
+
+	want := d.crc
+	trailer := make([]byte, 2)
+	err = d.read(trailer)
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint16(trailer) != want {
+		return ErrBadChecksum
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeRecord() error {
+	header := make([]byte, 1)
+	err := d.readData(header)
+	if err != nil {
+		return err
+	}
+	h := header[0]
+
+	// compressed timestamp header
+	if h&0x80 != 0 {
+		local := (h >> 5) & 0x03
+		offset := uint32(h & 0x1F)
+		timestamp := d.lastTimestamp&^0x1F + offset
+		if offset < d.lastTimestamp&0x1F {
+			timestamp += 0x20
+		}
+		d.lastTimestamp = timestamp
+
+		return d.decodeData(local, &timestamp)
+	}
+
+	local := h & 0x0F
+	if h&0x40 != 0 {
+		return d.decodeDefinition(local, h&0x20 != 0)
+	}
+
+	return d.decodeData(local, nil)
+}
+
+func (d *decoder) decodeDefinition(local byte, hasDevFields bool) error {
+	fixed := make([]byte, 5)
+	err := d.readData(fixed)
+	if err != nil {
+		return err
+	}
+
+	def := &definition{byteOrder: binary.LittleEndian}
+	if fixed[1] == 1 {
+		def.byteOrder = binary.BigEndian
+	}
+	def.global = def.byteOrder.Uint16(fixed[2:4])
+
+	fields := make([]byte, int(fixed[4])*3)
+	err = d.readData(fields)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fieldDef{
+			num:      fields[i],
+			size:     fields[i+1],
+			baseType: fields[i+2],
+		})
+	}
+
+	if hasDevFields {
+		count := make([]byte, 1)
+		err = d.readData(count)
+		if err != nil {
+			return err
+		}
+
+		devFields := make([]byte, int(count[0])*3)
+		err = d.readData(devFields)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(devFields); i += 3 {
+			def.devSize += int(devFields[i+1])
+		}
+	}
+
+	d.defs[local] = def
+	return nil
+}
+
+func (d *decoder) decodeData(local byte, timestamp *uint32) error {
+	def := d.defs[local]
+	if def == nil {
+		return fmt.Errorf("fit: data message for undefined local type %d", local)
+	}
+
+	msg := message{global: def.global, fields: make(map[byte]uint64, len(def.fields))}
+	for _, f := range def.fields {
+		buf := make([]byte, f.size)
+		err := d.readData(buf)
+		if err != nil {
+			return err
+		}
+
+		v, ok := decodeValue(buf, f.baseType, def.byteOrder)
+		if !ok {
+			continue
+		}
+		msg.fields[f.num] = v
+
+		if f.num == fieldTimestamp {
+			d.lastTimestamp = uint32(v)
+		}
+	}
+
+	if def.devSize > 0 {
+		err := d.readData(make([]byte, def.devSize))
+		if err != nil {
+			return err
+		}
+	}
+
+	if timestamp != nil {
+		msg.fields[fieldTimestamp] = uint64(*timestamp)
+	}
+
+	switch msg.global {
+	case mesgFileID:
+		if d.file.FileID == nil {
+			id := newFileID(msg)
+			d.file.FileID = &id
+		}
+	case mesgSession:
+		d.file.Sessions = append(d.file.Sessions, newSession(msg))
+	case mesgLap:
+		d.file.Laps = append(d.file.Laps, newLap(msg))
+	case mesgRecord:
+		d.file.Records = append(d.file.Records, newRecord(msg))
+	case mesgSet:
+		d.file.Sets = append(d.file.Sets, newSet(msg))
+	}
+
+	return nil
+}
+
+// baseTypes maps the FIT integer base types to their size in bytes and the
+// value devices use to mark the field as not set.
+var baseTypes = map[byte]struct {
+	size    int
+	invalid uint64
+}{
+	0x00: {1, 0xFF},               // enum
+	0x01: {1, 0x7F},               // sint8
+	0x02: {1, 0xFF},               // uint8
+	0x03: {2, 0x7FFF},             // sint16
+	0x04: {2, 0xFFFF},             // uint16
+	0x05: {4, 0x7FFFFFFF},         // sint32
+	0x06: {4, 0xFFFFFFFF},         // uint32
+	0x0A: {1, 0},                  // uint8z
+	0x0B: {2, 0},                  // uint16z
+	0x0C: {4, 0},                  // uint32z
+	0x0E: {8, 0x7FFFFFFFFFFFFFFF}, // sint64
+	0x0F: {8, 0xFFFFFFFFFFFFFFFF}, // uint64
+	0x10: {8, 0},                  // uint64z
+}
+
+// decodeValue decodes the first element of a field as an unsigned integer
+// and reports whether it holds a valid value for its base type. Strings,
+// floats and byte arrays are never needed for import and are skipped.
+func decodeValue(buf []byte, baseType byte, order binary.ByteOrder) (uint64, bool) {
+	bt, ok := baseTypes[baseType&0x1F]
+	if !ok || len(buf) < bt.size {
+		return 0, false
+	}
+
+	var v uint64
+	switch bt.size {
+	case 1:
+		v = uint64(buf[0])
+	case 2:
+		v = uint64(order.Uint16(buf))
+	case 4:
+		v = uint64(order.Uint32(buf))
+	case 8:
+		v = order.Uint64(buf)
+	}
+
+	return v, v != bt.invalid
+}
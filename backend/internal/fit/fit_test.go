@@ -0,0 +1,291 @@
+package fit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cardio.fit is a one-minute run: a file id, a full record followed by
+// twelve records with compressed timestamps (crossing two 32-second
+// rollovers), two laps and a session.
+//
+// strength.fit is a strength session: a file id, six sets whose
+// definition carries developer fields, and a session written big-endian.
+
+var (
+	cardioStart   = time.Date(2024, time.March, 10, 8, 0, 0, 0, time.UTC)
+	strengthStart = time.Date(2024, time.March, 11, 18, 30, 0, 0, time.UTC)
+)
+
+func readTestFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decodeTestFile(t *testing.T, name string) *File {
+	t.Helper()
+
+	file, err := Decode(bytes.NewReader(readTestFile(t, name)))
+	if err != nil {
+		t.Fatalf("Decode(%s): %v", name, err)
+	}
+	return file
+}
+
+func TestDecodeCardio(t *testing.T) {
+	file := decodeTestFile(t, "cardio.fit")
+
+	wantID := FileID{Manufacturer: 1, Product: 3113, SerialNumber: 3912345678, TimeCreated: cardioStart}
+	if file.FileID == nil || *file.FileID != wantID {
+		t.Errorf("FileID = %+v, want %+v", file.FileID, wantID)
+	}
+
+	wantSessions := []Session{{
+		Timestamp:        cardioStart.Add(60 * time.Second),
+		StartTime:        cardioStart,
+		Sport:            SportRunning,
+		TotalElapsedTime: 60 * time.Second,
+		TotalTimerTime:   59500 * time.Millisecond,
+		TotalDistance:    180,
+		TotalCalories:    25,
+		AvgHeartRate:     126,
+		MaxHeartRate:     132,
+	}}
+	if len(file.Sessions) != len(wantSessions) || file.Sessions[0] != wantSessions[0] {
+		t.Errorf("Sessions = %+v, want %+v", file.Sessions, wantSessions)
+	}
+	if file.Sessions[0].IsStrength() {
+		t.Error("running session reports IsStrength")
+	}
+
+	wantLaps := []Lap{
+		{
+			Timestamp:        cardioStart.Add(30 * time.Second),
+			StartTime:        cardioStart,
+			TotalElapsedTime: 30 * time.Second,
+			TotalTimerTime:   30 * time.Second,
+			TotalDistance:    90,
+			TotalCalories:    12,
+			AvgHeartRate:     123,
+			MaxHeartRate:     126,
+		},
+		{
+			// calories are written as the invalid value, so they stay zero
+			Timestamp:        cardioStart.Add(60 * time.Second),
+			StartTime:        cardioStart.Add(30 * time.Second),
+			TotalElapsedTime: 30 * time.Second,
+			TotalTimerTime:   29500 * time.Millisecond,
+			TotalDistance:    90,
+			AvgHeartRate:     129,
+			MaxHeartRate:     132,
+		},
+	}
+	if len(file.Laps) != len(wantLaps) {
+		t.Fatalf("got %d laps, want %d", len(file.Laps), len(wantLaps))
+	}
+	for i := range wantLaps {
+		if file.Laps[i] != wantLaps[i] {
+			t.Errorf("Laps[%d] = %+v, want %+v", i, file.Laps[i], wantLaps[i])
+		}
+	}
+
+	if len(file.Records) != 13 {
+		t.Fatalf("got %d records, want 13", len(file.Records))
+	}
+	for i, record := range file.Records {
+		want := Record{
+			Timestamp: cardioStart.Add(time.Duration(5*i) * time.Second),
+			HeartRate: 120 + i,
+			Distance:  float64(15 * i),
+			Speed:     3,
+		}
+		if record != want {
+			t.Errorf("Records[%d] = %+v, want %+v", i, record, want)
+		}
+	}
+
+	if len(file.Sets) != 0 {
+		t.Errorf("got %d sets, want none", len(file.Sets))
+	}
+}
+
+func TestDecodeStrength(t *testing.T) {
+	file := decodeTestFile(t, "strength.fit")
+
+	if file.FileID == nil || file.FileID.SerialNumber != 1234567890 {
+		t.Errorf("FileID = %+v, want serial number 1234567890", file.FileID)
+	}
+
+	wantSession := Session{
+		Timestamp:        strengthStart.Add(520 * time.Second),
+		StartTime:        strengthStart,
+		Sport:            SportTraining,
+		SubSport:         SubSportStrengthTraining,
+		TotalElapsedTime: 520 * time.Second,
+		TotalTimerTime:   500 * time.Second,
+		TotalCalories:    85,
+	}
+	if len(file.Sessions) != 1 || file.Sessions[0] != wantSession {
+		t.Fatalf("Sessions = %+v, want [%+v]", file.Sessions, wantSession)
+	}
+	if !file.Sessions[0].IsStrength() {
+		t.Error("strength session does not report IsStrength")
+	}
+
+	at := func(seconds int) time.Time {
+		return strengthStart.Add(time.Duration(seconds) * time.Second)
+	}
+	wantSets := []struct {
+		set  Set
+		name string
+	}{
+		{Set{Timestamp: at(40), StartTime: at(0), Duration: 40 * time.Second, Repetitions: 8, Weight: 80, Type: SetTypeActive, Category: 0}, "Bench Press"},
+		{Set{Timestamp: at(130), StartTime: at(40), Duration: 90 * time.Second, Type: SetTypeRest, Category: CategoryUnknown}, "Unknown Exercise"},
+		{Set{Timestamp: at(170), StartTime: at(130), Duration: 40 * time.Second, Repetitions: 8, Weight: 80, Type: SetTypeActive, Category: 0}, "Bench Press"},
+		{Set{Timestamp: at(300), StartTime: at(255), Duration: 45 * time.Second, Repetitions: 5, Weight: 100, Type: SetTypeActive, Category: 28}, "Squat"},
+		{Set{Timestamp: at(420), StartTime: at(360), Duration: 60 * time.Second, Type: SetTypeActive, Category: 19}, "Plank"},
+		{Set{Timestamp: at(500), StartTime: at(470), Duration: 30 * time.Second, Repetitions: 10, Type: SetTypeActive, Category: CategoryUnknown}, "Unknown Exercise"},
+	}
+	if len(file.Sets) != len(wantSets) {
+		t.Fatalf("got %d sets, want %d", len(file.Sets), len(wantSets))
+	}
+	for i, want := range wantSets {
+		if file.Sets[i] != want.set {
+			t.Errorf("Sets[%d] = %+v, want %+v", i, file.Sets[i], want.set)
+		}
+		if name := file.Sets[i].Category.String(); name != want.name {
+			t.Errorf("Sets[%d].Category.String() = %q, want %q", i, name, want.name)
+		}
+	}
+
+	if len(file.Laps) != 0 || len(file.Records) != 0 {
+		t.Errorf("got %d laps and %d records, want none", len(file.Laps), len(file.Records))
+	}
+}
+
+func TestDecodeChained(t *testing.T) {
+	data := append(readTestFile(t, "cardio.fit"), readTestFile(t, "strength.fit")...)
+
+	file, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if len(file.Sessions) != 2 || len(file.Records) != 13 || len(file.Sets) != 6 {
+		t.Errorf("got %d sessions, %d records and %d sets, want 2, 13 and 6", len(file.Sessions), len(file.Records), len(file.Sets))
+	}
+	if file.FileID == nil || file.FileID.SerialNumber != 3912345678 {
+		t.Errorf("FileID = %+v, want the first file's", file.FileID)
+	}
+}
+
+// TestCompressedTimestamps checks the rollover rule on its own: an offset
+// smaller than the low five bits of the last timestamp means the counter
+// wrapped into the next 32 seconds.
+func TestCompressedTimestamps(t *testing.T) {
+	tests := []struct {
+		last   uint32
+		offset byte
+		want   uint32
+	}{
+		{last: 0x40, offset: 0x05, want: 0x45},
+		{last: 0x45, offset: 0x05, want: 0x45},
+		{last: 0x45, offset: 0x1F, want: 0x5F},
+		{last: 0x5E, offset: 0x03, want: 0x63},
+		{last: 0x5F, offset: 0x00, want: 0x60},
+	}
+
+	for _, tt := range tests {
+		d := &decoder{
+			r:             bufio.NewReader(bytes.NewReader([]byte{0x80 | 1<<5 | tt.offset})),
+			left:          1,
+			lastTimestamp: tt.last,
+			file:          &File{},
+		}
+		d.defs[1] = &definition{global: mesgRecord}
+
+		err := d.decodeRecord()
+		if err != nil {
+			t.Fatalf("last %#x offset %#x: %v", tt.last, tt.offset, err)
+		}
+
+		if d.lastTimestamp != tt.want {
+			t.Errorf("last %#x offset %#x: timestamp %#x, want %#x", tt.last, tt.offset, d.lastTimestamp, tt.want)
+		}
+		if got := d.file.Records[0].Timestamp; !got.Equal(fitTime(uint64(tt.want))) {
+			t.Errorf("last %#x offset %#x: record at %v, want %v", tt.last, tt.offset, got, fitTime(uint64(tt.want)))
+		}
+	}
+}
+
+func TestDecodeBadChecksum(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset func(data []byte) int
+	}{
+		{"file CRC", func(data []byte) int { return len(data) - 1 }},
+		{"header CRC", func(data []byte) int { return 12 }},
+		// the heart rate of the first record, which decodes fine but no
+		// longer matches the file CRC
+		{"record data", func(data []byte) int {
+			i := bytes.Index(data, []byte{0x01, 0x80, 0x1C, 0x50, 0x40, 0x78})
+			if i < 0 {
+				return i
+			}
+			return i + 5
+		}},
+	}
+
+	for _, tt := range tests {
+		data := readTestFile(t, "cardio.fit")
+		i := tt.offset(data)
+		if i < 0 {
+			t.Fatalf("%s: byte to corrupt not found", tt.name)
+		}
+		data[i] ^= 0xFF
+
+		_, err := Decode(bytes.NewReader(data))
+		if !errors.Is(err, ErrBadChecksum) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, ErrBadChecksum)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, name := range []string{"cardio.fit", "strength.fit"} {
+		data := readTestFile(t, name)
+
+		// inside the header, inside the records and just short of the CRC
+		for _, n := range []int{5, len(data) / 2, len(data) - 1} {
+			_, err := Decode(bytes.NewReader(data[:n]))
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("%s cut to %d bytes: got error %v, want %v", name, n, err, io.ErrUnexpectedEOF)
+			}
+		}
+	}
+}
+
+func TestDecodeNotFIT(t *testing.T) {
+	inputs := [][]byte{
+		[]byte("<?xml version=\"1.0\"?><gpx></gpx>"),
+		append([]byte{14, 0x20, 0x54, 0x08, 0, 0, 0, 0}, []byte(".GPX\x00\x00")...),
+	}
+
+	for _, input := range inputs {
+		_, err := Decode(bytes.NewReader(input))
+		if !errors.Is(err, ErrNotFIT) {
+			t.Errorf("Decode(%q): got error %v, want %v", input, err, ErrNotFIT)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package fit
+
+import (
+	"strings"
+	"time"
+)
+
+// Global message numbers from the FIT profile that we decode.
+const (
+	mesgFileID  = 0
+	mesgSession = 18
+	mesgLap     = 19
+	mesgRecord  = 20
+	mesgSet     = 225
+)
+
+// fieldTimestamp is the timestamp field number shared by most messages.
+const fieldTimestamp = 253
+
+// FIT timestamps count seconds from 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+func fitTime(v uint64) time.Time {
+	return fitEpoch.Add(time.Duration(v) * time.Second).UTC()
+}
+
+type Sport uint8
+
+const (
+	SportGeneric          Sport = 0
+	SportRunning          Sport = 1
+	SportCycling          Sport = 2
+	SportFitnessEquipment Sport = 4
+	SportSwimming         Sport = 5
+	SportTraining         Sport = 10
+	SportWalking          Sport = 11
+	SportRowing           Sport = 15
+	SportHiking           Sport = 17
+)
+
+var sportNames = map[Sport]string{
+	SportGeneric:          "Workout",
+	SportRunning:          "Running",
+	SportCycling:          "Cycling",
+	SportFitnessEquipment: "Fitness Equipment",
+	SportSwimming:         "Swimming",
+	SportTraining:         "Training",
+	SportWalking:          "Walking",
+	SportRowing:           "Rowing",
+	SportHiking:           "Hiking",
+}
+
+func (s Sport) String() string {
+	if name, ok := sportNames[s]; ok {
+		return name
+	}
+	return sportNames[SportGeneric]
+}
+
+// SubSportStrengthTraining is the sub sport Garmin devices record for
+// strength activities, usually alongside SportTraining.
+const SubSportStrengthTraining = 20
+
+type SetType uint8
+
+const (
+	SetTypeRest   SetType = 0
+	SetTypeActive SetType = 1
+)
+
+type ExerciseCategory uint16
+
+// CategoryUnknown is used by devices when the athlete did not pick an
+// exercise for a set.
+const CategoryUnknown ExerciseCategory = 65534
+
+var exerciseCategoryNames = []string{
+	"bench_press", "calf_raise", "cardio", "carry", "chop", "core", "crunch",
+	"curl", "deadlift", "flye", "hip_raise", "hip_stability", "hip_swing",
+	"hyperextension", "lateral_raise", "leg_curl", "leg_raise", "lunge",
+	"olympic_lift", "plank", "plyo", "pull_up", "push_up", "row",
+	"shoulder_press", "shoulder_stability", "shrug", "sit_up", "squat",
+	"total_body", "triceps_extension", "warm_up", "run",
+}
+
+// String returns a human readable exercise name, e.g. "Bench Press".
+func (c ExerciseCategory) String() string {
+	if int(c) >= len(exerciseCategoryNames) {
+		return "Unknown Exercise"
+	}
+
+	words := strings.Split(exerciseCategoryNames[c], "_")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// FileID identifies the device that wrote a file and when. Zero values
+// mean the device did not record the field.
+type FileID struct {
+	Manufacturer int
+	Product      int
+	SerialNumber uint32
+	TimeCreated  time.Time
+}
+
+// Session summarises one activity in the file. Zero values mean the device
+// did not record the field.
+type Session struct {
+	Timestamp        time.Time
+	StartTime        time.Time
+	Sport            Sport
+	SubSport         uint8
+	TotalElapsedTime time.Duration
+	TotalTimerTime   time.Duration
+	TotalDistance    float64 // meters
+	TotalCalories    int
+	AvgHeartRate     int
+	MaxHeartRate     int
+}
+
+// IsStrength reports whether the session was recorded as strength training.
+func (s *Session) IsStrength() bool {
+	return s.SubSport == SubSportStrengthTraining
+}
+
+// Lap is a split within a session.
+type Lap struct {
+	Timestamp        time.Time
+	StartTime        time.Time
+	TotalElapsedTime time.Duration
+	TotalTimerTime   time.Duration
+	TotalDistance    float64 // meters
+	TotalCalories    int
+	AvgHeartRate     int
+	MaxHeartRate     int
+}
+
+// Record is a single sample, usually taken once per second.
+type Record struct {
+	Timestamp time.Time
+	HeartRate int
+	Distance  float64 // meters
+	Speed     float64 // meters per second
+}
+
+// Set is one strength training set.
+type Set struct {
+	Timestamp   time.Time
+	StartTime   time.Time
+	Duration    time.Duration
+	Repetitions int
+	Weight      float64 // kilograms
+	Type        SetType
+	Category    ExerciseCategory
+}
+
+func newFileID(m message) FileID {
+	return FileID{
+		Manufacturer: int(m.uint(1)),
+		Product:      int(m.uint(2)),
+		SerialNumber: uint32(m.uint(3)),
+		TimeCreated:  m.time(4),
+	}
+}
+
+func newSession(m message) Session {
+	return Session{
+		Timestamp:        m.time(fieldTimestamp),
+		StartTime:        m.time(2),
+		Sport:            Sport(m.uint(5)),
+		SubSport:         uint8(m.uint(6)),
+		TotalElapsedTime: m.millis(7),
+		TotalTimerTime:   m.millis(8),
+		TotalDistance:    m.scaled(9, 100),
+		TotalCalories:    int(m.uint(11)),
+		AvgHeartRate:     int(m.uint(16)),
+		MaxHeartRate:     int(m.uint(17)),
+	}
+}
+
+func newLap(m message) Lap {
+	return Lap{
+		Timestamp:        m.time(fieldTimestamp),
+		StartTime:        m.time(2),
+		TotalElapsedTime: m.millis(7),
+		TotalTimerTime:   m.millis(8),
+		TotalDistance:    m.scaled(9, 100),
+		TotalCalories:    int(m.uint(11)),
+		AvgHeartRate:     int(m.uint(15)),
+		MaxHeartRate:     int(m.uint(16)),
+	}
+}
+
+func newRecord(m message) Record {
+	return Record{
+		Timestamp: m.time(fieldTimestamp),
+		HeartRate: int(m.uint(3)),
+		Distance:  m.scaled(5, 100),
+		Speed:     m.scaled(6, 1000),
+	}
+}
+
+func newSet(m message) Set {
+	category := CategoryUnknown
+	if v, ok := m.fields[7]; ok {
+		category = ExerciseCategory(v)
+	}
+	setType := SetTypeActive
+	if v, ok := m.fields[5]; ok {
+		setType = SetType(v)
+	}
+
+	return Set{
+		// set messages carry their timestamp in field 254 rather than 253
+		Timestamp:   m.time(254),
+		StartTime:   m.time(6),
+		Duration:    m.millis(0),
+		Repetitions: int(m.uint(3)),
+		Weight:      m.scaled(4, 16),
+		Type:        setType,
+		Category:    category,
+	}
+}
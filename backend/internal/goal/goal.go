@@ -0,0 +1,77 @@
+// Package goal reports how far along a goal is and when, at the current
+// pace, it will be reached.
+package goal
+
+import (
+	"math"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+const (
+	StatusActive   = "active"
+	StatusAchieved = "achieved"
+	StatusMissed   = "missed"
+)
+
+type Progress struct {
+	Status string `json:"status"`
+	// Required is the value to reach; see store.GoalRequired.
+	Required float64 `json:"required"`
+	Percent  float64 `json:"percent"`
+	// ProjectedAt is when the goal will be reached if progress continues
+	// at its average pace so far, nil when there is no progress to go on.
+	ProjectedAt *time.Time `json:"projected_at"`
+	// OnTrack reports whether ProjectedAt falls before the deadline.
+	OnTrack bool `json:"on_track"`
+}
+
+// Evaluate computes a goal's progress as of now.
+func Evaluate(g *store.Goal, now time.Time) Progress {
+	p := Progress{Required: round(store.GoalRequired(g))}
+
+	switch {
+	case g.AchievedAt != nil:
+		p.Status = StatusAchieved
+	case !now.Before(g.EndsAt):
+		p.Status = StatusMissed
+	default:
+		p.Status = StatusActive
+	}
+
+	// progress runs from the start value to the required value, which for
+	// a weight-loss goal means downwards
+	distance := p.Required - g.StartValue
+	done := g.CurrentValue - g.StartValue
+	switch {
+	case p.Status == StatusAchieved:
+		p.Percent = 100
+	case distance != 0:
+		p.Percent = round(math.Max(0, math.Min(100, done/distance*100)))
+	}
+
+	if p.Status == StatusAchieved {
+		p.ProjectedAt = g.AchievedAt
+		p.OnTrack = true
+		return p
+	}
+	if p.Status == StatusMissed {
+		return p
+	}
+
+	elapsed := now.Sub(g.StartsAt)
+	if elapsed <= 0 || distance == 0 || done/distance <= 0 {
+		return p
+	}
+	remaining := time.Duration(float64(elapsed) * (distance - done) / done)
+	projected := now.Add(remaining)
+	p.ProjectedAt = &projected
+	p.OnTrack = projected.Before(g.EndsAt)
+
+	return p
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
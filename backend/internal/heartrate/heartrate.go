@@ -0,0 +1,258 @@
+// Package heartrate computes training zones, time-in-zone breakdowns and
+// TRIMP training load from heart-rate data.
+package heartrate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Zone models a user can pick for their profile.
+const (
+	// ModelPercentMax is the classic 5-zone model at 50/60/70/80/90% of max HR.
+	ModelPercentMax = "percent_max"
+	// ModelKarvonen applies the same percentages to heart-rate reserve
+	// (max HR - resting HR) on top of resting HR.
+	ModelKarvonen = "karvonen"
+	// ModelThreshold derives zones from lactate-threshold HR (Friel).
+	ModelThreshold = "threshold"
+)
+
+// DefaultRestingHR is assumed for TRIMP when the profile has no resting HR.
+const DefaultRestingHR = 60
+
+// MaxSampleGap caps how long a single sample is assumed to last, so a watch
+// that dropped out for a few minutes does not inflate a zone.
+const MaxSampleGap = 10
+
+// Banister's weighting: a minute at heart-rate reserve r adds
+// r × TRIMPFactor × e^(TRIMPExponent × r) to TRIMP.
+const (
+	TRIMPFactor   = 0.64
+	TRIMPExponent = 1.92
+)
+
+var ErrIncompleteProfile = errors.New("heart-rate profile is incomplete for this zone model")
+
+type Profile struct {
+	MaxHR       int    `json:"max_heart_rate"`
+	RestingHR   int    `json:"resting_heart_rate"`
+	ThresholdHR int    `json:"threshold_heart_rate"`
+	Model       string `json:"zone_model"`
+}
+
+func (p Profile) Validate() error {
+	switch p.Model {
+	case ModelPercentMax, ModelKarvonen, ModelThreshold:
+	default:
+		return fmt.Errorf("zone model must be one of %s, %s or %s", ModelPercentMax, ModelKarvonen, ModelThreshold)
+	}
+
+	rates := []struct {
+		name string
+		bpm  int
+	}{
+		{"max heart rate", p.MaxHR},
+		{"resting heart rate", p.RestingHR},
+		{"threshold heart rate", p.ThresholdHR},
+	}
+	for _, rate := range rates {
+		if rate.bpm != 0 && (rate.bpm < 30 || rate.bpm > 250) {
+			return fmt.Errorf("%s must be between 30 and 250 bpm", rate.name)
+		}
+	}
+
+	if p.MaxHR != 0 && p.RestingHR >= p.MaxHR {
+		return errors.New("resting heart rate must be below max heart rate")
+	}
+	if p.MaxHR != 0 && p.ThresholdHR > p.MaxHR {
+		return errors.New("threshold heart rate must not exceed max heart rate")
+	}
+
+	return nil
+}
+
+// Zone is an inclusive bpm range. The top zone has no upper bound.
+type Zone struct {
+	Number int `json:"zone"`
+	MinBPM int `json:"min_bpm"`
+	MaxBPM int `json:"max_bpm,omitempty"`
+}
+
+func (z Zone) contains(bpm int) bool {
+	return bpm >= z.MinBPM && (z.MaxBPM == 0 || bpm <= z.MaxBPM)
+}
+
+var percentBounds = []float64{0.50, 0.60, 0.70, 0.80, 0.90}
+
+// thresholdBounds are the lower bounds of Friel's five zones as a fraction
+// of lactate-threshold HR.
+var thresholdBounds = []float64{0.0, 0.85, 0.90, 0.95, 1.00}
+
+// Zones returns the five zones of the profile's model. Heart rates below
+// zone 1 fall outside every zone.
+func Zones(p Profile) ([]Zone, error) {
+	var lower []int
+
+	switch p.Model {
+	case ModelPercentMax:
+		if p.MaxHR == 0 {
+			return nil, ErrIncompleteProfile
+		}
+		for _, pct := range percentBounds {
+			lower = append(lower, int(math.Round(pct*float64(p.MaxHR))))
+		}
+	case ModelKarvonen:
+		if p.MaxHR == 0 || p.RestingHR == 0 {
+			return nil, ErrIncompleteProfile
+		}
+		reserve := float64(p.MaxHR - p.RestingHR)
+		for _, pct := range percentBounds {
+			lower = append(lower, p.RestingHR+int(math.Round(pct*reserve)))
+		}
+	case ModelThreshold:
+		if p.ThresholdHR == 0 {
+			return nil, ErrIncompleteProfile
+		}
+		for _, pct := range thresholdBounds {
+			lower = append(lower, int(math.Round(pct*float64(p.ThresholdHR))))
+		}
+	default:
+		return nil, fmt.Errorf("unknown zone model %q", p.Model)
+	}
+
+	zones := make([]Zone, len(lower))
+	for i := range lower {
+		zones[i] = Zone{Number: i + 1, MinBPM: lower[i]}
+		if i+1 < len(lower) {
+			zones[i].MaxBPM = lower[i+1] - 1
+		}
+	}
+
+	return zones, nil
+}
+
+// Sample is one heart-rate reading, offset from the start of a workout.
+type Sample struct {
+	OffsetSeconds int `json:"offset_seconds"`
+	BPM           int `json:"bpm"`
+}
+
+// Load is a workout's series reduced to its TRIMP and time in zones, for
+// when the samples themselves aren't needed.
+type Load struct {
+	TRIMP       float64
+	TimeInZones []ZoneTime
+}
+
+// ZoneTime is the time spent in one zone.
+type ZoneTime struct {
+	Zone    int `json:"zone"`
+	Seconds int `json:"seconds"`
+}
+
+// TimeInZones attributes each sample's duration (up to the next sample) to
+// the zone it falls in. Samples must be ordered by offset.
+func TimeInZones(samples []Sample, zones []Zone) []ZoneTime {
+	result := make([]ZoneTime, len(zones))
+	for i, z := range zones {
+		result[i].Zone = z.Number
+	}
+
+	for i, s := range samples {
+		seconds := sampleSeconds(samples, i)
+		for j, z := range zones {
+			if z.contains(s.BPM) {
+				result[j].Seconds += seconds
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// AddZoneTimes adds b into a, matching zones by number.
+func AddZoneTimes(a, b []ZoneTime) []ZoneTime {
+	for _, zt := range b {
+		found := false
+		for i := range a {
+			if a[i].Zone == zt.Zone {
+				a[i].Seconds += zt.Seconds
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, zt)
+		}
+	}
+	return a
+}
+
+// TRIMP computes Banister's training impulse from a heart-rate series.
+func TRIMP(samples []Sample, p Profile) float64 {
+	if p.MaxHR == 0 {
+		return 0
+	}
+
+	var total float64
+	for i, s := range samples {
+		total += banister(float64(sampleSeconds(samples, i))/60, s.BPM, p)
+	}
+	return total
+}
+
+// TRIMPFromAverage approximates TRIMP when only the average HR is known.
+func TRIMPFromAverage(avgHR, durationMinutes int, p Profile) float64 {
+	if p.MaxHR == 0 || avgHR == 0 {
+		return 0
+	}
+	return banister(float64(durationMinutes), avgHR, p)
+}
+
+// Reserve returns the resting and max HR that TRIMP measures heart-rate
+// reserve between, falling back to DefaultRestingHR. ok is false when the
+// profile gives no reserve to measure.
+func (p Profile) Reserve() (resting, maxHR int, ok bool) {
+	resting = p.RestingHR
+	if resting == 0 {
+		resting = DefaultRestingHR
+	}
+	return resting, p.MaxHR, p.MaxHR > resting
+}
+
+func banister(minutes float64, bpm int, p Profile) float64 {
+	resting, maxHR, ok := p.Reserve()
+	if !ok {
+		return 0
+	}
+
+	reserve := float64(bpm-resting) / float64(maxHR-resting)
+	reserve = math.Max(0, math.Min(1, reserve))
+
+	return minutes * reserve * TRIMPFactor * math.Exp(TRIMPExponent*reserve)
+}
+
+func sampleSeconds(samples []Sample, i int) int {
+	if i+1 == len(samples) {
+		return 1
+	}
+	gap := samples[i+1].OffsetSeconds - samples[i].OffsetSeconds
+	return max(0, min(gap, MaxSampleGap))
+}
+
+// Summary returns the average and max bpm of a series.
+func Summary(samples []Sample) (avg, maxBPM int) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+
+	var sum int
+	for _, s := range samples {
+		sum += s.BPM
+		maxBPM = max(maxBPM, s.BPM)
+	}
+	return int(math.Round(float64(sum) / float64(len(samples)))), maxBPM
+}
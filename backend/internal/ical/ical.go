@@ -0,0 +1,126 @@
+// Package ical writes RFC 5545 iCalendar feeds. Only the parts calendar
+// clients need for a read-only subscription are supported: a VCALENDAR of
+// VEVENTs with UTC times.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	utcLayout = "20060102T150405Z"
+	// lines longer than this many octets must be folded (RFC 5545 3.1)
+	maxLineOctets = 75
+)
+
+// Event is a single VEVENT. A zero End leaves the event without a
+// duration.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	// Status is one of "CONFIRMED", "TENTATIVE" or "CANCELLED"; empty
+	// omits the property.
+	Status string
+}
+
+// Writer streams a calendar to an io.Writer, one event at a time.
+type Writer struct {
+	w     *bufio.Writer
+	stamp time.Time
+}
+
+// NewWriter writes the calendar header. name is shown by clients as the
+// calendar's title.
+func NewWriter(w io.Writer, name string) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w), stamp: time.Now()}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//goworkout//goworkout//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.line("X-WR-CALNAME:" + Escape(name))
+
+	return cw, cw.err()
+}
+
+// WriteEvent writes one VEVENT.
+func (cw *Writer) WriteEvent(e *Event) error {
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + Escape(e.UID))
+	cw.line("DTSTAMP:" + FormatTime(cw.stamp))
+	cw.line("DTSTART:" + FormatTime(e.Start))
+	if !e.End.IsZero() {
+		cw.line("DTEND:" + FormatTime(e.End))
+	}
+	cw.line("SUMMARY:" + Escape(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION:" + Escape(e.Description))
+	}
+	if e.Status != "" {
+		cw.line("STATUS:" + e.Status)
+	}
+	cw.line("END:VEVENT")
+
+	return cw.err()
+}
+
+// Close writes the calendar footer and flushes.
+func (cw *Writer) Close() error {
+	cw.line("END:VCALENDAR")
+	return cw.w.Flush()
+}
+
+// line writes a content line, folding it into chunks of at most 75 octets
+// without splitting UTF-8 sequences. Continuation lines start with a
+// space, which counts towards their length.
+func (cw *Writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		cw.w.WriteString(s[:cut])
+		cw.w.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	cw.w.WriteString(s)
+	cw.w.WriteString("\r\n")
+}
+
+// err reports a write error; bufio.Writer keeps the first one and turns
+// later writes into no-ops.
+func (cw *Writer) err() error {
+	_, err := cw.w.Write(nil)
+	return err
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// Escape escapes a TEXT property value.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// FormatTime formats t as a UTC DATE-TIME.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(utcLayout)
+}
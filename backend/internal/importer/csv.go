@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kgPerLb     = 0.45359237
+	metersPerMi = 1609.344
+)
+
+// csvTable reads a CSV file with a header row, giving access to fields by
+// column name.
+type csvTable struct {
+	r    *csv.Reader
+	cols map[string]int
+}
+
+// record is one data row of a csvTable.
+type record struct {
+	fields []string
+	cols   map[string]int
+	line   int
+	// comma is the file's delimiter, which tells which decimal mark its
+	// numbers use.
+	comma rune
+}
+
+// newCSVTable reads the header and detects whether the file uses commas or
+// semicolons; Strong switches to semicolons in some locales.
+func newCSVTable(r io.Reader, required ...string) (*csvTable, error) {
+	br := bufio.NewReader(r)
+	firstLine, err := br.Peek(br.Size())
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if i := strings.IndexByte(string(firstLine), '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	cr := csv.NewReader(br)
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file is empty")
+		}
+		return nil, err
+	}
+
+	t := &csvTable{r: cr, cols: make(map[string]int, len(header))}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		t.cols[name] = i
+	}
+
+	for _, name := range required {
+		if !t.has(name) {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *csvTable) has(name string) bool {
+	_, ok := t.cols[name]
+	return ok
+}
+
+// next returns the next row, or io.EOF.
+func (t *csvTable) next() (*record, error) {
+	fields, err := t.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := t.r.FieldPos(0)
+	return &record{fields: fields, cols: t.cols, line: line, comma: t.r.Comma}, nil
+}
+
+// get returns the trimmed value of the first of names present in the file.
+func (rec *record) get(names ...string) string {
+	for _, name := range names {
+		i, ok := rec.cols[name]
+		if ok && i < len(rec.fields) {
+			return strings.TrimSpace(rec.fields[i])
+		}
+	}
+	return ""
+}
+
+func (rec *record) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", rec.line, fmt.Sprintf(format, args...))
+}
+
+// optionalInt parses a whole number, treating blanks and zero as absent.
+func (rec *record) optionalInt(column string, value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, rec.errorf("invalid %s %q", column, value)
+	}
+	if f <= 0 {
+		return nil, nil
+	}
+	i := int(f)
+	return &i, nil
+}
+
+// optionalFloat parses a decimal written with the file's decimal mark
+// (see normalizeDecimal) and scales it by factor. Blanks and zero are
+// treated as absent.
+func (rec *record) optionalFloat(column string, value string, factor float64) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	normalized, ok := normalizeDecimal(value, rec.comma)
+	if !ok {
+		return nil, rec.errorf("invalid %s %q", column, value)
+	}
+	f, err := strconv.ParseFloat(normalized, 64)
+	if err != nil {
+		return nil, rec.errorf("invalid %s %q", column, value)
+	}
+	if f <= 0 {
+		return nil, nil
+	}
+	f *= factor
+	return &f, nil
+}
+
+// normalizeDecimal rewrites value with a dot as the decimal mark. Apps
+// only switch to semicolon delimiters in locales that write "1.234,5", so
+// in a semicolon file the comma is the decimal mark and dots group
+// thousands; in a comma file it is the other way round ("1,234.5"). The
+// grouping mark is dropped, and must split the whole part into groups of
+// three digits.
+func normalizeDecimal(value string, comma rune) (string, bool) {
+	decimal, grouping := ".", ","
+	if comma == ';' {
+		decimal, grouping = ",", "."
+	}
+
+	whole, frac, hasFrac := strings.Cut(value, decimal)
+	if hasFrac && !isDigits(frac) {
+		return "", false
+	}
+
+	if strings.Contains(whole, grouping) {
+		groups := strings.Split(whole, grouping)
+		lead := strings.TrimPrefix(groups[0], "-")
+		if !isDigits(lead) || len(lead) > 3 {
+			return "", false
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 || !isDigits(group) {
+				return "", false
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+
+	if hasFrac {
+		return whole + "." + frac, true
+	}
+	return whole, true
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// parseTime tries each layout in turn, interpreting zone-less values in loc.
+func (rec *record) parseTime(column string, value string, loc *time.Location, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, rec.errorf("invalid %s %q", column, value)
+}
+
+// readRows runs parse over every data row of the table.
+func readRows(t *csvTable, parse func(*record) (*Row, error)) ([]Row, error) {
+	var rows []Row
+	for {
+		rec, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row, err := parse(rec)
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			rows = append(rows, *row)
+		}
+	}
+}
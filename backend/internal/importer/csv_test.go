@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDecimal(t *testing.T) {
+	tests := []struct {
+		value string
+		comma rune
+		want  string
+		ok    bool
+	}{
+		// comma delimited: dot decimal mark, comma groups thousands
+		{"1,234", ',', "1234", true},
+		{"1.234,5", ',', "", false},
+		{"1,234.5", ',', "1234.5", true},
+		{"12,5", ',', "", false},
+		{"1,234,567", ',', "1234567", true},
+		{"82.5", ',', "82.5", true},
+		{"80", ',', "80", true},
+
+		// semicolon delimited: comma decimal mark, dot groups thousands
+		{"1,234", ';', "1.234", true},
+		{"1.234,5", ';', "1234.5", true},
+		{"1,234.5", ';', "", false},
+		{"12,5", ';', "12.5", true},
+		{"1.234.567", ';', "1234567", true},
+		{"82.5", ';', "", false},
+		{"80", ';', "80", true},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeDecimal(tt.value, tt.comma)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeDecimal(%q, %q) = %q, %v, want %q, %v", tt.value, tt.comma, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOptionalFloatFollowsDelimiter(t *testing.T) {
+	tests := []struct {
+		file string
+		want float64
+	}{
+		{"name,weight\nbench,\"1,234.5\"\n", 1234.5},
+		{"name;weight\nbench;1.234,5\n", 1234.5},
+		{"name;weight\nbench;82,5\n", 82.5},
+	}
+
+	for _, tt := range tests {
+		table, err := newCSVTable(strings.NewReader(tt.file), "weight")
+		if err != nil {
+			t.Fatalf("newCSVTable(%q): %v", tt.file, err)
+		}
+		rec, err := table.next()
+		if err != nil {
+			t.Fatalf("next(%q): %v", tt.file, err)
+		}
+
+		got, err := rec.optionalFloat("weight", rec.get("weight"), 1)
+		if err != nil {
+			t.Fatalf("optionalFloat(%q): %v", tt.file, err)
+		}
+		if got == nil || *got != tt.want {
+			t.Errorf("optionalFloat(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
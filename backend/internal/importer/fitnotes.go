@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// fitNotesAdapter reads FitNotes' "Export Workout Data" CSV:
+//
+//	Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time,Comment
+//
+// FitNotes only records the day, so every set of a day is one session
+// starting at midnight.
+type fitNotesAdapter struct{}
+
+var fitNotesDistanceUnits = map[string]float64{
+	"m":     1,
+	"km":    1000,
+	"mi":    metersPerMi,
+	"miles": metersPerMi,
+	"ft":    0.3048,
+	"yd":    0.9144,
+}
+
+func (fitNotesAdapter) Parse(r io.Reader, opts Options) ([]Row, error) {
+	t, err := newCSVTable(r, "date", "exercise")
+	if err != nil {
+		return nil, err
+	}
+
+	return readRows(t, func(rec *record) (*Row, error) {
+		exercise := rec.get("exercise")
+		if exercise == "" {
+			return nil, nil
+		}
+
+		start, err := rec.parseTime("date", rec.get("date"), opts.Location, "2006-01-02")
+		if err != nil {
+			return nil, err
+		}
+
+		row := &Row{
+			SessionStart: start,
+			WorkoutName:  "FitNotes workout",
+			Exercise:     exercise,
+			Notes:        rec.get("comment"),
+		}
+
+		if t.has("weight (lbs)") {
+			row.Weight, err = rec.optionalFloat("weight", rec.get("weight (lbs)"), kgPerLb)
+		} else {
+			row.Weight, err = rec.optionalFloat("weight", rec.get("weight (kgs)", "weight (kg)", "weight"), 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row.Reps, err = rec.optionalInt("reps", rec.get("reps"))
+		if err != nil {
+			return nil, err
+		}
+
+		if distance := rec.get("distance"); distance != "" {
+			factor, ok := fitNotesDistanceUnits[strings.ToLower(rec.get("distance unit"))]
+			if !ok {
+				factor = 1000
+			}
+			row.DistanceMeters, err = rec.optionalFloat("distance", distance, factor)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if value := rec.get("time"); value != "" {
+			seconds, ok := parseClock(value)
+			if !ok {
+				return nil, rec.errorf("invalid time %q", value)
+			}
+			if seconds > 0 {
+				row.DurationSeconds = &seconds
+			}
+		}
+
+		return row, nil
+	})
+}
+
+// parseClock parses "h:mm:ss" or "mm:ss" into seconds.
+func parseClock(value string) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	seconds := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, true
+}
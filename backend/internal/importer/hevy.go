@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// hevyAdapter reads the CSV from Hevy's "Export Workouts":
+//
+//	"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes",
+//	"set_index","set_type","weight_kg","reps","distance_km","duration_seconds","rpe"
+//
+// Accounts set to imperial export weight_lbs and distance_miles instead.
+type hevyAdapter struct{}
+
+var hevyTimeLayouts = []string{
+	"2 Jan 2006, 15:04",
+	"02 Jan 2006, 15:04",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+}
+
+func (hevyAdapter) Parse(r io.Reader, opts Options) ([]Row, error) {
+	t, err := newCSVTable(r, "title", "start_time", "exercise_title")
+	if err != nil {
+		return nil, err
+	}
+
+	return readRows(t, func(rec *record) (*Row, error) {
+		exercise := rec.get("exercise_title")
+		if exercise == "" {
+			return nil, nil
+		}
+
+		start, err := rec.parseTime("start_time", rec.get("start_time"), opts.Location, hevyTimeLayouts...)
+		if err != nil {
+			return nil, err
+		}
+
+		row := &Row{
+			SessionStart: start,
+			WorkoutName:  rec.get("title"),
+			WorkoutNotes: rec.get("description"),
+			Exercise:     exercise,
+			Notes:        rec.get("exercise_notes"),
+		}
+
+		if endValue := rec.get("end_time"); endValue != "" {
+			end, err := rec.parseTime("end_time", endValue, opts.Location, hevyTimeLayouts...)
+			if err != nil {
+				return nil, err
+			}
+			if end.After(start) {
+				row.SessionDuration = end.Sub(start)
+			}
+		}
+
+		if setType := rec.get("set_type"); setType != "" && !strings.EqualFold(setType, "normal") {
+			row.Notes = strings.TrimSpace(row.Notes + " (" + setType + " set)")
+		}
+
+		if t.has("weight_lbs") {
+			row.Weight, err = rec.optionalFloat("weight_lbs", rec.get("weight_lbs"), kgPerLb)
+		} else {
+			row.Weight, err = rec.optionalFloat("weight_kg", rec.get("weight_kg"), 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if t.has("distance_miles") {
+			row.DistanceMeters, err = rec.optionalFloat("distance_miles", rec.get("distance_miles"), metersPerMi)
+		} else {
+			row.DistanceMeters, err = rec.optionalFloat("distance_km", rec.get("distance_km"), 1000)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row.Reps, err = rec.optionalInt("reps", rec.get("reps"))
+		if err != nil {
+			return nil, err
+		}
+		row.DurationSeconds, err = rec.optionalInt("duration_seconds", rec.get("duration_seconds"))
+		if err != nil {
+			return nil, err
+		}
+
+		return row, nil
+	})
+}
@@ -0,0 +1,202 @@
+// Package importer turns CSV exports from other workout apps into
+// store.Workout values. Each app has an Adapter that parses its format into
+// Rows, one per logged set; the rest of the pipeline (grouping into
+// sessions, exercise name mapping, dedupe) is shared.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+// Row is a single set as exported by another app, normalised to metric.
+type Row struct {
+	// SessionStart identifies the workout the set belongs to.
+	SessionStart time.Time
+	WorkoutName  string
+	WorkoutNotes string
+	// SessionDuration is the length of the whole workout, when known.
+	SessionDuration time.Duration
+
+	Exercise        string
+	Reps            *int
+	Weight          *float64 // kilograms
+	DurationSeconds *int
+	DistanceMeters  *float64
+	Notes           string
+}
+
+// Options carries the request-level settings adapters may need.
+type Options struct {
+	// Location is used for timestamps exported without a zone.
+	Location *time.Location
+	// Imperial marks weights and distances in lbs and miles for formats
+	// that don't say which units they use.
+	Imperial bool
+}
+
+type Adapter interface {
+	Parse(r io.Reader, opts Options) ([]Row, error)
+}
+
+var adapters = map[string]Adapter{
+	"strong":   strongAdapter{},
+	"hevy":     hevyAdapter{},
+	"fitnotes": fitNotesAdapter{},
+}
+
+// Lookup returns the adapter registered for source.
+func Lookup(source string) (Adapter, bool) {
+	adapter, ok := adapters[strings.ToLower(source)]
+	return adapter, ok
+}
+
+// Sources lists the supported source names.
+func Sources() []string {
+	sources := make([]string, 0, len(adapters))
+	for source := range adapters {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Plan is the outcome of preparing an import: the workouts that would be
+// created, how many sessions already exist, and the exercise names that
+// matched nothing we know.
+type Plan struct {
+	Workouts          []*store.Workout `json:"workouts"`
+	Duplicates        int              `json:"duplicates"`
+	UnmappedExercises []string         `json:"unmapped_exercises"`
+}
+
+// Prepare groups rows into workouts, resolves exercise names through
+// mapper, and drops sessions that are already logged: those with the same
+// start and title as an existing workout or an earlier session.
+func Prepare(rows []Row, mapper *Mapper, existing []store.WorkoutStart) *Plan {
+	seen := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		seen[sessionKey(e.StartedAt, e.Title)] = true
+	}
+
+	plan := &Plan{Workouts: []*store.Workout{}, UnmappedExercises: []string{}}
+	unmapped := make(map[string]bool)
+
+	for _, workout := range group(rows) {
+		key := sessionKey(workout.StartedAt, workout.Title)
+		if seen[key] {
+			plan.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+			name, ok := mapper.Resolve(entry.ExerciseName)
+			if !ok && !unmapped[entry.ExerciseName] {
+				unmapped[entry.ExerciseName] = true
+				plan.UnmappedExercises = append(plan.UnmappedExercises, entry.ExerciseName)
+			}
+			entry.ExerciseName = name
+		}
+
+		plan.Workouts = append(plan.Workouts, workout)
+	}
+
+	sort.Strings(plan.UnmappedExercises)
+	return plan
+}
+
+// sessionKey identifies a session by when it started and its title.
+func sessionKey(start time.Time, title string) string {
+	return fmt.Sprintf("%d|%s", start.Unix(), title)
+}
+
+// importedTitle names sessions exported without a name.
+const importedTitle = "Imported workout"
+
+// group builds one workout per session, in session order. Consecutive
+// identical sets of an exercise collapse into a single entry.
+func group(rows []Row) []*store.Workout {
+	var workouts []*store.Workout
+	byStart := make(map[string]*store.Workout)
+
+	for _, row := range rows {
+		title := row.WorkoutName
+		if title == "" {
+			title = importedTitle
+		}
+
+		key := sessionKey(row.SessionStart, title)
+		workout, ok := byStart[key]
+		if !ok {
+			workout = &store.Workout{
+				Title:           title,
+				Description:     row.WorkoutNotes,
+				StartedAt:       row.SessionStart,
+				DurationMinutes: int(row.SessionDuration.Round(time.Minute).Minutes()),
+			}
+			byStart[key] = workout
+			workouts = append(workouts, workout)
+		}
+
+		entry := store.WorkoutEntry{
+			ExerciseName:    row.Exercise,
+			Sets:            1,
+			Reps:            row.Reps,
+			Weight:          row.Weight,
+			DurationSeconds: row.DurationSeconds,
+			DistanceMeters:  row.DistanceMeters,
+			Notes:           row.Notes,
+		}
+		// workout_entries requires exactly one of reps and duration
+		if entry.Reps != nil {
+			entry.DurationSeconds = nil
+		} else if entry.DurationSeconds == nil {
+			zero := 0
+			entry.DurationSeconds = &zero
+		}
+
+		if n := len(workout.Entries); n > 0 && sameSet(&workout.Entries[n-1], &entry) {
+			workout.Entries[n-1].Sets++
+			continue
+		}
+
+		entry.OrderIndex = len(workout.Entries) + 1
+		workout.Entries = append(workout.Entries, entry)
+	}
+
+	sort.SliceStable(workouts, func(i, j int) bool {
+		return workouts[i].StartedAt.Before(workouts[j].StartedAt)
+	})
+
+	return workouts
+}
+
+func sameSet(a, b *store.WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		a.Notes == b.Notes &&
+		equalInt(a.Reps, b.Reps) &&
+		equalInt(a.DurationSeconds, b.DurationSeconds) &&
+		equalFloat(a.Weight, b.Weight) &&
+		equalFloat(a.DistanceMeters, b.DistanceMeters)
+}
+
+func equalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+func intPtr(v int) *int { return &v }
+
+func floatPtr(v float64) *float64 { return &v }
+
+var (
+	morning = time.Date(2024, time.May, 6, 7, 30, 0, 0, time.UTC)
+	evening = time.Date(2024, time.May, 6, 18, 0, 0, 0, time.UTC)
+)
+
+func TestPrepareGroupsSessions(t *testing.T) {
+	rows := []Row{
+		{SessionStart: evening, WorkoutName: "Legs", Exercise: "Squat (Barbell)", Reps: intPtr(5), Weight: floatPtr(100)},
+		{SessionStart: morning, WorkoutName: "Push", SessionDuration: 62 * time.Minute, Exercise: "Bench Press (Barbell)", Reps: intPtr(8), Weight: floatPtr(80)},
+		{SessionStart: morning, WorkoutName: "Push", Exercise: "Bench Press (Barbell)", Reps: intPtr(8), Weight: floatPtr(80)},
+		{SessionStart: morning, WorkoutName: "Push", Exercise: "Bench Press (Barbell)", Reps: intPtr(6), Weight: floatPtr(85)},
+		{SessionStart: morning, WorkoutName: "Push", Exercise: "Plank", DurationSeconds: intPtr(60)},
+		{SessionStart: evening, WorkoutName: "Legs", Exercise: "Squat (Barbell)", Reps: intPtr(5), Weight: floatPtr(100)},
+		{SessionStart: evening, WorkoutName: "", Exercise: "Running", DistanceMeters: floatPtr(5000)},
+	}
+
+	plan := Prepare(rows, NewMapper(nil, nil), nil)
+
+	want := []*store.Workout{
+		{
+			Title:           "Push",
+			StartedAt:       morning,
+			DurationMinutes: 62,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Bench Press", Sets: 2, Reps: intPtr(8), Weight: floatPtr(80), OrderIndex: 1},
+				{ExerciseName: "Bench Press", Sets: 1, Reps: intPtr(6), Weight: floatPtr(85), OrderIndex: 2},
+				{ExerciseName: "Plank", Sets: 1, DurationSeconds: intPtr(60), OrderIndex: 3},
+			},
+		},
+		{
+			Title:     "Legs",
+			StartedAt: evening,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Squats", Sets: 2, Reps: intPtr(5), Weight: floatPtr(100), OrderIndex: 1},
+			},
+		},
+		{
+			// an unnamed session at the same time is a session of its own,
+			// and an entry without reps gets a zero duration
+			Title:     importedTitle,
+			StartedAt: evening,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Running", Sets: 1, DurationSeconds: intPtr(0), DistanceMeters: floatPtr(5000), OrderIndex: 1},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(plan.Workouts, want) {
+		t.Errorf("Prepare workouts =\n%s\nwant\n%s", formatWorkouts(plan.Workouts), formatWorkouts(want))
+	}
+	if plan.Duplicates != 0 || len(plan.UnmappedExercises) != 0 {
+		t.Errorf("Prepare = %d duplicates and unmapped %v, want none", plan.Duplicates, plan.UnmappedExercises)
+	}
+}
+
+func TestPrepareDedupe(t *testing.T) {
+	sameMinute := morning.Add(20 * time.Second)
+	rows := []Row{
+		{SessionStart: morning, WorkoutName: "Push", Exercise: "Dips", Reps: intPtr(10)},
+		{SessionStart: sameMinute, WorkoutName: "Pull", Exercise: "Pull-ups", Reps: intPtr(8)},
+		{SessionStart: morning, WorkoutName: "Core", Exercise: "Plank", DurationSeconds: intPtr(60)},
+		{SessionStart: evening, WorkoutName: "Legs", Exercise: "Lunges", Reps: intPtr(12)},
+	}
+	existing := []store.WorkoutStart{
+		{StartedAt: morning, Title: "Push"},
+		// same title, different start: not the same session
+		{StartedAt: sameMinute.Add(time.Minute), Title: "Pull"},
+		{StartedAt: evening, Title: "Legs"},
+	}
+
+	plan := Prepare(rows, NewMapper(nil, nil), existing)
+
+	var got []string
+	for _, w := range plan.Workouts {
+		got = append(got, w.StartedAt.Format(time.TimeOnly)+" "+w.Title)
+	}
+	want := []string{"07:30:00 Core", "07:30:20 Pull"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Prepare kept %v, want %v", got, want)
+	}
+	if plan.Duplicates != 2 {
+		t.Errorf("Prepare found %d duplicates, want 2", plan.Duplicates)
+	}
+}
+
+func TestPrepareMapping(t *testing.T) {
+	rows := []Row{
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "BB Bench", Reps: intPtr(5)},
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "Zercher Squat", Reps: intPtr(5)},
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "pull ups", Reps: intPtr(5)},
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "Jefferson Curl", Reps: intPtr(10)},
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "Zercher Squat", Reps: intPtr(3)},
+		{SessionStart: morning, WorkoutName: "Mixed", Exercise: "Landmine Press (Barbell)", Reps: intPtr(8)},
+	}
+	mapper := NewMapper(map[string]string{" bb bench ": "Bench Press"}, []string{"Landmine Press"})
+
+	plan := Prepare(rows, mapper, nil)
+
+	if len(plan.Workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(plan.Workouts))
+	}
+	var names []string
+	for _, e := range plan.Workouts[0].Entries {
+		names = append(names, e.ExerciseName)
+	}
+	wantNames := []string{"Bench Press", "Zercher Squat", "Pull-ups", "Jefferson Curl", "Zercher Squat", "Landmine Press"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("entry names = %q, want %q", names, wantNames)
+	}
+
+	// unmapped names are listed once each, sorted, and kept as exported
+	wantUnmapped := []string{"Jefferson Curl", "Zercher Squat"}
+	if !reflect.DeepEqual(plan.UnmappedExercises, wantUnmapped) {
+		t.Errorf("UnmappedExercises = %q, want %q", plan.UnmappedExercises, wantUnmapped)
+	}
+}
+
+func formatWorkouts(workouts []*store.Workout) string {
+	var s string
+	for _, w := range workouts {
+		s += "\t" + w.StartedAt.Format(time.RFC3339) + " " + w.Title + "\n"
+		for _, e := range w.Entries {
+			s += "\t\t" + e.ExerciseName + "\n"
+		}
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// catalog holds the exercise names the app uses out of the box, as seen in
+// migrations/sample/sample_data.sql, plus common lifts.
+var catalog = []string{
+	"Bench Press", "Incline Bench Press", "Squats", "Front Squat", "Deadlift",
+	"Romanian Deadlift", "Shoulder Press", "Pull-ups", "Chin-ups", "Rows",
+	"Leg Press", "Bicep Curls", "Tricep Extensions", "Lat Pulldown", "Lunges",
+	"Dips", "Hip Thrust", "Calf Raises", "Lateral Raises", "Face Pulls",
+	"Plank", "Crunches", "Burpees", "Mountain Climbers", "Jump Squats",
+	"Push-ups", "High Knees", "Jumping Jacks", "Box Jumps", "Kettlebell Swings",
+	"Wall Balls", "Thrusters", "Double Unders", "Muscle-ups", "Easy Run",
+	"Tempo Run", "Interval Training", "Hill Repeats", "Long Run", "Running",
+	"Cycling", "Rowing", "Walking", "Swimming",
+}
+
+// Mapper resolves exercise names from another app onto names we already
+// know: explicit user mappings first, then the user's own history and the
+// built-in catalog.
+type Mapper struct {
+	explicit map[string]string
+	known    map[string]string
+}
+
+// NewMapper builds a mapper from explicit source → target mappings and the
+// exercise names the user has logged before.
+func NewMapper(mappings map[string]string, userExercises []string) *Mapper {
+	m := &Mapper{
+		explicit: make(map[string]string, len(mappings)),
+		known:    make(map[string]string, len(catalog)+len(userExercises)),
+	}
+
+	for from, to := range mappings {
+		m.explicit[strings.ToLower(strings.TrimSpace(from))] = strings.TrimSpace(to)
+	}
+	for _, name := range catalog {
+		m.known[normalize(name)] = name
+	}
+	// the user's own spelling wins over the catalog's
+	for _, name := range userExercises {
+		m.known[normalize(name)] = name
+	}
+
+	return m
+}
+
+// Resolve returns the name to store for an exercise and whether it was
+// mapped. Unmapped names are returned unchanged.
+func (m *Mapper) Resolve(name string) (string, bool) {
+	if to, ok := m.explicit[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return to, true
+	}
+	if known, ok := m.known[normalize(name)]; ok {
+		return known, true
+	}
+	return name, false
+}
+
+var (
+	// equipment suffixes like "Bench Press (Barbell)" as used by Strong and Hevy
+	parenthetical = regexp.MustCompile(`\s*\([^)]*\)`)
+	nonAlnum      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// normalize reduces a name to a comparison key: lowercase, equipment
+// suffix and punctuation removed, trailing plural "s" dropped.
+func normalize(name string) string {
+	name = parenthetical.ReplaceAllString(strings.ToLower(name), "")
+	name = nonAlnum.ReplaceAllString(name, "")
+	return strings.TrimSuffix(name, "s")
+}
@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// strongAdapter reads the Strong app's "Export Strong Data" CSV:
+//
+//	Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+//
+// Weights and distances are in whatever units the user picked in Strong.
+type strongAdapter struct{}
+
+func (strongAdapter) Parse(r io.Reader, opts Options) ([]Row, error) {
+	t, err := newCSVTable(r, "date", "exercise name")
+	if err != nil {
+		return nil, err
+	}
+
+	weightFactor, distanceFactor := 1.0, 1000.0
+	if opts.Imperial {
+		weightFactor, distanceFactor = kgPerLb, metersPerMi
+	}
+
+	return readRows(t, func(rec *record) (*Row, error) {
+		exercise := rec.get("exercise name")
+		// newer exports interleave rest timer rows between sets
+		if exercise == "" || strings.EqualFold(rec.get("set order"), "rest timer") {
+			return nil, nil
+		}
+
+		start, err := rec.parseTime("date", rec.get("date"), opts.Location, "2006-01-02 15:04:05", "2006-01-02 15:04")
+		if err != nil {
+			return nil, err
+		}
+
+		row := &Row{
+			SessionStart:    start,
+			WorkoutName:     rec.get("workout name"),
+			WorkoutNotes:    rec.get("workout notes"),
+			SessionDuration: parseStrongDuration(rec.get("duration")),
+			Exercise:        exercise,
+			Notes:           rec.get("notes"),
+		}
+
+		row.Weight, err = rec.optionalFloat("weight", rec.get("weight"), weightFactor)
+		if err != nil {
+			return nil, err
+		}
+		row.Reps, err = rec.optionalInt("reps", rec.get("reps"))
+		if err != nil {
+			return nil, err
+		}
+		row.DurationSeconds, err = rec.optionalInt("seconds", rec.get("seconds"))
+		if err != nil {
+			return nil, err
+		}
+		row.DistanceMeters, err = rec.optionalFloat("distance", rec.get("distance"), distanceFactor)
+		if err != nil {
+			return nil, err
+		}
+
+		return row, nil
+	})
+}
+
+// parseStrongDuration understands "1h 5m", "45m", "30s" and plain seconds.
+// Anything else yields zero rather than failing the whole import.
+func parseStrongDuration(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	d, err := time.ParseDuration(strings.ReplaceAll(value, " ", ""))
+	if err != nil {
+		return 0
+	}
+	return d
+}
@@ -12,11 +12,15 @@ import (
 
 type UserMiddleware struct {
 	UserStore store.UserStore
+	OrgStore  store.OrgStore
 }
 
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey       = contextKey("user")
+	MembershipContextKey = contextKey("membership")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -80,3 +84,40 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// GetMembership returns the caller's membership of the organization in the
+// route, as loaded by RequireOrgMember.
+func GetMembership(r *http.Request) *store.Membership {
+	membership, ok := r.Context().Value(MembershipContextKey).(*store.Membership)
+	if !ok {
+		panic("missing membership in request") // route isn't behind RequireOrgMember
+	}
+	return membership
+}
+
+// RequireOrgMember lets the request through only when the caller belongs to
+// the organization {id}. Everyone else is told it doesn't exist, so
+// organizations can't be discovered by probing IDs.
+func (um *UserMiddleware) RequireOrgMember(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID, err := utils.ReadIDParam(r)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid organization ID"})
+			return
+		}
+
+		user := GetUser(r)
+		membership, err := um.OrgStore.GetMembership(orgID, user.ID)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if membership == nil || user.IsAnonymous() {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "organization does not exist"})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), MembershipContextKey, membership)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,594 @@
+// Package quicklog parses workouts typed as short lines, one entry per
+// line, into store.WorkoutEntry values:
+//
+//	bench 3x8 @ 80kg
+//	5k run 24:30
+//	plank 3x60s rpe 8
+//	squat 5x5 @ 225 lb rest 3:00 tempo 3-1-X-0 # felt heavy
+//
+// A line is an exercise name plus any of:
+//
+//	3x8, 3x60s, 4x400m   sets times reps, a time or a distance
+//	@ 80kg, 80 kg        weight in kg (the default) or lb
+//	5k, 400m, 3mi        distance, which needs a time to go with it
+//	24:30, 1:02:03, 60s  time, as [h:]mm:ss or with s, min or h
+//	rpe 8                rate of perceived exertion, kept in the notes
+//	rest 90s             rest between sets
+//	tempo 3-1-X-0        lifting tempo, see package tempo
+//	# text               notes, to the end of the line
+//
+// Every entry needs reps or a time, so a distance is logged with the time
+// it took: "5k run 24:30", or "row 4x400m 1:30" for the time of each set.
+// Numbers and their units may be written together or apart. Lines that
+// are blank or start with # are skipped.
+package quicklog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+	"github.com/strangecousinwst/goworkout/internal/tempo"
+)
+
+const (
+	kgPerLb       = 0.45359237
+	metersPerMile = 1609.344
+
+	maxSets = 100
+	maxReps = 1000
+	// maxWeight is what the weight column holds.
+	maxWeight = 999.99
+	// maxDurationSeconds is a day; longer times are typos.
+	maxDurationSeconds = 24 * 60 * 60
+	maxDistanceMeters  = 1000 * 1000
+	maxRestSeconds     = 60 * 60
+	maxNameLength      = 255
+	maxRPE             = 10
+)
+
+// Error is a problem with one line, pointing at the token that caused it.
+// Line and Column count from 1, Column in characters.
+type Error struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Token   string `json:"token"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %q: %s", e.Line, e.Column, e.Token, e.Message)
+}
+
+// Errors holds the errors of every line that failed to parse.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Parse reads one entry per line. When any line fails it returns the
+// errors of all of them as Errors, so they can be fixed in one go.
+func Parse(text string) ([]store.WorkoutEntry, error) {
+	entries := []store.WorkoutEntry{}
+	var errs Errors
+
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		entry, err := parseLine(line)
+		if err != nil {
+			err.Line = i + 1
+			errs = append(errs, err)
+			continue
+		}
+		entry.OrderIndex = len(entries) + 1
+		entries = append(entries, entry)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return entries, nil
+}
+
+// ParseLine reads a single entry. Errors are *Error with Line 1.
+func ParseLine(line string) (store.WorkoutEntry, error) {
+	entry, err := parseLine(line)
+	if err != nil {
+		err.Line = 1
+		return store.WorkoutEntry{}, err
+	}
+	entry.OrderIndex = 1
+	return entry, nil
+}
+
+type token struct {
+	text string
+	// col is the 1-based character column the token starts at.
+	col int
+}
+
+// lineParser fills in an entry token by token, remembering where each
+// field came from so a repeated field can be reported.
+type lineParser struct {
+	tokens []token
+	pos    int
+	end    int
+
+	entry     store.WorkoutEntry
+	name      []string
+	nameStart token
+	nameDone  bool
+	seen      map[string]token
+	rpe       string
+	notes     string
+}
+
+func parseLine(line string) (store.WorkoutEntry, *Error) {
+	tokens, notes, end := tokenize(line)
+	p := &lineParser{tokens: tokens, end: end, notes: notes, seen: map[string]token{}}
+	p.entry.Sets = 1
+
+	for p.pos < len(p.tokens) {
+		err := p.next()
+		if err != nil {
+			return store.WorkoutEntry{}, err
+		}
+	}
+
+	return p.finish()
+}
+
+func (p *lineParser) next() *Error {
+	tok := p.tokens[p.pos]
+	p.pos++
+	lower := strings.ToLower(tok.text)
+
+	switch {
+	case lower == "@":
+		arg, err := p.argument(tok, "a weight like 80kg")
+		if err != nil {
+			return err
+		}
+		return p.weight(arg, true)
+	case lower == "rpe" && p.numberFollows():
+		return p.setRPE(p.take())
+	case lower == "rest" && p.numberFollows():
+		return p.rest(p.take())
+	// "tempo run" is an exercise, "tempo 3-1-X-0" a tempo
+	case lower == "tempo" && (p.numberFollows() || p.peekPrefix("x")):
+		return p.tempo(p.take())
+	}
+
+	if strings.HasPrefix(lower, "rpe") && isNumber(lower[3:]) {
+		return p.setRPE(token{text: tok.text[3:], col: tok.col + 3})
+	}
+	if sets, rest, ok := splitSets(tok.text); ok {
+		return p.sets(tok, sets, rest)
+	}
+	if handled, err := p.quantity(tok, tok.text); handled {
+		return err
+	}
+	if isNumber(tok.text) {
+		return errorAt(tok, "a number needs a unit or an x, like 3x8, 80kg, 400m or 60s")
+	}
+	if before, _, found := strings.Cut(tok.text, ":"); found && isDigits(before) {
+		return errorAt(tok, "expected a time like 24:30 or 1:02:03")
+	}
+
+	return p.word(tok)
+}
+
+// argument returns the token after the keyword kw.
+func (p *lineParser) argument(kw token, want string) (token, *Error) {
+	if p.pos == len(p.tokens) {
+		return token{}, errorAt(kw, "expected "+want+" after it")
+	}
+	return p.take(), nil
+}
+
+func (p *lineParser) take() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// numberFollows reports whether the next token starts with a digit, which
+// makes a keyword like rest or rpe a keyword rather than part of a name.
+func (p *lineParser) numberFollows() bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].text[0] >= '0' && p.tokens[p.pos].text[0] <= '9'
+}
+
+func (p *lineParser) peekPrefix(prefix string) bool {
+	return p.pos < len(p.tokens) && strings.HasPrefix(strings.ToLower(p.tokens[p.pos].text), prefix)
+}
+
+// word adds tok to the exercise name, which has to be written in one
+// piece.
+func (p *lineParser) word(tok token) *Error {
+	if p.nameDone {
+		return errorAt(tok, "unexpected word after the exercise details; put notes after #")
+	}
+	if len(p.name) == 0 {
+		first := []rune(tok.text)[0]
+		if !unicode.IsLetter(first) && !unicode.IsDigit(first) {
+			return errorAt(tok, "expected an exercise name")
+		}
+		p.nameStart = tok
+	}
+	p.name = append(p.name, tok.text)
+	return nil
+}
+
+// mark records that field was set by tok, failing if it was set before.
+// Once anything but the name is set, the name is complete.
+func (p *lineParser) mark(field string, tok token) *Error {
+	if first, ok := p.seen[field]; ok {
+		return errorAt(tok, fmt.Sprintf("%s already given as %q at column %d", field, first.text, first.col))
+	}
+	p.seen[field] = tok
+	if len(p.name) > 0 {
+		p.nameDone = true
+	}
+	return nil
+}
+
+// sets handles "3x8", "3x60s" and "4x400m": a count of sets times reps,
+// a time or a distance per set. A distance still needs a time from
+// elsewhere on the line.
+func (p *lineParser) sets(tok token, count, per string) *Error {
+	sets, err := strconv.Atoi(count)
+	if err != nil || sets < 1 || sets > maxSets {
+		return errorAt(tok, fmt.Sprintf("sets must be between 1 and %d", maxSets))
+	}
+	if err := p.mark("sets", tok); err != nil {
+		return err
+	}
+	p.entry.Sets = sets
+
+	if isDigits(per) {
+		reps, err := strconv.Atoi(per)
+		if err != nil || reps < 1 || reps > maxReps {
+			return errorAt(tok, fmt.Sprintf("reps must be between 1 and %d", maxReps))
+		}
+		if err := p.mark("reps", tok); err != nil {
+			return err
+		}
+		p.entry.Reps = &reps
+		return nil
+	}
+
+	handled := false
+	if _, unit, ok := splitUnit(per); !ok || !weightUnits[strings.ToLower(unit)] {
+		var err *Error
+		handled, err = p.quantity(tok, per)
+		if err != nil {
+			return err
+		}
+	}
+	if !handled {
+		return errorAt(tok, "expected reps, a time or a distance after the x, like 3x8, 3x60s or 4x400m")
+	}
+	return nil
+}
+
+// quantity handles a number with a unit: a weight, distance or time. It
+// reports whether s looked like one.
+func (p *lineParser) quantity(tok token, s string) (bool, *Error) {
+	if seconds, ok := parseClock(s); ok {
+		return true, p.duration(tok, seconds)
+	}
+
+	number, unit, ok := splitUnit(s)
+	if !ok {
+		return false, nil
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return false, nil
+	}
+
+	switch strings.ToLower(unit) {
+	case "kg", "kgs", "lb", "lbs":
+		return true, p.weight(token{text: s, col: tok.col}, false)
+	case "k", "km":
+		return true, p.distance(tok, value*1000)
+	case "m":
+		return true, p.distance(tok, value)
+	case "mi":
+		return true, p.distance(tok, value*metersPerMile)
+	case "s", "sec", "secs":
+		return true, p.durationValue(tok, value)
+	case "min", "mins":
+		return true, p.durationValue(tok, value*60)
+	case "h", "hr", "hrs":
+		return true, p.durationValue(tok, value*3600)
+	}
+	return false, nil
+}
+
+// weight handles "80kg" and "225lb", or a bare number in kg after @.
+func (p *lineParser) weight(tok token, bare bool) *Error {
+	number, unit, ok := splitUnit(tok.text)
+	if !ok && bare && isNumber(tok.text) {
+		number, unit, ok = tok.text, "kg", true
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		return errorAt(tok, "expected a weight like 80kg or 175lb")
+	}
+
+	switch strings.ToLower(unit) {
+	case "kg", "kgs":
+	case "lb", "lbs":
+		value *= kgPerLb
+	default:
+		return errorAt(tok, "weight must be in kg or lb")
+	}
+	value = math.Round(value*100) / 100
+	if value <= 0 || value > maxWeight {
+		return errorAt(tok, "weight must be more than 0 and at most 999.99 kg")
+	}
+
+	if err := p.mark("weight", tok); err != nil {
+		return err
+	}
+	p.entry.Weight = &value
+	return nil
+}
+
+func (p *lineParser) distance(tok token, meters float64) *Error {
+	meters = math.Round(meters*100) / 100
+	if meters <= 0 || meters > maxDistanceMeters {
+		return errorAt(tok, "distance must be more than 0 and at most 1000 km")
+	}
+	if err := p.mark("distance", tok); err != nil {
+		return err
+	}
+	p.entry.DistanceMeters = &meters
+	return nil
+}
+
+func (p *lineParser) durationValue(tok token, seconds float64) *Error {
+	if seconds != math.Trunc(seconds) {
+		return errorAt(tok, "time must be whole seconds")
+	}
+	return p.duration(tok, int(seconds))
+}
+
+func (p *lineParser) duration(tok token, seconds int) *Error {
+	if seconds <= 0 || seconds > maxDurationSeconds {
+		return errorAt(tok, "time must be more than 0 and at most 24 hours")
+	}
+	if err := p.mark("time", tok); err != nil {
+		return err
+	}
+	p.entry.DurationSeconds = &seconds
+	return nil
+}
+
+func (p *lineParser) setRPE(tok token) *Error {
+	rpe, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil || rpe < 1 || rpe > maxRPE || rpe*2 != math.Trunc(rpe*2) {
+		return errorAt(tok, "RPE must be from 1 to 10 in half steps")
+	}
+	if err := p.mark("RPE", tok); err != nil {
+		return err
+	}
+	p.rpe = "RPE " + strconv.FormatFloat(rpe, 'f', -1, 64)
+	return nil
+}
+
+func (p *lineParser) rest(tok token) *Error {
+	seconds, ok := parseClock(tok.text)
+	if !ok {
+		number, unit, split := splitUnit(tok.text)
+		value, err := strconv.ParseFloat(number, 64)
+		if split && err == nil && value == math.Trunc(value) {
+			switch strings.ToLower(unit) {
+			case "s", "sec", "secs":
+				seconds, ok = int(value), true
+			case "min", "mins":
+				seconds, ok = int(value*60), true
+			}
+		}
+	}
+	if !ok {
+		return errorAt(tok, "expected a rest time like 90s, 2min or 2:00")
+	}
+	if seconds < 0 || seconds > maxRestSeconds {
+		return errorAt(tok, "rest must be at most an hour")
+	}
+	if err := p.mark("rest", tok); err != nil {
+		return err
+	}
+	p.entry.RestSeconds = &seconds
+	return nil
+}
+
+func (p *lineParser) tempo(tok token) *Error {
+	t, err := tempo.Parse(tok.text)
+	if err != nil {
+		return errorAt(tok, err.Error())
+	}
+	if err := p.mark("tempo", tok); err != nil {
+		return err
+	}
+	p.entry.Tempo = t.String()
+	return nil
+}
+
+// finish checks the entry is complete: it needs a name and, like every
+// entry, reps or a time but not both.
+func (p *lineParser) finish() (store.WorkoutEntry, *Error) {
+	if len(p.name) == 0 {
+		return store.WorkoutEntry{}, &Error{Column: 1, Message: "missing exercise name"}
+	}
+	p.entry.ExerciseName = strings.Join(p.name, " ")
+	if len([]rune(p.entry.ExerciseName)) > maxNameLength {
+		return store.WorkoutEntry{}, errorAt(p.nameStart, "exercise name must be at most 255 characters")
+	}
+
+	if p.entry.Reps != nil && p.entry.DurationSeconds != nil {
+		return store.WorkoutEntry{}, errorAt(p.seen["time"], "an entry has reps or a time, not both")
+	}
+	if p.entry.Reps == nil && p.entry.DurationSeconds == nil {
+		if dist, ok := p.seen["distance"]; ok {
+			return store.WorkoutEntry{}, errorAt(dist, "a distance needs the time it took, like 5k 24:30 or 4x400m 1:30")
+		}
+		return store.WorkoutEntry{}, &Error{Column: p.end, Message: "missing reps or a time, like 3x8, 3x60s or 24:30"}
+	}
+
+	p.entry.Notes = strings.TrimSpace(strings.Join(nonEmpty(p.rpe, p.notes), "; "))
+	return p.entry, nil
+}
+
+func errorAt(tok token, message string) *Error {
+	return &Error{Column: tok.col, Token: tok.text, Message: message}
+}
+
+// tokenize splits line on whitespace, with @ always a token of its own and
+// everything after # returned as notes. A number followed by a unit on its
+// own ("80 kg") becomes one token. end is the column just past the last
+// token.
+func tokenize(line string) (tokens []token, notes string, end int) {
+	runes := []rune(line)
+	start := -1
+	flush := func(i int) {
+		if start >= 0 {
+			tokens = append(tokens, token{text: string(runes[start:i]), col: start + 1})
+			start = -1
+		}
+	}
+
+	for i, r := range runes {
+		switch {
+		case r == '#':
+			flush(i)
+			notes = strings.TrimSpace(string(runes[i+1:]))
+			return joinUnits(tokens), notes, i + 1
+		case unicode.IsSpace(r):
+			flush(i)
+		case r == '@':
+			flush(i)
+			tokens = append(tokens, token{text: "@", col: i + 1})
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	flush(len(runes))
+
+	return joinUnits(tokens), "", len([]rune(strings.TrimRightFunc(line, unicode.IsSpace))) + 1
+}
+
+var weightUnits = map[string]bool{"kg": true, "kgs": true, "lb": true, "lbs": true}
+
+var units = map[string]bool{
+	"kg": true, "kgs": true, "lb": true, "lbs": true,
+	"k": true, "km": true, "m": true, "mi": true,
+	"s": true, "sec": true, "secs": true, "min": true, "mins": true, "h": true, "hr": true, "hrs": true,
+}
+
+func joinUnits(tokens []token) []token {
+	joined := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if i+1 < len(tokens) && isNumber(tok.text) && units[strings.ToLower(tokens[i+1].text)] {
+			tok.text += tokens[i+1].text
+			i++
+		}
+		joined = append(joined, tok)
+	}
+	return joined
+}
+
+// splitSets splits "3x8" into "3" and "8". The x may also be X or ×.
+func splitSets(s string) (sets, per string, ok bool) {
+	for i, r := range s {
+		if r == 'x' || r == 'X' || r == '×' {
+			sets, per = s[:i], s[i+len(string(r)):]
+			return sets, per, isDigits(sets)
+		}
+	}
+	return "", "", false
+}
+
+// splitUnit splits "80kg" into "80" and "kg".
+func splitUnit(s string) (number, unit string, ok bool) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if i <= 0 {
+		return "", "", false
+	}
+	number, unit = s[:i], s[i:]
+	return number, unit, isNumber(number) && units[strings.ToLower(unit)]
+}
+
+// parseClock reads "24:30" as minutes and seconds and "1:02:03" as hours,
+// minutes and seconds.
+func parseClock(s string) (int, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	total := 0
+	for i, part := range parts {
+		if !isDigits(part) {
+			return 0, false
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+		// everything but the leading part is a two-digit clock field
+		if i > 0 && (len(part) != 2 || n >= 60) {
+			return 0, false
+		}
+		total = total*60 + n
+	}
+	return total, true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumber reports whether s is a plain decimal like "80" or "82.5".
+func isNumber(s string) bool {
+	whole, frac, found := strings.Cut(s, ".")
+	return isDigits(whole) && (!found || isDigits(frac))
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
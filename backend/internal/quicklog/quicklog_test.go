@@ -0,0 +1,207 @@
+package quicklog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+func intPtr(v int) *int { return &v }
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []store.WorkoutEntry
+	}{
+		{
+			name: "sets, reps and weight",
+			text: "bench 3x8 @ 80kg",
+			want: []store.WorkoutEntry{{ExerciseName: "bench", Sets: 3, Reps: intPtr(8), Weight: floatPtr(80), OrderIndex: 1}},
+		},
+		{
+			name: "distance and time",
+			text: "5k run 24:30",
+			want: []store.WorkoutEntry{{ExerciseName: "run", Sets: 1, DurationSeconds: intPtr(1470), DistanceMeters: floatPtr(5000), OrderIndex: 1}},
+		},
+		{
+			name: "timed sets with rpe",
+			text: "plank 3x60s rpe 8",
+			want: []store.WorkoutEntry{{ExerciseName: "plank", Sets: 3, DurationSeconds: intPtr(60), Notes: "RPE 8", OrderIndex: 1}},
+		},
+		{
+			name: "pounds, rest, tempo and a note",
+			text: "squat 5x5 @ 225 lb rest 3:00 tempo 3-1-X-0 # note",
+			want: []store.WorkoutEntry{{
+				ExerciseName: "squat",
+				Sets:         5,
+				Reps:         intPtr(5),
+				Weight:       floatPtr(102.06),
+				RestSeconds:  intPtr(180),
+				Tempo:        "3-1-X-0",
+				Notes:        "note",
+				OrderIndex:   1,
+			}},
+		},
+		{
+			name: "sets of a distance with the time of each",
+			text: "row 4x400m 1:30",
+			want: []store.WorkoutEntry{{ExerciseName: "row", Sets: 4, DurationSeconds: intPtr(90), DistanceMeters: floatPtr(400), OrderIndex: 1}},
+		},
+		{
+			name: "tempo without a tempo is part of the name",
+			text: "tempo run 30min",
+			want: []store.WorkoutEntry{{ExerciseName: "tempo run", Sets: 1, DurationSeconds: intPtr(1800), OrderIndex: 1}},
+		},
+		{
+			name: "rest without a time is part of the name",
+			text: "rest pause curls 3x8",
+			want: []store.WorkoutEntry{{ExerciseName: "rest pause curls", Sets: 3, Reps: intPtr(8), OrderIndex: 1}},
+		},
+		{
+			name: "blank and comment lines are skipped",
+			text: "# push day\n\nbench 3x8 @ 80kg\n  \ndips 3x12",
+			want: []store.WorkoutEntry{
+				{ExerciseName: "bench", Sets: 3, Reps: intPtr(8), Weight: floatPtr(80), OrderIndex: 1},
+				{ExerciseName: "dips", Sets: 3, Reps: intPtr(12), OrderIndex: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.text, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) =\n%s\nwant\n%s", tt.text, formatEntries(got), formatEntries(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Errors
+	}{
+		{
+			name: "@ without a weight",
+			text: "bench @",
+			want: Errors{{Line: 1, Column: 7, Token: "@", Message: "expected a weight like 80kg after it"}},
+		},
+		{
+			name: "sets given twice",
+			text: "bench 3x8 3x8",
+			want: Errors{{Line: 1, Column: 11, Token: "3x8", Message: `sets already given as "3x8" at column 7`}},
+		},
+		{
+			name: "zero sets",
+			text: "0x0",
+			want: Errors{{Line: 1, Column: 1, Token: "0x0", Message: "sets must be between 1 and 100"}},
+		},
+		{
+			name: "unfinished time",
+			text: "row 2:",
+			want: Errors{{Line: 1, Column: 5, Token: "2:", Message: "expected a time like 24:30 or 1:02:03"}},
+		},
+		{
+			name: "time without a name",
+			text: ":30",
+			want: Errors{{Line: 1, Column: 1, Token: ":30", Message: "expected an exercise name"}},
+		},
+		{
+			name: "sets of a distance without a time",
+			text: "run 4x400m",
+			want: Errors{{Line: 1, Column: 5, Token: "4x400m", Message: "a distance needs the time it took, like 5k 24:30 or 4x400m 1:30"}},
+		},
+		{
+			name: "distance without a time",
+			text: "row 2000m",
+			want: Errors{{Line: 1, Column: 5, Token: "2000m", Message: "a distance needs the time it took, like 5k 24:30 or 4x400m 1:30"}},
+		},
+		{
+			// taken as a name, so the complaint is about what is missing
+			name: "tempo run alone",
+			text: "tempo run",
+			want: Errors{{Line: 1, Column: 10, Message: "missing reps or a time, like 3x8, 3x60s or 24:30"}},
+		},
+		{
+			name: "rest alone",
+			text: "rest",
+			want: Errors{{Line: 1, Column: 5, Message: "missing reps or a time, like 3x8, 3x60s or 24:30"}},
+		},
+		{
+			name: "errors from every line",
+			text: "bench 3x8 @ 80kg\n\n0x0\n# accessories\nrow 2:\nsquat 5x5\nbench @",
+			want: Errors{
+				{Line: 3, Column: 1, Token: "0x0", Message: "sets must be between 1 and 100"},
+				{Line: 5, Column: 5, Token: "2:", Message: "expected a time like 24:30 or 1:02:03"},
+				{Line: 7, Column: 7, Token: "@", Message: "expected a weight like 80kg after it"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Parse(tt.text)
+			if err == nil {
+				t.Fatalf("Parse(%q) = %s, want errors", tt.text, formatEntries(entries))
+			}
+
+			var got Errors
+			if !errors.As(err, &got) {
+				t.Fatalf("Parse(%q) returned %T, want Errors", tt.text, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) errors =\n%v\nwant\n%v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	entry, err := ParseLine("deadlift 1x5 @ 140kg")
+	if err != nil {
+		t.Fatalf("ParseLine: %v", err)
+	}
+	want := store.WorkoutEntry{ExerciseName: "deadlift", Sets: 1, Reps: intPtr(5), Weight: floatPtr(140), OrderIndex: 1}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("ParseLine = %s, want %s", formatEntries([]store.WorkoutEntry{entry}), formatEntries([]store.WorkoutEntry{want}))
+	}
+
+	_, err = ParseLine("bench @")
+	var lineErr *Error
+	if !errors.As(err, &lineErr) {
+		t.Fatalf("ParseLine returned %T, want *Error", err)
+	}
+	if lineErr.Line != 1 || lineErr.Column != 7 || lineErr.Token != "@" {
+		t.Errorf("ParseLine error = %+v, want line 1, column 7, token \"@\"", lineErr)
+	}
+}
+
+// formatEntries prints entries with their pointer fields dereferenced.
+func formatEntries(entries []store.WorkoutEntry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\t{%q sets=%d reps=%s seconds=%s weight=%s meters=%s rest=%s tempo=%q notes=%q order=%d}\n",
+			e.ExerciseName, e.Sets, deref(e.Reps), deref(e.DurationSeconds), deref(e.Weight), deref(e.DistanceMeters),
+			deref(e.RestSeconds), e.Tempo, e.Notes, e.OrderIndex)
+	}
+	return b.String()
+}
+
+func deref[T any](v *T) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,70 @@
+// Package ratelimit caps how often a key, usually a user ID, may do
+// something. State is kept in memory, so limits are per process.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to Limit events per key in any sliding Window.
+type Limiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu        sync.Mutex
+	events    map[int][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		Limit:  limit,
+		Window: window,
+		events: make(map[int][]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Allow records an event for key and reports whether it is within the
+// limit. When it isn't, nothing is recorded and retryAfter says how long
+// until the oldest event in the window expires.
+func (l *Limiter) Allow(key int) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.Window {
+		for k := range l.events {
+			l.prune(k, now)
+		}
+		l.lastSweep = now
+	}
+
+	events := l.prune(key, now)
+	if len(events) >= l.Limit {
+		return false, events[0].Add(l.Window).Sub(now)
+	}
+
+	l.events[key] = append(events, now)
+	return true, 0
+}
+
+// prune drops events of key that fell out of the window, forgetting the
+// key once it has none. Allow sweeps every key once per window so users
+// who went quiet don't accumulate.
+func (l *Limiter) prune(key int, now time.Time) []time.Time {
+	events := l.events[key]
+	i := 0
+	for i < len(events) && !events[i].After(now.Add(-l.Window)) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(l.events, key)
+	} else {
+		l.events[key] = events
+	}
+	return events
+}
@@ -0,0 +1,203 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules used by
+// workout schedules: FREQ=DAILY or WEEKLY with INTERVAL, BYDAY, COUNT and
+// UNTIL. Weeks start on Monday.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily  Frequency = "DAILY"
+	Weekly Frequency = "WEEKLY"
+)
+
+// maxDays bounds expansion of rules without COUNT or UNTIL.
+const maxDays = 100 * 366
+
+var (
+	dayNames = map[string]time.Weekday{
+		"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+		"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+	}
+	dayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+)
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	// Count limits the total number of occurrences; 0 means no limit.
+	Count int
+	// Until is the last instant an occurrence may start; zero means no
+	// limit. A date-only UNTIL covers that whole day in the schedule's
+	// time zone.
+	Until     time.Time
+	untilDate bool
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=12".
+// An "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rrule: empty rule")
+	}
+
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("rrule: invalid part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if r.Freq != Daily && r.Freq != Weekly {
+				return nil, fmt.Errorf("rrule: unsupported FREQ %q, expected DAILY or WEEKLY", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("rrule: invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("rrule: invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := time.Parse("20060102T150405Z", value)
+			if err != nil {
+				until, err = time.Parse("20060102", value)
+				r.untilDate = true
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rrule: invalid UNTIL %q", value)
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := dayNames[strings.ToUpper(code)]
+				if !ok {
+					return nil, fmt.Errorf("rrule: unsupported BYDAY value %q", code)
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return nil, errors.New("rrule: only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("rrule: unsupported part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("rrule: FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("rrule: COUNT and UNTIL are mutually exclusive")
+	}
+
+	return r, nil
+}
+
+// String formats the rule in canonical RRULE form, without the "RRULE:"
+// prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = dayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences starting in [from, to) for a series
+// whose first occurrence is on or after start. Occurrences keep start's
+// wall-clock time in start's location, so they don't drift across DST
+// changes.
+func (r *Rule) Between(start, from, to time.Time) []time.Time {
+	loc := start.Location()
+	year, month, day := start.Date()
+	hour, minute, sec := start.Clock()
+
+	until := r.Until
+	if r.untilDate {
+		uy, um, ud := r.Until.Date()
+		until = time.Date(uy, um, ud+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+	}
+
+	days := r.ByDay
+	if len(days) == 0 && r.Freq == Weekly {
+		days = []time.Weekday{start.Weekday()}
+	}
+	// days since the Monday of the first week, for weekly intervals
+	mondayOffset := (int(start.Weekday()) + 6) % 7
+
+	var occurrences []time.Time
+	count := 0
+	for i := 0; i < maxDays; i++ {
+		t := time.Date(year, month, day+i, hour, minute, sec, 0, loc)
+		if !t.Before(to) || (!until.IsZero() && t.After(until)) {
+			break
+		}
+
+		var matches bool
+		switch r.Freq {
+		case Daily:
+			matches = i%r.Interval == 0 && (len(days) == 0 || hasDay(days, t.Weekday()))
+		case Weekly:
+			matches = ((i+mondayOffset)/7)%r.Interval == 0 && hasDay(days, t.Weekday())
+		}
+		if !matches {
+			continue
+		}
+
+		count++
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+		if r.Count > 0 && count >= r.Count {
+			break
+		}
+	}
+
+	return occurrences
+}
+
+func hasDay(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// Package schedule expands recurring workout schedules into occurrences in
+// the user's timezone and matches them against logged workouts.
+package schedule
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/rrule"
+	"github.com/strangecousinwst/goworkout/internal/store"
+)
+
+const (
+	StatusPlanned   = "planned"
+	StatusCompleted = "completed"
+	StatusMissed    = "missed"
+	StatusSkipped   = "skipped"
+)
+
+// Occurrence is one planned session of a schedule.
+type Occurrence struct {
+	ScheduleID int    `json:"schedule_id"`
+	Title      string `json:"title"`
+	// Date is the local date the occurrence originally fell on, which
+	// identifies it for skip and reschedule.
+	Date        string    `json:"date"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Status      string    `json:"status"`
+	Rescheduled bool      `json:"rescheduled"`
+	// WorkoutID is the logged workout that fulfilled the occurrence.
+	WorkoutID *int `json:"workout_id"`
+}
+
+// LocalStart places the schedule's wall-clock start time in loc.
+func LocalStart(s *store.Schedule, loc *time.Location) time.Time {
+	y, m, d := s.StartsAt.Date()
+	hour, minute, sec := s.StartsAt.Clock()
+	return time.Date(y, m, d, hour, minute, sec, 0, loc)
+}
+
+// IsOccurrence reports whether the rule of s produces an occurrence on the
+// given local date.
+func IsOccurrence(s *store.Schedule, rule *rrule.Rule, date time.Time, loc *time.Location) bool {
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	return len(rule.Between(LocalStart(s, loc), dayStart, dayStart.AddDate(0, 0, 1))) > 0
+}
+
+// Expand returns the occurrences of schedules starting in [from, to),
+// ordered by start. Skipped occurrences are included with StatusSkipped;
+// rescheduled ones appear at their new time.
+func Expand(schedules []store.Schedule, loc *time.Location, from, to time.Time) []Occurrence {
+	var occurrences []Occurrence
+
+	for i := range schedules {
+		s := &schedules[i]
+		rule, err := rrule.Parse(s.RRule)
+		if err != nil {
+			// rules are validated on write; ignore anything unreadable
+			continue
+		}
+
+		exceptions := make(map[string]*store.ScheduleException, len(s.Exceptions))
+		for j := range s.Exceptions {
+			exceptions[s.Exceptions[j].OccurrenceDate] = &s.Exceptions[j]
+		}
+
+		length := time.Duration(s.DurationMinutes) * time.Minute
+		for _, start := range rule.Between(LocalStart(s, loc), from, to) {
+			date := start.Format(store.DateLayout)
+			occurrence := Occurrence{
+				ScheduleID: s.ID,
+				Title:      s.Title,
+				Date:       date,
+				Start:      start,
+				End:        start.Add(length),
+				Status:     StatusPlanned,
+			}
+
+			if exception, ok := exceptions[date]; ok {
+				if exception.Status == store.ExceptionRescheduled {
+					// added below if its new time is in range
+					continue
+				}
+				occurrence.Status = StatusSkipped
+			}
+			occurrences = append(occurrences, occurrence)
+		}
+
+		for _, exception := range s.Exceptions {
+			if exception.Status != store.ExceptionRescheduled || exception.RescheduledTo == nil {
+				continue
+			}
+			start := exception.RescheduledTo.In(loc)
+			if start.Before(from) || !start.Before(to) {
+				continue
+			}
+			occurrences = append(occurrences, Occurrence{
+				ScheduleID:  s.ID,
+				Title:       s.Title,
+				Date:        exception.OccurrenceDate,
+				Start:       start,
+				End:         start.Add(length),
+				Status:      StatusPlanned,
+				Rescheduled: true,
+			})
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	return occurrences
+}
+
+// Match links each planned occurrence to at most one workout logged on the
+// same local day, preferring a workout with the same title. Planned
+// occurrences whose day has ended without a match become missed.
+func Match(occurrences []Occurrence, workouts []store.Workout, loc *time.Location, now time.Time) {
+	used := make(map[int]bool, len(workouts))
+
+	tryMatch := func(o *Occurrence, sameTitle bool) {
+		day := localDay(o.Start, loc)
+		var best *store.Workout
+		for i := range workouts {
+			w := &workouts[i]
+			if used[w.ID] || localDay(w.StartedAt, loc) != day {
+				continue
+			}
+			if sameTitle && !strings.EqualFold(strings.TrimSpace(w.Title), strings.TrimSpace(o.Title)) {
+				continue
+			}
+			if best == nil || absDuration(w.StartedAt.Sub(o.Start)) < absDuration(best.StartedAt.Sub(o.Start)) {
+				best = w
+			}
+		}
+		if best != nil {
+			used[best.ID] = true
+			id := best.ID
+			o.WorkoutID = &id
+			o.Status = StatusCompleted
+		}
+	}
+
+	// title matches first, so a generic workout doesn't take the slot of
+	// one that was clearly logged for this session
+	for _, sameTitle := range []bool{true, false} {
+		for i := range occurrences {
+			if occurrences[i].Status == StatusPlanned {
+				tryMatch(&occurrences[i], sameTitle)
+			}
+		}
+	}
+
+	today := localDay(now, loc)
+	for i := range occurrences {
+		if occurrences[i].Status == StatusPlanned && localDay(occurrences[i].Start, loc) < today {
+			occurrences[i].Status = StatusMissed
+		}
+	}
+}
+
+// localDay returns t's date in loc as a sortable YYYY-MM-DD string.
+func localDay(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(store.DateLayout)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -26,15 +26,126 @@ func (s *Server) RegisterRoutes() http.Handler {
 		r.Use(s.Middleware.Authenticate)
 
 		r.Get("/workouts/", s.Middleware.RequireUser(s.WorkoutAPI.HandleGetUserWorkouts))
+		r.Get("/workouts/search", s.Middleware.RequireUser(s.WorkoutAPI.HandleSearchWorkouts))
+		r.Get("/workouts/compare", s.Middleware.RequireUser(s.WorkoutAPI.HandleCompareWorkouts))
 		r.Get("/workouts/{id}", s.Middleware.RequireUser(s.WorkoutAPI.HandleGetWorkoutByID))
 		r.Post("/workouts/", s.Middleware.RequireUser(s.WorkoutAPI.HandleCreateWorkout))
+		r.Post("/workouts/parse", s.Middleware.RequireUser(s.WorkoutAPI.HandleParseQuickLog))
+		r.Post("/workouts/quick", s.Middleware.RequireUser(s.WorkoutAPI.HandleQuickLog))
 		r.Put("/workouts/{id}", s.Middleware.RequireUser(s.WorkoutAPI.HandleUpdateWorkoutByID))
 		r.Delete("/workouts/{id}", s.Middleware.RequireUser(s.WorkoutAPI.HandleDeleteWorkoutByID))
+		r.Get("/workouts/{id}/heart-rate", s.Middleware.RequireUser(s.WorkoutAPI.HandleGetHeartRate))
+		r.Put("/workouts/{id}/heart-rate", s.Middleware.RequireUser(s.WorkoutAPI.HandleUpdateHeartRate))
+		r.Post("/workouts/{id}/share", s.Middleware.RequireUser(s.WorkoutAPI.HandleCreateShareLink))
+		r.Delete("/workouts/{id}/share", s.Middleware.RequireUser(s.WorkoutAPI.HandleRevokeShareLinks))
+		r.Get("/workouts/{id}/comments", s.Middleware.RequireUser(s.CommentAPI.HandleGetComments))
+		r.Post("/workouts/{id}/comments", s.Middleware.RequireUser(s.CommentAPI.HandleCreateComment))
+		r.Delete("/workouts/{id}/comments/{commentID}", s.Middleware.RequireUser(s.CommentAPI.HandleDeleteComment))
+		r.Get("/workouts/{id}/reactions", s.Middleware.RequireUser(s.CommentAPI.HandleGetReactions))
+		r.Put("/workouts/{id}/reactions/{emoji}", s.Middleware.RequireUser(s.CommentAPI.HandleAddReaction))
+		r.Delete("/workouts/{id}/reactions/{emoji}", s.Middleware.RequireUser(s.CommentAPI.HandleRemoveReaction))
+		r.Get("/wods/{name}/results", s.Middleware.RequireUser(s.WorkoutAPI.HandleGetWODResults))
+
+		r.Get("/users/me", s.Middleware.RequireUser(s.UserAPI.HandleGetCurrentUser))
+		r.Get("/users/me/heart-rate", s.Middleware.RequireUser(s.UserAPI.HandleGetHeartRateProfile))
+		r.Put("/users/me/heart-rate", s.Middleware.RequireUser(s.UserAPI.HandleUpdateHeartRateProfile))
+		r.Put("/users/me/timezone", s.Middleware.RequireUser(s.UserAPI.HandleUpdateTimezone))
+		r.Put("/users/me/privacy", s.Middleware.RequireUser(s.SocialAPI.HandleUpdatePrivacy))
+		r.Get("/users/me/followers", s.Middleware.RequireUser(s.SocialAPI.HandleGetFollowers))
+		r.Delete("/users/me/followers/{id}", s.Middleware.RequireUser(s.SocialAPI.HandleRemoveFollower))
+		r.Get("/users/me/following", s.Middleware.RequireUser(s.SocialAPI.HandleGetFollowing))
+		r.Get("/users/me/follow-requests", s.Middleware.RequireUser(s.SocialAPI.HandleGetFollowRequests))
+		r.Post("/users/me/follow-requests/{id}/approve", s.Middleware.RequireUser(s.SocialAPI.HandleApproveFollowRequest))
+		r.Delete("/users/me/follow-requests/{id}", s.Middleware.RequireUser(s.SocialAPI.HandleRemoveFollower))
+		r.Post("/users/{id}/follow", s.Middleware.RequireUser(s.SocialAPI.HandleFollow))
+		r.Delete("/users/{id}/follow", s.Middleware.RequireUser(s.SocialAPI.HandleUnfollow))
+		r.Get("/feed", s.Middleware.RequireUser(s.SocialAPI.HandleGetFeed))
+
+		r.Get("/coaching/coaches", s.Middleware.RequireUser(s.CoachAPI.HandleGetCoaches))
+		r.Put("/coaching/coaches/{id}", s.Middleware.RequireUser(s.CoachAPI.HandleGrantCoach))
+		r.Delete("/coaching/coaches/{id}", s.Middleware.RequireUser(s.CoachAPI.HandleRevokeCoach))
+		r.Get("/coaching/athletes", s.Middleware.RequireUser(s.CoachAPI.HandleGetAthletes))
+		r.Post("/coaching/athletes/{id}/accept", s.Middleware.RequireUser(s.CoachAPI.HandleAcceptAthlete))
+		r.Delete("/coaching/athletes/{id}", s.Middleware.RequireUser(s.CoachAPI.HandleLeaveAthlete))
+		r.Get("/coaching/audit", s.Middleware.RequireUser(s.CoachAPI.HandleGetAuditLog))
+
+		r.Get("/messages/threads", s.Middleware.RequireUser(s.MessageAPI.HandleGetThreads))
+		r.Post("/messages/threads", s.Middleware.RequireUser(s.MessageAPI.HandleCreateThread))
+		r.Get("/messages/threads/{id}", s.Middleware.RequireUser(s.MessageAPI.HandleGetThread))
+		r.Post("/messages/threads/{id}/messages", s.Middleware.RequireUser(s.MessageAPI.HandleSendMessage))
+		r.Post("/messages/threads/{id}/read", s.Middleware.RequireUser(s.MessageAPI.HandleMarkRead))
+		r.Get("/messages/unread", s.Middleware.RequireUser(s.MessageAPI.HandleGetUnreadCount))
+
+		r.Get("/orgs", s.Middleware.RequireUser(s.OrgAPI.HandleGetOrgs))
+		r.Post("/orgs", s.Middleware.RequireUser(s.OrgAPI.HandleCreateOrg))
+		r.Get("/orgs/{id}", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleGetOrg)))
+		r.Get("/orgs/{id}/members", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleGetMembers)))
+		r.Post("/orgs/{id}/members", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleAddMember)))
+		r.Put("/orgs/{id}/members/{userID}", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleUpdateMemberRole)))
+		r.Delete("/orgs/{id}/members/{userID}", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleRemoveMember)))
+		r.Put("/orgs/{id}/leaderboard/opt-in", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleUpdateLeaderboardOptIn)))
+		r.Get("/orgs/{id}/leaderboard", s.Middleware.RequireUser(s.Middleware.RequireOrgMember(s.OrgAPI.HandleGetLeaderboard)))
+
+		r.Get("/challenges", s.Middleware.RequireUser(s.ChallengeAPI.HandleGetChallenges))
+		r.Post("/challenges", s.Middleware.RequireUser(s.ChallengeAPI.HandleCreateChallenge))
+		r.Get("/challenges/{id}", s.Middleware.RequireUser(s.ChallengeAPI.HandleGetChallenge))
+		r.Delete("/challenges/{id}", s.Middleware.RequireUser(s.ChallengeAPI.HandleDeleteChallenge))
+		r.Post("/challenges/{id}/join", s.Middleware.RequireUser(s.ChallengeAPI.HandleJoinChallenge))
+		r.Delete("/challenges/{id}/join", s.Middleware.RequireUser(s.ChallengeAPI.HandleLeaveChallenge))
+
+		r.Get("/tags", s.Middleware.RequireUser(s.TagAPI.HandleGetTags))
+		r.Put("/tags/{id}", s.Middleware.RequireUser(s.TagAPI.HandleRenameTag))
+		r.Post("/tags/{id}/merge", s.Middleware.RequireUser(s.TagAPI.HandleMergeTag))
+		r.Delete("/tags/{id}", s.Middleware.RequireUser(s.TagAPI.HandleDeleteTag))
+
+		r.Get("/exercises/suggest", s.Middleware.RequireUser(s.ExerciseAPI.HandleSuggestExercises))
+		r.Post("/exercises/merge/preview", s.Middleware.RequireUser(s.ExerciseAPI.HandlePreviewExerciseMerge))
+		r.Post("/exercises/merge", s.Middleware.RequireUser(s.ExerciseAPI.HandleMergeExercises))
+
+		r.Get("/analytics/weekly", s.Middleware.RequireUser(s.AnalyticsAPI.HandleGetWeekly))
+		r.Get("/analytics/types", s.Middleware.RequireUser(s.AnalyticsAPI.HandleGetActivityTypes))
+		r.Get("/analytics/workouts/{id}", s.Middleware.RequireUser(s.AnalyticsAPI.HandleGetWorkoutAnalytics))
+
+		r.Get("/exports/workouts", s.Middleware.RequireUser(s.ExportAPI.HandleExportWorkouts))
+		r.Post("/exports/workouts", s.Middleware.RequireUser(s.ExportAPI.HandleCreateExport))
+		r.Get("/exports/{id}", s.Middleware.RequireUser(s.ExportAPI.HandleGetExport))
+		r.Get("/exports/{id}/download", s.Middleware.RequireUser(s.ExportAPI.HandleDownloadExport))
+
+		r.Post("/imports/fit", s.Middleware.RequireUser(s.ImportAPI.HandleImportFIT))
+		r.Post("/imports/csv", s.Middleware.RequireUser(s.ImportAPI.HandleImportCSV))
+		r.Post("/imports/apple-health", s.Middleware.RequireUser(s.ImportAPI.HandleImportAppleHealth))
+
+		r.Post("/calendar/token", s.Middleware.RequireUser(s.CalendarAPI.HandleCreateCalendarToken))
+		r.Delete("/calendar/token", s.Middleware.RequireUser(s.CalendarAPI.HandleRevokeCalendarToken))
+
+		r.Get("/schedules", s.Middleware.RequireUser(s.ScheduleAPI.HandleGetSchedules))
+		r.Post("/schedules", s.Middleware.RequireUser(s.ScheduleAPI.HandleCreateSchedule))
+		r.Delete("/schedules/{id}", s.Middleware.RequireUser(s.ScheduleAPI.HandleDeleteSchedule))
+		r.Post("/schedules/{id}/occurrences/{date}/skip", s.Middleware.RequireUser(s.ScheduleAPI.HandleSkipOccurrence))
+		r.Post("/schedules/{id}/occurrences/{date}/reschedule", s.Middleware.RequireUser(s.ScheduleAPI.HandleRescheduleOccurrence))
+		r.Delete("/schedules/{id}/occurrences/{date}", s.Middleware.RequireUser(s.ScheduleAPI.HandleRestoreOccurrence))
+		r.Get("/schedule", s.Middleware.RequireUser(s.ScheduleAPI.HandleGetOccurrences))
+
+		r.Get("/measurements", s.Middleware.RequireUser(s.MeasurementAPI.HandleGetMeasurements))
+		r.Post("/measurements", s.Middleware.RequireUser(s.MeasurementAPI.HandleCreateMeasurement))
+		r.Get("/measurements/trend", s.Middleware.RequireUser(s.MeasurementAPI.HandleGetTrend))
+		r.Get("/measurements/{id}", s.Middleware.RequireUser(s.MeasurementAPI.HandleGetMeasurementByID))
+		r.Put("/measurements/{id}", s.Middleware.RequireUser(s.MeasurementAPI.HandleUpdateMeasurement))
+		r.Delete("/measurements/{id}", s.Middleware.RequireUser(s.MeasurementAPI.HandleDeleteMeasurement))
+
+		r.Get("/goals", s.Middleware.RequireUser(s.GoalAPI.HandleGetGoals))
+		r.Post("/goals", s.Middleware.RequireUser(s.GoalAPI.HandleCreateGoal))
+		r.Get("/goals/{id}", s.Middleware.RequireUser(s.GoalAPI.HandleGetGoalByID))
+		r.Delete("/goals/{id}", s.Middleware.RequireUser(s.GoalAPI.HandleDeleteGoal))
+
+		r.Get("/achievements", s.Middleware.RequireUser(s.AchievementAPI.HandleGetAchievements))
 	})
 
 	r.Get("/health", s.healthHandler)
 	r.Post("/users", s.UserAPI.HandleRegisterUser)
 	r.Post("/tokens/authentication", s.TokenAPI.HandleCreateToken)
+	r.Get("/calendar/{token}.ics", s.CalendarAPI.HandleGetCalendarFeed)
+	r.Get("/shared/workouts/{token}", s.WorkoutAPI.HandleGetSharedWorkout)
 
 	return r
 }
@@ -6,12 +6,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
 	"github.com/strangecousinwst/goworkout/internal/api"
+	"github.com/strangecousinwst/goworkout/internal/authz"
 	"github.com/strangecousinwst/goworkout/internal/database"
 	"github.com/strangecousinwst/goworkout/internal/middleware"
 	"github.com/strangecousinwst/goworkout/internal/store"
@@ -19,13 +21,29 @@ import (
 )
 
 type Server struct {
-	port       int
-	Logger     *log.Logger
-	WorkoutAPI *api.WorkoutAPI
-	UserAPI    *api.UserAPI
-	TokenAPI   *api.TokenAPI
-	Middleware middleware.UserMiddleware
-	db         database.Service
+	port           int
+	Logger         *log.Logger
+	WorkoutAPI     *api.WorkoutAPI
+	UserAPI        *api.UserAPI
+	TokenAPI       *api.TokenAPI
+	ImportAPI      *api.ImportAPI
+	AnalyticsAPI   *api.AnalyticsAPI
+	ExportAPI      *api.ExportAPI
+	CalendarAPI    *api.CalendarAPI
+	ScheduleAPI    *api.ScheduleAPI
+	MeasurementAPI *api.MeasurementAPI
+	GoalAPI        *api.GoalAPI
+	AchievementAPI *api.AchievementAPI
+	SocialAPI      *api.SocialAPI
+	CommentAPI     *api.CommentAPI
+	CoachAPI       *api.CoachAPI
+	MessageAPI     *api.MessageAPI
+	OrgAPI         *api.OrgAPI
+	ChallengeAPI   *api.ChallengeAPI
+	TagAPI         *api.TagAPI
+	ExerciseAPI    *api.ExerciseAPI
+	Middleware     middleware.UserMiddleware
+	db             database.Service
 }
 
 func NewServer() *http.Server {
@@ -52,21 +70,86 @@ func NewServer() *http.Server {
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	analyticsStore := store.NewPostgresAnalyticsStore(pgDB)
+	exportStore := store.NewPostgresExportStore(pgDB)
+	measurementStore := store.NewPostgresMeasurementStore(pgDB)
+	scheduleStore := store.NewPostgresScheduleStore(pgDB)
+	goalStore := store.NewPostgresGoalStore(pgDB)
+	achievementStore := store.NewPostgresAchievementStore(pgDB)
+	socialStore := store.NewPostgresSocialStore(pgDB)
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	coachStore := store.NewPostgresCoachStore(pgDB)
+	messageStore := store.NewPostgresMessageStore(pgDB)
+	orgStore := store.NewPostgresOrgStore(pgDB)
+	challengeStore := store.NewPostgresChallengeStore(pgDB)
+	tagStore := store.NewPostgresTagStore(pgDB)
+
+	// derived data recomputed whenever workouts or measurements change
+	workoutStore.AddWriteHook(goalStore.RecomputeGoals)
+	measurementStore.AddWriteHook(goalStore.RecomputeGoals)
+	workoutStore.AddWriteHook(achievementStore.SyncAchievements)
+	workoutStore.AddWriteHook(challengeStore.UpdateStandings)
+
+	checker := authz.NewChecker(workoutStore, socialStore, coachStore)
 
 	// TODO: Implement handlers
-	workoutAPI := api.NewWorkoutAPI(workoutStore, logger)
+	workoutAPI := api.NewWorkoutAPI(workoutStore, achievementStore, tokenStore, checker, logger)
 	userAPI := api.NewUserAPI(userStore, logger)
 	tokenAPI := api.NewTokenAPI(tokenStore, userStore, logger)
-	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	importAPI := api.NewImportAPI(workoutStore, measurementStore, logger)
+	analyticsAPI := api.NewAnalyticsAPI(analyticsStore, workoutStore, measurementStore, checker, logger)
+	calendarAPI := api.NewCalendarAPI(workoutStore, scheduleStore, tokenStore, userStore, logger)
+	scheduleAPI := api.NewScheduleAPI(scheduleStore, workoutStore, checker, logger)
+	measurementAPI := api.NewMeasurementAPI(measurementStore, logger)
+	goalAPI := api.NewGoalAPI(goalStore, measurementStore, logger)
+	achievementAPI := api.NewAchievementAPI(achievementStore, logger)
+	socialAPI := api.NewSocialAPI(socialStore, logger)
+	commentAPI := api.NewCommentAPI(commentStore, checker, logger)
+	coachAPI := api.NewCoachAPI(coachStore, socialStore, logger)
+	messageAPI := api.NewMessageAPI(messageStore, workoutStore, checker, logger)
+	orgAPI := api.NewOrgAPI(orgStore, socialStore, logger)
+	challengeAPI := api.NewChallengeAPI(challengeStore, orgStore, logger)
+	tagAPI := api.NewTagAPI(tagStore, logger)
+	exerciseAPI := api.NewExerciseAPI(workoutStore, logger)
+
+	exportDir := os.Getenv("GOWORKOUT_EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = filepath.Join(os.TempDir(), "goworkout-exports")
+	}
+	exportAPI := api.NewExportAPI(workoutStore, exportStore, exportDir, logger)
+	// export jobs run in this process, so ones in flight when it last
+	// stopped are lost
+	err = exportAPI.RecoverExports()
+	if err != nil {
+		logger.Printf("ERROR: recovering exports: %v", err)
+	}
+	go exportAPI.RunExpiry()
+	middlewareHandler := middleware.UserMiddleware{UserStore: userStore, OrgStore: orgStore}
 
 	server := &Server{
-		port:       port,
-		Logger:     logger,
-		WorkoutAPI: workoutAPI,
-		UserAPI:    userAPI,
-		TokenAPI:   tokenAPI,
-		Middleware: middlewareHandler,
-		db:         dbService,
+		port:           port,
+		Logger:         logger,
+		WorkoutAPI:     workoutAPI,
+		UserAPI:        userAPI,
+		TokenAPI:       tokenAPI,
+		ImportAPI:      importAPI,
+		AnalyticsAPI:   analyticsAPI,
+		ExportAPI:      exportAPI,
+		CalendarAPI:    calendarAPI,
+		ScheduleAPI:    scheduleAPI,
+		MeasurementAPI: measurementAPI,
+		GoalAPI:        goalAPI,
+		AchievementAPI: achievementAPI,
+		SocialAPI:      socialAPI,
+		CommentAPI:     commentAPI,
+		CoachAPI:       coachAPI,
+		MessageAPI:     messageAPI,
+		OrgAPI:         orgAPI,
+		ChallengeAPI:   challengeAPI,
+		TagAPI:         tagAPI,
+		ExerciseAPI:    exerciseAPI,
+		Middleware:     middlewareHandler,
+		db:             dbService,
 	}
 
 	// Declare Server config
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/achievement"
+)
+
+// Achievement is a badge the user holds.
+type Achievement struct {
+	achievement.Rule
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+type PostgresAchievementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAchievementStore(db *sql.DB) *PostgresAchievementStore {
+	return &PostgresAchievementStore{
+		db: db,
+	}
+}
+
+type AchievementStore interface {
+	GetAchievementsForUser(userID int) ([]Achievement, error)
+	GetAchievementStats(userID int) (*achievement.Stats, error)
+	SyncAchievements(tx *sql.Tx, userID int) error
+}
+
+// GetAchievementsForUser returns the user's badges, most recent first.
+// Rows whose rule has since been removed are skipped.
+func (pg *PostgresAchievementStore) GetAchievementsForUser(userID int) ([]Achievement, error) {
+	query := `
+	SELECT key, awarded_at
+	FROM achievements
+	WHERE user_id = $1
+	ORDER BY awarded_at DESC, key
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var achievements []Achievement
+	for rows.Next() {
+		var key string
+		var a Achievement
+		err = rows.Scan(&key, &a.AwardedAt)
+		if err != nil {
+			return nil, err
+		}
+		rule, ok := achievement.Lookup(key)
+		if !ok {
+			continue
+		}
+		a.Rule = rule
+		achievements = append(achievements, a)
+	}
+
+	return achievements, rows.Err()
+}
+
+func (pg *PostgresAchievementStore) GetAchievementStats(userID int) (*achievement.Stats, error) {
+	return achievementStats(pg.db, userID)
+}
+
+// SyncAchievements makes the user's badges match the rules their data
+// currently satisfies: new ones are awarded and ones no longer earned,
+// e.g. after deleting a workout, are taken back. Badges still held keep
+// their original award time. It is registered as a WriteHook on the
+// workout store.
+func (pg *PostgresAchievementStore) SyncAchievements(tx *sql.Tx, userID int) error {
+	stats, err := achievementStats(tx, userID)
+	if err != nil {
+		return err
+	}
+	earned := achievement.Evaluate(stats)
+	if earned == nil {
+		earned = []string{}
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM achievements
+	WHERE user_id = $1 AND NOT (key = ANY($2))
+	`, userID, earned)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO achievements (user_id, key)
+	SELECT $1, UNNEST($2::TEXT[])
+	ON CONFLICT (user_id, key) DO NOTHING
+	`, userID, earned)
+	return err
+}
+
+// achievementStats gathers the numbers rules are evaluated against.
+func achievementStats(db queryer, userID int) (*achievement.Stats, error) {
+	stats := &achievement.Stats{}
+
+	var timezone string
+	err := db.QueryRow(`SELECT timezone FROM users WHERE id = $1`, userID).Scan(&timezone)
+	if err != nil {
+		return nil, err
+	}
+	loc := (&User{Timezone: timezone}).Location()
+
+	rows, err := db.Query(`SELECT started_at FROM workouts WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var starts []time.Time
+	for rows.Next() {
+		var t time.Time
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	stats.Workouts = len(starts)
+	stats.CurrentWeekStreak, stats.LongestWeekStreak = achievement.WeekStreaks(starts, loc, time.Now())
+
+	// matches analytics.WorkoutVolume
+	err = db.QueryRow(`
+	SELECT COALESCE(SUM(e.sets * e.reps * e.weight * COALESCE(g.rounds, 1)), 0)
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE w.user_id = $1
+	`, userID).Scan(&stats.TotalVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+	SELECT COUNT(*)
+	FROM (
+		SELECT e.weight, MAX(e.weight) OVER (
+			PARTITION BY LOWER(e.exercise_name)
+			ORDER BY w.started_at, e.id
+			ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+		) AS previous_best
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND e.weight IS NOT NULL
+	) t
+	WHERE weight > previous_best
+	`, userID).Scan(&stats.PersonalRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
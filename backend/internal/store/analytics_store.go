@@ -0,0 +1,177 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+)
+
+type PostgresAnalyticsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAnalyticsStore(db *sql.DB) *PostgresAnalyticsStore {
+	return &PostgresAnalyticsStore{
+		db: db,
+	}
+}
+
+// AnalyticsStore loads a user's history for a time range in bulk, so that
+// aggregations don't have to go through one workout at a time.
+type AnalyticsStore interface {
+	GetWorkoutsBetween(userID int, from, to time.Time) ([]Workout, error)
+	GetHeartRateLoadsBetween(userID int, from, to time.Time, profile heartrate.Profile) (map[int]heartrate.Load, error)
+}
+
+// GetWorkoutsBetween returns the user's workouts started in [from, to),
+// oldest first, with their entries.
+func (pg *PostgresAnalyticsStore) GetWorkoutsBetween(userID int, from, to time.Time) ([]Workout, error) {
+	query := `
+	SELECT id, user_id, title, description, started_at, duration_minutes, calories_burned, distance_meters, avg_heart_rate, max_heart_rate,
+		activity_type
+	FROM workouts
+	WHERE user_id = $1 AND started_at >= $2 AND started_at < $3
+	ORDER BY started_at, id
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workouts []Workout
+	index := make(map[int]int)
+	for rows.Next() {
+		var w Workout
+		err = rows.Scan(
+			&w.ID,
+			&w.UserID,
+			&w.Title,
+			&w.Description,
+			&w.StartedAt,
+			&w.DurationMinutes,
+			&w.CaloriesBurned,
+			&w.DistanceMeters,
+			&w.AvgHeartRate,
+			&w.MaxHeartRate,
+			&w.ActivityType,
+		)
+		if err != nil {
+			return nil, err
+		}
+		index[w.ID] = len(workouts)
+		workouts = append(workouts, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entryQuery := `
+	SELECT e.workout_id, ` + entryColumns + `
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE w.user_id = $1 AND w.started_at >= $2 AND w.started_at < $3
+	ORDER BY e.workout_id, ` + entryOrder + `
+	`
+
+	entryRows, err := pg.db.Query(entryQuery, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer entryRows.Close()
+
+	for entryRows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		var group groupColumns
+		dest := append([]any{&workoutID}, entry.scanDest()...)
+		err = entryRows.Scan(append(dest, group.scanDest()...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[workoutID]; ok {
+			workouts[i].addEntry(entry, &group)
+		}
+	}
+
+	return workouts, entryRows.Err()
+}
+
+// GetHeartRateLoadsBetween reduces the heart-rate series of every workout
+// started in [from, to) to its TRIMP and time in zones under profile,
+// keyed by workout ID. Workouts without samples are left out. The
+// reduction is done by the database, mirroring heartrate.TRIMP and
+// heartrate.TimeInZones, so a long range doesn't load every sample.
+func (pg *PostgresAnalyticsStore) GetHeartRateLoadsBetween(userID int, from, to time.Time, profile heartrate.Profile) (map[int]heartrate.Load, error) {
+	// an incomplete profile has no zones, only TRIMP
+	zones, _ := heartrate.Zones(profile)
+	bounds := make([]int32, len(zones))
+	for i, z := range zones {
+		bounds[i] = int32(z.MinBPM)
+	}
+	resting, maxHR, trimp := profile.Reserve()
+
+	// each sample lasts until the next, capped at the gap limit; the last
+	// one lasts a second. Zone 0 is below zone 1 and only counts for TRIMP.
+	query := `
+	WITH timed AS (
+		SELECT s.workout_id, s.bpm,
+			CASE WHEN LEAD(s.offset_seconds) OVER series IS NULL THEN 1
+				ELSE LEAST(GREATEST(LEAD(s.offset_seconds) OVER series - s.offset_seconds, 0), $4::int)
+			END AS seconds
+		FROM workout_heart_rate_samples s
+		INNER JOIN workouts w ON w.id = s.workout_id
+		WHERE w.user_id = $1 AND w.started_at >= $2 AND w.started_at < $3
+		WINDOW series AS (PARTITION BY s.workout_id ORDER BY s.offset_seconds)
+	), reserved AS (
+		SELECT workout_id, bpm, seconds,
+			LEAST(GREATEST((bpm - $6::int)::float8 / NULLIF($7::int - $6::int, 0), 0), 1) AS reserve
+		FROM timed
+	)
+	SELECT workout_id,
+		CASE WHEN cardinality($5::int[]) = 0 THEN 0 ELSE width_bucket(bpm, $5::int[]) END AS zone,
+		SUM(seconds)::int,
+		COALESCE(SUM(seconds / 60.0 * reserve * $8::float8 * exp($9::float8 * reserve)), 0)
+	FROM reserved
+	GROUP BY workout_id, zone
+	ORDER BY workout_id, zone
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to, heartrate.MaxSampleGap, bounds,
+		resting, maxHR, heartrate.TRIMPFactor, heartrate.TRIMPExponent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loads := make(map[int]heartrate.Load)
+	for rows.Next() {
+		var workoutID, zone, seconds int
+		var load float64
+		err = rows.Scan(&workoutID, &zone, &seconds, &load)
+		if err != nil {
+			return nil, err
+		}
+
+		l, ok := loads[workoutID]
+		if !ok && len(zones) > 0 {
+			l.TimeInZones = make([]heartrate.ZoneTime, len(zones))
+			for i, z := range zones {
+				l.TimeInZones[i].Zone = z.Number
+			}
+		}
+		if zone > 0 {
+			l.TimeInZones[zone-1].Seconds += seconds
+		}
+		if trimp {
+			l.TRIMP += load
+		}
+		loads[workoutID] = l
+	}
+
+	return loads, rows.Err()
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+const (
+	// ChallengeDistance is entry distance in meters.
+	ChallengeDistance = "distance"
+	// ChallengeReps counts every rep of every set.
+	ChallengeReps = "reps"
+	// ChallengeVolume matches analytics.WorkoutVolume.
+	ChallengeVolume = "volume"
+)
+
+// Challenge is a competition over a metric of workout entries between its
+// starts_on and ends_on dates. Participants opt in by joining.
+type Challenge struct {
+	ID           int       `json:"id"`
+	OrgID        *int      `json:"org_id"`
+	CreatedBy    *int      `json:"created_by"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Metric       string    `json:"metric"`
+	ExerciseName *string   `json:"exercise_name"`
+	DailyTarget  *float64  `json:"daily_target"`
+	StartsOn     string    `json:"starts_on"`
+	EndsOn       string    `json:"ends_on"`
+	Timezone     string    `json:"timezone"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	// FinalizedAt is set once the final ranks are recorded.
+	FinalizedAt      *time.Time `json:"finalized_at"`
+	ParticipantCount int        `json:"participant_count"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Ended reports whether the challenge is over at now. Standings stop
+// changing at that point even before they are finalized.
+func (c *Challenge) Ended(now time.Time) bool {
+	return !now.Before(c.EndsAt)
+}
+
+// Status is "upcoming", "active" or "ended" at now.
+func (c *Challenge) Status(now time.Time) string {
+	switch {
+	case now.Before(c.StartsAt):
+		return "upcoming"
+	case c.Ended(now):
+		return "ended"
+	default:
+		return "active"
+	}
+}
+
+// UserChallenge is a challenge as listed to a user.
+type UserChallenge struct {
+	Challenge
+	Joined bool `json:"joined"`
+}
+
+// Standing is a participant's place in a challenge. Tied values share a
+// rank.
+type Standing struct {
+	Rank  int         `json:"rank"`
+	User  UserSummary `json:"user"`
+	Value float64     `json:"value"`
+}
+
+type PostgresChallengeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChallengeStore(db *sql.DB) *PostgresChallengeStore {
+	return &PostgresChallengeStore{
+		db: db,
+	}
+}
+
+type ChallengeStore interface {
+	CreateChallenge(*Challenge) error
+	GetChallengeByID(id int) (*Challenge, error)
+	GetChallengesForUser(userID int) ([]UserChallenge, error)
+	DeleteChallenge(id int) error
+	Join(challengeID, userID int) error
+	Leave(challengeID, userID int) error
+	GetStandings(challengeID int) ([]Standing, error)
+	FinalizeChallenge(id int) error
+	UpdateStandings(tx *sql.Tx, userID int) error
+}
+
+func (pg *PostgresChallengeStore) CreateChallenge(c *Challenge) error {
+	query := `
+	INSERT INTO challenges (org_id, created_by, name, description, metric, exercise_name, daily_target,
+		starts_on, ends_on, timezone, starts_at, ends_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query, c.OrgID, c.CreatedBy, c.Name, c.Description, c.Metric, c.ExerciseName, c.DailyTarget,
+		c.StartsOn, c.EndsOn, c.Timezone, c.StartsAt, c.EndsAt).Scan(&c.ID, &c.CreatedAt)
+}
+
+const challengeColumns = `c.id, c.org_id, c.created_by, c.name, c.description, c.metric, c.exercise_name, c.daily_target,
+	c.starts_on, c.ends_on, c.timezone, c.starts_at, c.ends_at, c.finalized_at, c.created_at,
+	(SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = c.id)`
+
+func (c *Challenge) scan(row interface{ Scan(...any) error }, extra ...any) error {
+	var startsOn, endsOn time.Time
+	dest := []any{&c.ID, &c.OrgID, &c.CreatedBy, &c.Name, &c.Description, &c.Metric, &c.ExerciseName, &c.DailyTarget,
+		&startsOn, &endsOn, &c.Timezone, &c.StartsAt, &c.EndsAt, &c.FinalizedAt, &c.CreatedAt, &c.ParticipantCount}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+	c.StartsOn = startsOn.Format(DateLayout)
+	c.EndsOn = endsOn.Format(DateLayout)
+	return nil
+}
+
+func (pg *PostgresChallengeStore) GetChallengeByID(id int) (*Challenge, error) {
+	c := &Challenge{}
+
+	err := c.scan(pg.db.QueryRow(`SELECT `+challengeColumns+` FROM challenges c WHERE c.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetChallengesForUser lists the open challenges and those of userID's
+// organizations, latest ending first.
+func (pg *PostgresChallengeStore) GetChallengesForUser(userID int) ([]UserChallenge, error) {
+	query := `
+	SELECT ` + challengeColumns + `,
+		EXISTS (SELECT 1 FROM challenge_participants WHERE challenge_id = c.id AND user_id = $1)
+	FROM challenges c
+	WHERE c.org_id IS NULL OR c.org_id IN (SELECT org_id FROM org_members WHERE user_id = $1)
+	ORDER BY c.ends_at DESC, c.id DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []UserChallenge{}
+	for rows.Next() {
+		var c UserChallenge
+		err = c.scan(rows, &c.Joined)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, c)
+	}
+
+	return challenges, rows.Err()
+}
+
+func (pg *PostgresChallengeStore) DeleteChallenge(id int) error {
+	return execOne(pg.db, `DELETE FROM challenges WHERE id = $1`, id)
+}
+
+// Join adds userID to the challenge, counting the workouts they already
+// logged within it. Joining twice is reported as sql.ErrNoRows.
+func (pg *PostgresChallengeStore) Join(challengeID, userID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c := &Challenge{}
+	err = c.scan(tx.QueryRow(`SELECT `+challengeColumns+` FROM challenges c WHERE c.id = $1`, challengeID))
+	if err != nil {
+		return err
+	}
+
+	value, err := challengeValue(tx, c, userID)
+	if err != nil {
+		return err
+	}
+
+	err = execOne(tx, `
+	INSERT INTO challenge_participants (challenge_id, user_id, value)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (challenge_id, user_id) DO NOTHING
+	`, challengeID, userID, value)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresChallengeStore) Leave(challengeID, userID int) error {
+	return execOne(pg.db, `DELETE FROM challenge_participants WHERE challenge_id = $1 AND user_id = $2`, challengeID, userID)
+}
+
+// GetStandings ranks the participants, best first. Finalized challenges
+// report their recorded final ranks.
+func (pg *PostgresChallengeStore) GetStandings(challengeID int) ([]Standing, error) {
+	query := `
+	SELECT COALESCE(p.final_rank, RANK() OVER (ORDER BY p.value DESC)),
+		u.id, u.username, u.bio, u.is_private, p.value
+	FROM challenge_participants p
+	INNER JOIN users u ON u.id = p.user_id
+	WHERE p.challenge_id = $1
+	ORDER BY 1, u.username
+	`
+
+	rows, err := pg.db.Query(query, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings := []Standing{}
+	for rows.Next() {
+		var s Standing
+		var bio sql.NullString
+		err = rows.Scan(&s.Rank, &s.User.ID, &s.User.Username, &bio, &s.User.IsPrivate, &s.Value)
+		if err != nil {
+			return nil, err
+		}
+		s.User.Bio = bio.String
+		standings = append(standings, s)
+	}
+
+	return standings, rows.Err()
+}
+
+// FinalizeChallenge records the final ranks of an ended challenge. It does
+// nothing when the challenge is already finalized.
+func (pg *PostgresChallengeStore) FinalizeChallenge(id int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execOne(tx, `
+	UPDATE challenges
+	SET finalized_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND finalized_at IS NULL AND ends_at <= CURRENT_TIMESTAMP
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	UPDATE challenge_participants p
+	SET final_rank = ranked.rank
+	FROM (
+		SELECT user_id, RANK() OVER (ORDER BY value DESC) AS rank
+		FROM challenge_participants
+		WHERE challenge_id = $1
+	) ranked
+	WHERE p.challenge_id = $1 AND p.user_id = ranked.user_id
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStandings refreshes the user's value in the challenges they take
+// part in. It is registered as a WriteHook on the workout store. Ended
+// challenges are left alone, so their results freeze at the end even for
+// workouts logged afterwards.
+func (pg *PostgresChallengeStore) UpdateStandings(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`
+	SELECT `+challengeColumns+`
+	FROM challenges c
+	INNER JOIN challenge_participants p ON p.challenge_id = c.id
+	WHERE p.user_id = $1 AND c.ends_at > CURRENT_TIMESTAMP
+	FOR UPDATE OF p
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	challenges := []Challenge{}
+	for rows.Next() {
+		var c Challenge
+		err = c.scan(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		challenges = append(challenges, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range challenges {
+		value, err := challengeValue(tx, &challenges[i], userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		UPDATE challenge_participants
+		SET value = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE challenge_id = $2 AND user_id = $3
+		`, value, challenges[i].ID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// challengeMetrics are the per-entry amounts each metric sums, a round at
+// a time for entries in circuits.
+var challengeMetrics = map[string]string{
+	ChallengeDistance: `e.distance_meters`,
+	ChallengeReps:     `e.sets * e.reps`,
+	ChallengeVolume:   `e.sets * e.reps * e.weight`,
+}
+
+// ValidChallengeMetric reports whether metric is a known challenge metric.
+func ValidChallengeMetric(metric string) bool {
+	_, ok := challengeMetrics[metric]
+	return ok
+}
+
+// challengeValue is userID's score in the challenge: the metric's total
+// over the challenge, or with a daily target the number of days (in the
+// challenge's timezone) on which they reached it.
+func challengeValue(db queryer, c *Challenge, userID int) (float64, error) {
+	score := `COALESCE(SUM(day_value), 0)`
+	args := []any{userID, c.StartsAt, c.EndsAt, c.Timezone}
+	if c.DailyTarget != nil {
+		args = append(args, *c.DailyTarget)
+		score = `COUNT(*) FILTER (WHERE day_value >= $` + strconv.Itoa(len(args)) + `)`
+	}
+	exercise := ``
+	if c.ExerciseName != nil {
+		args = append(args, *c.ExerciseName)
+		exercise = `AND LOWER(e.exercise_name) = LOWER($` + strconv.Itoa(len(args)) + `)`
+	}
+
+	query := `
+	SELECT ` + score + `
+	FROM (
+		SELECT (w.started_at AT TIME ZONE $4)::date AS day,
+			COALESCE(SUM(` + challengeMetrics[c.Metric] + ` * COALESCE(g.rounds, 1)), 0) AS day_value
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		WHERE w.user_id = $1 AND w.started_at >= $2 AND w.started_at < $3 ` + exercise + `
+		GROUP BY day
+	) days
+	`
+
+	var value float64
+	err := db.QueryRow(query, args...).Scan(&value)
+	return value, err
+}
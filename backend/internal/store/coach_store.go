@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	GrantPending = "pending"
+	GrantActive  = "active"
+
+	// Scopes an athlete can grant a coach.
+	PermissionRead   = "read"
+	PermissionWrite  = "write"
+	PermissionAssign = "assign"
+)
+
+// Permissions are the scopes of a coaching grant. Write covers creating,
+// editing and deleting workouts; Assign covers planning schedules.
+type Permissions struct {
+	Read   bool `json:"read"`
+	Write  bool `json:"write"`
+	Assign bool `json:"assign"`
+}
+
+// Allows reports whether the permissions include scope.
+func (p Permissions) Allows(scope string) bool {
+	switch scope {
+	case PermissionRead:
+		return p.Read
+	case PermissionWrite:
+		return p.Write
+	case PermissionAssign:
+		return p.Assign
+	}
+	return false
+}
+
+// CoachingGrant is an athlete's grant of access to a coach. User is the
+// other party from the point of view of whoever listed it.
+type CoachingGrant struct {
+	AthleteID   int         `json:"athlete_id"`
+	CoachID     int         `json:"coach_id"`
+	User        UserSummary `json:"user"`
+	Permissions Permissions `json:"permissions"`
+	Status      string      `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	AcceptedAt  *time.Time  `json:"accepted_at"`
+}
+
+// AuditEntry records a write made to someone's workout by another user.
+type AuditEntry struct {
+	ID        int         `json:"id"`
+	WorkoutID int         `json:"workout_id"`
+	Actor     UserSummary `json:"actor"`
+	Action    string      `json:"action"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type PostgresCoachStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCoachStore(db *sql.DB) *PostgresCoachStore {
+	return &PostgresCoachStore{
+		db: db,
+	}
+}
+
+type CoachStore interface {
+	CreateGrant(athleteID, coachID int, permissions Permissions) (*CoachingGrant, error)
+	UpdateGrant(athleteID, coachID int, permissions Permissions) error
+	AcceptGrant(athleteID, coachID int) error
+	DeleteGrant(athleteID, coachID int) error
+	GetActiveGrant(athleteID, coachID int) (*CoachingGrant, error)
+	GetCoaches(athleteID int) ([]CoachingGrant, error)
+	GetAthletes(coachID int) ([]CoachingGrant, error)
+	GetAuditLog(ownerID int, limit int) ([]AuditEntry, error)
+}
+
+// CreateGrant invites coachID to coach athleteID. The grant stays pending
+// until the coach accepts it. An existing grant between the two is left
+// alone and reported as sql.ErrNoRows.
+func (pg *PostgresCoachStore) CreateGrant(athleteID, coachID int, permissions Permissions) (*CoachingGrant, error) {
+	grant := &CoachingGrant{
+		AthleteID:   athleteID,
+		CoachID:     coachID,
+		Permissions: permissions,
+		Status:      GrantPending,
+	}
+
+	query := `
+	INSERT INTO coaching_grants (athlete_id, coach_id, can_read, can_write, can_assign)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (athlete_id, coach_id) DO NOTHING
+	RETURNING created_at
+	`
+
+	err := pg.db.QueryRow(query, athleteID, coachID, permissions.Read, permissions.Write, permissions.Assign).Scan(&grant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// UpdateGrant changes the scopes of a grant without asking the coach
+// again; the athlete can widen or narrow what they share at any time.
+func (pg *PostgresCoachStore) UpdateGrant(athleteID, coachID int, permissions Permissions) error {
+	query := `
+	UPDATE coaching_grants
+	SET can_read = $3, can_write = $4, can_assign = $5
+	WHERE athlete_id = $1 AND coach_id = $2
+	`
+
+	return execOne(pg.db, query, athleteID, coachID, permissions.Read, permissions.Write, permissions.Assign)
+}
+
+func (pg *PostgresCoachStore) AcceptGrant(athleteID, coachID int) error {
+	query := `
+	UPDATE coaching_grants
+	SET status = 'active', accepted_at = CURRENT_TIMESTAMP
+	WHERE athlete_id = $1 AND coach_id = $2 AND status = 'pending'
+	`
+
+	return execOne(pg.db, query, athleteID, coachID)
+}
+
+// DeleteGrant ends a coaching relationship or withdraws an invitation;
+// either side may do it.
+func (pg *PostgresCoachStore) DeleteGrant(athleteID, coachID int) error {
+	query := `
+	DELETE FROM coaching_grants
+	WHERE athlete_id = $1 AND coach_id = $2
+	`
+
+	return execOne(pg.db, query, athleteID, coachID)
+}
+
+// GetActiveGrant returns the accepted grant of athleteID to coachID, or
+// nil when there is none.
+func (pg *PostgresCoachStore) GetActiveGrant(athleteID, coachID int) (*CoachingGrant, error) {
+	grants, err := pg.getGrants(`
+	INNER JOIN users u ON u.id = g.coach_id
+	WHERE g.athlete_id = $1 AND g.coach_id = $2 AND g.status = 'active'
+	`, athleteID, coachID)
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	return &grants[0], nil
+}
+
+// GetCoaches returns the grants athleteID has given, with the coach as
+// User.
+func (pg *PostgresCoachStore) GetCoaches(athleteID int) ([]CoachingGrant, error) {
+	return pg.getGrants(`
+	INNER JOIN users u ON u.id = g.coach_id
+	WHERE g.athlete_id = $1
+	`, athleteID)
+}
+
+// GetAthletes returns the grants coachID has received, including pending
+// invitations, with the athlete as User.
+func (pg *PostgresCoachStore) GetAthletes(coachID int) ([]CoachingGrant, error) {
+	return pg.getGrants(`
+	INNER JOIN users u ON u.id = g.athlete_id
+	WHERE g.coach_id = $1
+	`, coachID)
+}
+
+func (pg *PostgresCoachStore) getGrants(clause string, args ...any) ([]CoachingGrant, error) {
+	query := `
+	SELECT g.athlete_id, g.coach_id, g.can_read, g.can_write, g.can_assign, g.status, g.created_at, g.accepted_at,
+		u.id, u.username, u.bio, u.is_private
+	FROM coaching_grants g
+	` + clause + `
+	ORDER BY g.created_at DESC
+	`
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []CoachingGrant{}
+	for rows.Next() {
+		var g CoachingGrant
+		var bio sql.NullString
+		err = rows.Scan(&g.AthleteID, &g.CoachID, &g.Permissions.Read, &g.Permissions.Write, &g.Permissions.Assign,
+			&g.Status, &g.CreatedAt, &g.AcceptedAt, &g.User.ID, &g.User.Username, &bio, &g.User.IsPrivate)
+		if err != nil {
+			return nil, err
+		}
+		g.User.Bio = bio.String
+		grants = append(grants, g)
+	}
+
+	return grants, rows.Err()
+}
+
+// GetAuditLog returns the latest writes others made to ownerID's
+// workouts, newest first.
+func (pg *PostgresCoachStore) GetAuditLog(ownerID int, limit int) ([]AuditEntry, error) {
+	query := `
+	SELECT a.id, a.workout_id, a.action, a.created_at,
+		COALESCE(u.id, 0), COALESCE(u.username, ''), COALESCE(u.bio, ''), COALESCE(u.is_private, FALSE)
+	FROM workout_audit a
+	LEFT JOIN users u ON u.id = a.actor_id
+	WHERE a.owner_id = $1
+	ORDER BY a.created_at DESC, a.id DESC
+	LIMIT $2
+	`
+
+	rows, err := pg.db.Query(query, ownerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		err = rows.Scan(&e.ID, &e.WorkoutID, &e.Action, &e.CreatedAt,
+			&e.Actor.ID, &e.Actor.Username, &e.Actor.Bio, &e.Actor.IsPrivate)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// recordAudit logs a write to a workout when actorID isn't its owner.
+func recordAudit(tx *sql.Tx, workoutID, ownerID int, actorID *int, action string) error {
+	if actorID == nil || *actorID == ownerID {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+	INSERT INTO workout_audit (workout_id, owner_id, actor_id, action)
+	VALUES ($1, $2, $3, $4)
+	`, workoutID, ownerID, *actorID, action)
+	return err
+}
+
+// execOne runs a statement that must change exactly one row, returning
+// sql.ErrNoRows when it changed none.
+func execOne(db execer, query string, args ...any) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
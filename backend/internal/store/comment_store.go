@@ -0,0 +1,298 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Comment is a comment on a workout. Top-level comments carry their
+// replies; replies have a ParentID and no replies of their own.
+type Comment struct {
+	ID        int         `json:"id"`
+	WorkoutID int         `json:"workout_id"`
+	ParentID  *int        `json:"parent_id"`
+	Author    UserSummary `json:"author"`
+	Body      string      `json:"body"`
+	CreatedAt time.Time   `json:"created_at"`
+	Replies   []Comment   `json:"replies,omitempty"`
+}
+
+// Reaction is how many people reacted to a workout with an emoji, and
+// whether the caller is one of them.
+type Reaction struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// Engagement is the comment and reaction counts embedded in workout
+// responses.
+type Engagement struct {
+	CommentCount int            `json:"comment_count"`
+	Reactions    map[string]int `json:"reactions"`
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{
+		db: db,
+	}
+}
+
+type CommentStore interface {
+	CreateComment(*Comment) error
+	GetCommentByID(id int) (*Comment, error)
+	GetCommentsForWorkout(workoutID int) ([]Comment, error)
+	DeleteComment(id int) error
+	AddReaction(workoutID, userID int, emoji string) error
+	RemoveReaction(workoutID, userID int, emoji string) error
+	GetReactions(workoutID, userID int) ([]Reaction, error)
+}
+
+// CreateComment stores a comment written by comment.Author.ID, filling in
+// its ID, creation time and author.
+func (pg *PostgresCommentStore) CreateComment(comment *Comment) error {
+	query := `
+	WITH c AS (
+		INSERT INTO workout_comments (workout_id, user_id, parent_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, created_at
+	)
+	SELECT c.id, c.created_at, u.username, u.bio, u.is_private
+	FROM c
+	INNER JOIN users u ON u.id = c.user_id
+	`
+
+	var bio sql.NullString
+	err := pg.db.QueryRow(query, comment.WorkoutID, comment.Author.ID, comment.ParentID, comment.Body).
+		Scan(&comment.ID, &comment.CreatedAt, &comment.Author.Username, &bio, &comment.Author.IsPrivate)
+	if err != nil {
+		return err
+	}
+	comment.Author.Bio = bio.String
+
+	return nil
+}
+
+const commentColumns = `c.id, c.workout_id, c.parent_id, c.body, c.created_at, u.id, u.username, u.bio, u.is_private`
+
+func scanComment(row interface{ Scan(...any) error }) (Comment, error) {
+	var c Comment
+	var bio sql.NullString
+	err := row.Scan(&c.ID, &c.WorkoutID, &c.ParentID, &c.Body, &c.CreatedAt,
+		&c.Author.ID, &c.Author.Username, &bio, &c.Author.IsPrivate)
+	c.Author.Bio = bio.String
+	return c, err
+}
+
+func (pg *PostgresCommentStore) GetCommentByID(id int) (*Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM workout_comments c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.id = $1
+	`
+
+	comment, err := scanComment(pg.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// GetCommentsForWorkout returns the workout's top-level comments oldest
+// first, each with its replies nested under it.
+func (pg *PostgresCommentStore) GetCommentsForWorkout(workoutID int) ([]Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM workout_comments c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.workout_id = $1
+	ORDER BY c.created_at, c.id
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	index := make(map[int]int)
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		// a parent is always older than its replies, so it is already in
+		// the index
+		if c.ParentID != nil {
+			if i, ok := index[*c.ParentID]; ok {
+				comments[i].Replies = append(comments[i].Replies, c)
+			}
+			continue
+		}
+		index[c.ID] = len(comments)
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// DeleteComment deletes a comment along with its replies.
+func (pg *PostgresCommentStore) DeleteComment(id int) error {
+	query := `
+	DELETE FROM workout_comments
+	WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// AddReaction reacts to a workout. Reacting twice with the same emoji is a
+// no-op.
+func (pg *PostgresCommentStore) AddReaction(workoutID, userID int, emoji string) error {
+	query := `
+	INSERT INTO workout_reactions (workout_id, user_id, emoji)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`
+
+	_, err := pg.db.Exec(query, workoutID, userID, emoji)
+	return err
+}
+
+func (pg *PostgresCommentStore) RemoveReaction(workoutID, userID int, emoji string) error {
+	query := `
+	DELETE FROM workout_reactions
+	WHERE workout_id = $1 AND user_id = $2 AND emoji = $3
+	`
+
+	result, err := pg.db.Exec(query, workoutID, userID, emoji)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetReactions counts the workout's reactions per emoji, most used first,
+// marking the ones userID gave.
+func (pg *PostgresCommentStore) GetReactions(workoutID, userID int) ([]Reaction, error) {
+	query := `
+	SELECT emoji, COUNT(*), BOOL_OR(user_id = $2)
+	FROM workout_reactions
+	WHERE workout_id = $1
+	GROUP BY emoji
+	ORDER BY COUNT(*) DESC, MIN(created_at)
+	`
+
+	rows, err := pg.db.Query(query, workoutID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []Reaction{}
+	for rows.Next() {
+		var r Reaction
+		err = rows.Scan(&r.Emoji, &r.Count, &r.Reacted)
+		if err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+
+	return reactions, rows.Err()
+}
+
+// loadEngagement fills in the comment and reaction counts of workouts with
+// two queries.
+func loadEngagement(db queryer, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(workouts))
+	index := make(map[int]int, len(workouts))
+	for i := range workouts {
+		ids[i] = workouts[i].ID
+		index[workouts[i].ID] = i
+		workouts[i].Engagement = &Engagement{Reactions: map[string]int{}}
+	}
+
+	rows, err := db.Query(`
+	SELECT workout_id, COUNT(*)
+	FROM workout_comments
+	WHERE workout_id = ANY($1)
+	GROUP BY workout_id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID, count int
+		err = rows.Scan(&workoutID, &count)
+		if err != nil {
+			return err
+		}
+		workouts[index[workoutID]].Engagement.CommentCount = count
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(`
+	SELECT workout_id, emoji, COUNT(*)
+	FROM workout_reactions
+	WHERE workout_id = ANY($1)
+	GROUP BY workout_id, emoji
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID, count int
+		var emoji string
+		err = rows.Scan(&workoutID, &emoji, &count)
+		if err != nil {
+			return err
+		}
+		workouts[index[workoutID]].Engagement.Reactions[emoji] = count
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// Export tracks an asynchronous export job. The file itself lives on disk
+// and is looked up by ID.
+type Export struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+type PostgresExportStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExportStore(db *sql.DB) *PostgresExportStore {
+	return &PostgresExportStore{
+		db: db,
+	}
+}
+
+type ExportStore interface {
+	CreateExport(*Export) error
+	GetExportByID(id int) (*Export, error)
+	UpdateExportStatus(id int, status string, errMessage string) error
+	FailUnfinishedExports(errMessage string) (int, error)
+	DeleteExportsFinishedBefore(cutoff time.Time) ([]Export, error)
+}
+
+func (pg *PostgresExportStore) CreateExport(export *Export) error {
+	query := `
+	INSERT INTO exports (user_id, format)
+	VALUES ($1, $2)
+	RETURNING id, status, created_at
+	`
+
+	return pg.db.QueryRow(query, export.UserID, export.Format).Scan(
+		&export.ID,
+		&export.Status,
+		&export.CreatedAt,
+	)
+}
+
+func (pg *PostgresExportStore) GetExportByID(id int) (*Export, error) {
+	export := &Export{}
+	var errMessage sql.NullString
+
+	query := `
+	SELECT id, user_id, format, status, error, created_at, completed_at
+	FROM exports
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Format,
+		&export.Status,
+		&errMessage,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	export.Error = errMessage.String
+	return export, nil
+}
+
+// UpdateExportStatus moves a job to status, stamping completed_at once it
+// reaches a final state.
+func (pg *PostgresExportStore) UpdateExportStatus(id int, status string, errMessage string) error {
+	query := `
+	UPDATE exports
+	SET status = $1,
+		error = NULLIF($2, ''),
+		completed_at = CASE WHEN $1 IN ('completed', 'failed') THEN CURRENT_TIMESTAMP END
+	WHERE id = $3
+	`
+
+	result, err := pg.db.Exec(query, status, errMessage, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FailUnfinishedExports marks every pending or running job failed. Jobs
+// run inside the server process, so at startup any such job was lost with
+// the previous one.
+func (pg *PostgresExportStore) FailUnfinishedExports(errMessage string) (int, error) {
+	query := `
+	UPDATE exports
+	SET status = 'failed', error = $1, completed_at = CURRENT_TIMESTAMP
+	WHERE status IN ('pending', 'running')
+	`
+
+	result, err := pg.db.Exec(query, errMessage)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DeleteExportsFinishedBefore deletes the jobs that completed or failed
+// before cutoff and returns them so their files can be removed.
+func (pg *PostgresExportStore) DeleteExportsFinishedBefore(cutoff time.Time) ([]Export, error) {
+	query := `
+	DELETE FROM exports
+	WHERE completed_at < $1
+	RETURNING id, user_id, format, status, created_at, completed_at
+	`
+
+	rows, err := pg.db.Query(query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []Export
+	for rows.Next() {
+		var export Export
+		err = rows.Scan(&export.ID, &export.UserID, &export.Format, &export.Status, &export.CreatedAt, &export.CompletedAt)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
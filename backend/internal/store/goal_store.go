@@ -0,0 +1,352 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	// GoalWeeklyFrequency and GoalMonthlyVolume are rates, averaged over
+	// the goal's span: 3 workouts a week for 8 weeks needs 24 workouts.
+	GoalWeeklyFrequency = "weekly_frequency"
+	GoalMonthlyVolume   = "monthly_volume"
+	// GoalLift is a weight lifted for at least TargetReps reps.
+	GoalLift = "lift"
+	// GoalBodyWeight is reached by going from StartValue to TargetValue,
+	// in whichever direction that is.
+	GoalBodyWeight = "body_weight"
+	// GoalDistance is cumulative distance in meters.
+	GoalDistance = "distance"
+)
+
+// ErrGoalReached is returned when creating a goal its start value already
+// meets, such as a lift no heavier than the best one logged.
+var ErrGoalReached = errors.New("goal is already reached where it starts")
+
+type Goal struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Kind         string     `json:"kind"`
+	Title        string     `json:"title"`
+	ExerciseName *string    `json:"exercise_name"`
+	TargetValue  float64    `json:"target_value"`
+	TargetReps   *int       `json:"target_reps"`
+	StartValue   float64    `json:"start_value"`
+	CurrentValue float64    `json:"current_value"`
+	StartsAt     time.Time  `json:"starts_at"`
+	Deadline     string     `json:"deadline"`
+	EndsAt       time.Time  `json:"ends_at"`
+	AchievedAt   *time.Time `json:"achieved_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{
+		db: db,
+	}
+}
+
+type GoalStore interface {
+	CreateGoal(*Goal) error
+	GetGoalByID(id int) (*Goal, error)
+	GetGoalsForUser(userID int) ([]Goal, error)
+	DeleteGoal(id int) error
+	RecomputeGoals(tx *sql.Tx, userID int) error
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// CreateGoal inserts the goal with its starting point and current progress
+// filled in. It returns ErrGoalReached, with StartValue set, when the start
+// value already meets the target.
+func (pg *PostgresGoalStore) CreateGoal(goal *Goal) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	goal.StartValue, err = goalStartValue(tx, goal)
+	if err != nil {
+		return err
+	}
+	goal.CurrentValue = goal.StartValue
+	if GoalReached(goal) {
+		return ErrGoalReached
+	}
+
+	query := `
+	INSERT INTO goals (user_id, kind, title, exercise_name, target_value, target_reps, start_value, current_value, starts_at, deadline, ends_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10)
+	RETURNING id, created_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		goal.UserID,
+		goal.Kind,
+		goal.Title,
+		goal.ExerciseName,
+		goal.TargetValue,
+		goal.TargetReps,
+		goal.StartValue,
+		goal.StartsAt,
+		goal.Deadline,
+		goal.EndsAt,
+	).Scan(&goal.ID, &goal.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = pg.RecomputeGoals(tx, goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`SELECT current_value, achieved_at FROM goals WHERE id = $1`, goal.ID).Scan(&goal.CurrentValue, &goal.AchievedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const goalColumns = `id, user_id, kind, title, exercise_name, target_value, target_reps, start_value, current_value,
+	starts_at, deadline, ends_at, achieved_at, created_at`
+
+func (g *Goal) scan(row interface{ Scan(...any) error }) error {
+	var deadline time.Time
+	err := row.Scan(
+		&g.ID,
+		&g.UserID,
+		&g.Kind,
+		&g.Title,
+		&g.ExerciseName,
+		&g.TargetValue,
+		&g.TargetReps,
+		&g.StartValue,
+		&g.CurrentValue,
+		&g.StartsAt,
+		&deadline,
+		&g.EndsAt,
+		&g.AchievedAt,
+		&g.CreatedAt,
+	)
+	g.Deadline = deadline.Format(DateLayout)
+	return err
+}
+
+func (pg *PostgresGoalStore) GetGoalByID(id int) (*Goal, error) {
+	goal := &Goal{}
+
+	query := `
+	SELECT ` + goalColumns + `
+	FROM goals
+	WHERE id = $1
+	`
+
+	err := goal.scan(pg.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return goal, nil
+}
+
+// GetGoalsForUser returns the user's goals, soonest deadline first.
+func (pg *PostgresGoalStore) GetGoalsForUser(userID int) ([]Goal, error) {
+	return pg.getGoals(pg.db, `WHERE user_id = $1 ORDER BY deadline, id`, userID)
+}
+
+func (pg *PostgresGoalStore) getGoals(db queryer, clause string, userID int) ([]Goal, error) {
+	rows, err := db.Query(`SELECT `+goalColumns+` FROM goals `+clause, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []Goal
+	for rows.Next() {
+		var goal Goal
+		err = goal.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, rows.Err()
+}
+
+func (pg *PostgresGoalStore) DeleteGoal(id int) error {
+	query := `
+	DELETE FROM goals
+	WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RecomputeGoals refreshes the progress of the user's unachieved goals. It
+// is registered as a WriteHook on the workout and measurement stores, so
+// progress is updated in the same transaction as the data it counts.
+// Achieved goals stay achieved even if the workout that achieved them is
+// later deleted.
+func (pg *PostgresGoalStore) RecomputeGoals(tx *sql.Tx, userID int) error {
+	goals, err := pg.getGoals(tx, `WHERE user_id = $1 AND achieved_at IS NULL FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range goals {
+		goal := &goals[i]
+		goal.CurrentValue, err = goalCurrentValue(tx, goal)
+		if err != nil {
+			return err
+		}
+
+		var achievedAt *time.Time
+		if GoalReached(goal) {
+			now := time.Now()
+			achievedAt = &now
+		}
+
+		_, err = tx.Exec(`UPDATE goals SET current_value = $1, achieved_at = $2 WHERE id = $3`, goal.CurrentValue, achievedAt, goal.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GoalRequired is the value CurrentValue has to reach. Rate goals scale
+// their per-period target to the goal's span.
+func GoalRequired(goal *Goal) float64 {
+	days := goal.EndsAt.Sub(goal.StartsAt).Hours() / 24
+	switch goal.Kind {
+	case GoalWeeklyFrequency:
+		return goal.TargetValue * days / 7
+	case GoalMonthlyVolume:
+		return goal.TargetValue * days / (365.25 / 12)
+	default:
+		return goal.TargetValue
+	}
+}
+
+// GoalReached reports whether the goal's current value meets its target.
+func GoalReached(goal *Goal) bool {
+	required := GoalRequired(goal)
+	if goal.Kind == GoalBodyWeight && required < goal.StartValue {
+		return goal.CurrentValue > 0 && goal.CurrentValue <= required
+	}
+	return goal.CurrentValue >= required
+}
+
+// goalStartValue is where the goal starts from: the best lift or latest
+// body weight before the goal was set. Cumulative goals start at zero.
+func goalStartValue(db queryer, goal *Goal) (float64, error) {
+	var value float64
+	var err error
+
+	switch goal.Kind {
+	case GoalLift:
+		err = db.QueryRow(`
+		SELECT COALESCE(MAX(e.weight), 0)
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND w.started_at < $2 AND LOWER(e.exercise_name) = LOWER($3) AND e.reps >= $4
+		`, goal.UserID, goal.StartsAt, goal.ExerciseName, goal.TargetReps).Scan(&value)
+	case GoalBodyWeight:
+		err = db.QueryRow(`
+		SELECT value
+		FROM measurements
+		WHERE user_id = $1 AND kind = 'body_weight' AND measured_at <= $2
+		ORDER BY measured_at DESC
+		LIMIT 1
+		`, goal.UserID, goal.StartsAt).Scan(&value)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+	}
+
+	return value, err
+}
+
+// goalCurrentValue measures the goal over its span. Only workouts logged
+// after the goal count, so a lift goal starts over from zero rather than
+// from the best lift it was set against.
+func goalCurrentValue(db queryer, goal *Goal) (float64, error) {
+	var value float64
+	var err error
+
+	switch goal.Kind {
+	case GoalWeeklyFrequency:
+		err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM workouts
+		WHERE user_id = $1 AND started_at >= $2 AND started_at < $3 AND created_at >= $4
+		`, goal.UserID, goal.StartsAt, goal.EndsAt, goal.CreatedAt).Scan(&value)
+	case GoalMonthlyVolume:
+		// matches analytics.WorkoutVolume
+		err = db.QueryRow(`
+		SELECT COALESCE(SUM(e.sets * e.reps * e.weight * COALESCE(g.rounds, 1)), 0)
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		WHERE w.user_id = $1 AND w.started_at >= $2 AND w.started_at < $3 AND w.created_at >= $4
+		`, goal.UserID, goal.StartsAt, goal.EndsAt, goal.CreatedAt).Scan(&value)
+	case GoalLift:
+		err = db.QueryRow(`
+		SELECT COALESCE(MAX(e.weight), 0)
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND w.started_at >= $2 AND w.started_at < $3 AND w.created_at >= $4
+			AND LOWER(e.exercise_name) = LOWER($5) AND e.reps >= $6
+		`, goal.UserID, goal.StartsAt, goal.EndsAt, goal.CreatedAt, goal.ExerciseName, goal.TargetReps).Scan(&value)
+	case GoalBodyWeight:
+		err = db.QueryRow(`
+		SELECT value
+		FROM measurements
+		WHERE user_id = $1 AND kind = 'body_weight' AND measured_at < $2
+		ORDER BY measured_at DESC
+		LIMIT 1
+		`, goal.UserID, goal.EndsAt).Scan(&value)
+		if err == sql.ErrNoRows {
+			return goal.StartValue, nil
+		}
+	case GoalDistance:
+		err = db.QueryRow(`
+		SELECT COALESCE(SUM(distance_meters), 0)
+		FROM workouts
+		WHERE user_id = $1 AND started_at >= $2 AND started_at < $3 AND created_at >= $4
+		`, goal.UserID, goal.StartsAt, goal.EndsAt, goal.CreatedAt).Scan(&value)
+	}
+
+	return value, err
+}
@@ -0,0 +1,44 @@
+package store
+
+import "database/sql"
+
+// WriteHook runs inside the transaction of every write that changes a
+// user's workouts or measurements, after the change itself. Returning an
+// error rolls the write back. Hooks let derived data such as goal progress
+// stay in step with what it is derived from.
+type WriteHook func(tx *sql.Tx, userID int) error
+
+// writeHooks is embedded by stores that accept hooks.
+type writeHooks []WriteHook
+
+// AddWriteHook registers hook to run on every write. It is not safe to
+// call once the store is in use.
+func (h *writeHooks) AddWriteHook(hook WriteHook) {
+	*h = append(*h, hook)
+}
+
+func (h writeHooks) run(tx *sql.Tx, userID int) error {
+	for _, hook := range h {
+		err := hook(tx, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runInTx runs the hooks for userID in a transaction of their own.
+func (h writeHooks) runInTx(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = h.run(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	MeasurementBodyWeight = "body_weight"
+	MeasurementBodyFat    = "body_fat"
+	MeasurementWaist      = "waist"
+	MeasurementChest      = "chest"
+	MeasurementArms       = "arms"
+	MeasurementThighs     = "thighs"
+)
+
+// MeasurementUnits maps each kind to the unit its values are stored in.
+var MeasurementUnits = map[string]string{
+	MeasurementBodyWeight: "kg",
+	MeasurementBodyFat:    "%",
+	MeasurementWaist:      "cm",
+	MeasurementChest:      "cm",
+	MeasurementArms:       "cm",
+	MeasurementThighs:     "cm",
+}
+
+// ValidMeasurementKind reports whether kind is one we track.
+func ValidMeasurementKind(kind string) bool {
+	_, ok := MeasurementUnits[kind]
+	return ok
+}
+
+// Measurement is a timestamped body measurement in the unit given by
+// MeasurementUnits: kilograms, percent body fat or centimetres.
+type Measurement struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Kind       string    `json:"kind"`
+	Value      float64   `json:"value"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Source     string    `json:"source,omitempty"`
+	SourceID   string    `json:"source_id,omitempty"`
+}
+
+type PostgresMeasurementStore struct {
+	db *sql.DB
+	writeHooks
+}
+
+func NewPostgresMeasurementStore(db *sql.DB) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{
+		db: db,
+	}
+}
+
+type MeasurementStore interface {
+	CreateMeasurement(*Measurement) error
+	ImportMeasurements([]*Measurement) (int, error)
+	RunWriteHooks(userID int) error
+	GetMeasurementByID(id int) (*Measurement, error)
+	GetMeasurementsForUser(userID int, kind string, from, to time.Time) ([]Measurement, error)
+	UpdateMeasurement(*Measurement) error
+	DeleteMeasurement(id int) error
+	GetLatestMeasurement(userID int, kind string, asOf time.Time) (*Measurement, error)
+}
+
+const insertMeasurementQuery = `
+INSERT INTO measurements (user_id, kind, value, measured_at, source, source_id)
+VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
+RETURNING id
+`
+
+// CreateMeasurement inserts a measurement. Imported measurements that were
+// already imported return ErrDuplicateSource.
+func (pg *PostgresMeasurementStore) CreateMeasurement(m *Measurement) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(insertMeasurementQuery, m.UserID, m.Kind, m.Value, m.MeasuredAt, m.Source, m.SourceID).Scan(&m.ID)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateSource
+	}
+	if err != nil {
+		return err
+	}
+
+	err = pg.run(tx, m.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ImportMeasurements inserts imported measurements in one transaction
+// without running the write hooks, which the caller runs once with
+// RunWriteHooks when the whole import is in. Measurements that were
+// already imported are skipped and keep a zero ID. It returns how many
+// were created.
+func (pg *PostgresMeasurementStore) ImportMeasurements(ms []*Measurement) (int, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	for _, m := range ms {
+		err = tx.QueryRow(insertMeasurementQuery, m.UserID, m.Kind, m.Value, m.MeasuredAt, m.Source, m.SourceID).Scan(&m.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		created++
+	}
+
+	return created, tx.Commit()
+}
+
+// RunWriteHooks runs the write hooks for userID in a transaction of their
+// own, for writes made through ImportMeasurements.
+func (pg *PostgresMeasurementStore) RunWriteHooks(userID int) error {
+	return pg.runInTx(pg.db, userID)
+}
+
+const measurementColumns = `id, user_id, kind, value, measured_at, COALESCE(source, ''), COALESCE(source_id, '')`
+
+func (m *Measurement) scanDest() []any {
+	return []any{&m.ID, &m.UserID, &m.Kind, &m.Value, &m.MeasuredAt, &m.Source, &m.SourceID}
+}
+
+func (pg *PostgresMeasurementStore) GetMeasurementByID(id int) (*Measurement, error) {
+	m := &Measurement{}
+
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM measurements
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(m.scanDest()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetMeasurementsForUser returns the user's measurements taken in
+// [from, to), oldest first. An empty kind returns every kind.
+func (pg *PostgresMeasurementStore) GetMeasurementsForUser(userID int, kind string, from, to time.Time) ([]Measurement, error) {
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM measurements
+	WHERE user_id = $1 AND ($2 = '' OR kind = $2) AND measured_at >= $3 AND measured_at < $4
+	ORDER BY measured_at, id
+	`
+
+	rows, err := pg.db.Query(query, userID, kind, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var measurements []Measurement
+	for rows.Next() {
+		var m Measurement
+		err = rows.Scan(m.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (pg *PostgresMeasurementStore) UpdateMeasurement(m *Measurement) error {
+	query := `
+	UPDATE measurements
+	SET kind = $1, value = $2, measured_at = $3
+	WHERE id = $4
+	RETURNING user_id
+	`
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(query, m.Kind, m.Value, m.MeasuredAt, m.ID).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	err = pg.run(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresMeasurementStore) DeleteMeasurement(id int) error {
+	query := `
+	DELETE FROM measurements
+	WHERE id = $1
+	RETURNING user_id
+	`
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(query, id).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	err = pg.run(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLatestMeasurement returns the user's most recent measurement of kind
+// taken at or before asOf, or nil when there is none. Pass time.Now() for
+// the current value; a workout's start time gives the value at the time.
+func (pg *PostgresMeasurementStore) GetLatestMeasurement(userID int, kind string, asOf time.Time) (*Measurement, error) {
+	m := &Measurement{}
+
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM measurements
+	WHERE user_id = $1 AND kind = $2 AND measured_at <= $3
+	ORDER BY measured_at DESC, id DESC
+	LIMIT 1
+	`
+
+	err := pg.db.QueryRow(query, userID, kind, asOf).Scan(m.scanDest()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,331 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Thread is a conversation between two users, optionally about a workout
+// or one of its entries.
+type Thread struct {
+	ID            int          `json:"id"`
+	UserIDs       [2]int       `json:"user_ids"`
+	WorkoutID     *int         `json:"workout_id"`
+	EntryID       *int         `json:"entry_id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	LastMessageAt *time.Time   `json:"last_message_at"`
+	Reads         []ThreadRead `json:"reads"`
+}
+
+// ThreadRead is a read receipt: the last message UserID has read.
+type ThreadRead struct {
+	UserID            int       `json:"user_id"`
+	LastReadMessageID int       `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// HasParticipant reports whether userID is one of the thread's two users.
+func (t *Thread) HasParticipant(userID int) bool {
+	return t.UserIDs[0] == userID || t.UserIDs[1] == userID
+}
+
+// Other returns the participant who isn't userID.
+func (t *Thread) Other(userID int) int {
+	if t.UserIDs[0] == userID {
+		return t.UserIDs[1]
+	}
+	return t.UserIDs[0]
+}
+
+type Message struct {
+	ID        int       `json:"id"`
+	ThreadID  int       `json:"thread_id"`
+	SenderID  int       `json:"sender_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ThreadSummary is a thread as listed in someone's inbox.
+type ThreadSummary struct {
+	Thread
+	With        UserSummary `json:"with"`
+	LastMessage *Message    `json:"last_message"`
+	UnreadCount int         `json:"unread_count"`
+}
+
+type PostgresMessageStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMessageStore(db *sql.DB) *PostgresMessageStore {
+	return &PostgresMessageStore{
+		db: db,
+	}
+}
+
+type MessageStore interface {
+	FindOrCreateThread(*Thread) error
+	GetThreadByID(id int) (*Thread, error)
+	GetThreadsForUser(userID int) ([]ThreadSummary, error)
+	CreateMessage(*Message) error
+	GetMessages(threadID, beforeID, limit int) ([]Message, error)
+	MarkRead(threadID, userID, messageID int) error
+	CountUnread(userID int) (int, error)
+}
+
+// FindOrCreateThread fills in the existing thread between the two users
+// with the same anchor, creating it when there is none. It is a single
+// upsert, so concurrent first messages end up in the same thread.
+func (pg *PostgresMessageStore) FindOrCreateThread(thread *Thread) error {
+	low, high := thread.UserIDs[0], thread.UserIDs[1]
+	if low > high {
+		low, high = high, low
+	}
+	thread.UserIDs = [2]int{low, high}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the no-op update makes RETURNING yield the existing thread too
+	err = tx.QueryRow(`
+	INSERT INTO message_threads (user_low_id, user_high_id, workout_id, entry_id)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_low_id, user_high_id, COALESCE(workout_id, 0), COALESCE(entry_id, 0))
+	DO UPDATE SET user_low_id = EXCLUDED.user_low_id
+	RETURNING id, created_at, last_message_at
+	`, low, high, thread.WorkoutID, thread.EntryID).Scan(&thread.ID, &thread.CreatedAt, &thread.LastMessageAt)
+	if err != nil {
+		return err
+	}
+
+	thread.Reads, err = getReads(tx, thread.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresMessageStore) GetThreadByID(id int) (*Thread, error) {
+	thread := &Thread{}
+
+	query := `
+	SELECT id, user_low_id, user_high_id, workout_id, entry_id, created_at, last_message_at
+	FROM message_threads
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(&thread.ID, &thread.UserIDs[0], &thread.UserIDs[1],
+		&thread.WorkoutID, &thread.EntryID, &thread.CreatedAt, &thread.LastMessageAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thread.Reads, err = getReads(pg.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return thread, nil
+}
+
+func getReads(db queryer, threadID int) ([]ThreadRead, error) {
+	rows, err := db.Query(`
+	SELECT user_id, last_read_message_id, read_at
+	FROM message_reads
+	WHERE thread_id = $1
+	ORDER BY user_id
+	`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reads := []ThreadRead{}
+	for rows.Next() {
+		var r ThreadRead
+		err = rows.Scan(&r.UserID, &r.LastReadMessageID, &r.ReadAt)
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, r)
+	}
+
+	return reads, rows.Err()
+}
+
+// GetThreadsForUser lists userID's threads, most recently active first,
+// each with its latest message and how many messages userID hasn't read.
+func (pg *PostgresMessageStore) GetThreadsForUser(userID int) ([]ThreadSummary, error) {
+	query := `
+	SELECT t.id, t.user_low_id, t.user_high_id, t.workout_id, t.entry_id, t.created_at, t.last_message_at,
+		u.id, u.username, u.bio, u.is_private,
+		m.id, m.sender_id, m.body, m.created_at,
+		(
+			SELECT COUNT(*) FROM messages um
+			WHERE um.thread_id = t.id AND um.sender_id <> $1
+				AND um.id > COALESCE((SELECT last_read_message_id FROM message_reads WHERE thread_id = t.id AND user_id = $1), 0)
+		)
+	FROM message_threads t
+	INNER JOIN users u ON u.id = CASE WHEN t.user_low_id = $1 THEN t.user_high_id ELSE t.user_low_id END
+	LEFT JOIN LATERAL (
+		SELECT id, sender_id, body, created_at FROM messages
+		WHERE thread_id = t.id
+		ORDER BY id DESC
+		LIMIT 1
+	) m ON TRUE
+	WHERE t.user_low_id = $1 OR t.user_high_id = $1
+	ORDER BY COALESCE(t.last_message_at, t.created_at) DESC, t.id DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []ThreadSummary{}
+	for rows.Next() {
+		var t ThreadSummary
+		var bio sql.NullString
+		var messageID, senderID sql.NullInt64
+		var body sql.NullString
+		var sentAt sql.NullTime
+		err = rows.Scan(&t.ID, &t.UserIDs[0], &t.UserIDs[1], &t.WorkoutID, &t.EntryID, &t.CreatedAt, &t.LastMessageAt,
+			&t.With.ID, &t.With.Username, &bio, &t.With.IsPrivate,
+			&messageID, &senderID, &body, &sentAt,
+			&t.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		t.With.Bio = bio.String
+		if messageID.Valid {
+			t.LastMessage = &Message{
+				ID:        int(messageID.Int64),
+				ThreadID:  t.ID,
+				SenderID:  int(senderID.Int64),
+				Body:      body.String,
+				CreatedAt: sentAt.Time,
+			}
+		}
+		threads = append(threads, t)
+	}
+
+	return threads, rows.Err()
+}
+
+// CreateMessage posts a message and marks the thread read up to it for
+// the sender.
+func (pg *PostgresMessageStore) CreateMessage(message *Message) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+	INSERT INTO messages (thread_id, sender_id, body)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`, message.ThreadID, message.SenderID, message.Body).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE message_threads SET last_message_at = $1 WHERE id = $2`, message.CreatedAt, message.ThreadID)
+	if err != nil {
+		return err
+	}
+
+	err = markRead(tx, message.ThreadID, message.SenderID, message.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMessages returns up to limit messages of the thread older than
+// beforeID (from the newest when 0), newest first.
+func (pg *PostgresMessageStore) GetMessages(threadID, beforeID, limit int) ([]Message, error) {
+	query := `
+	SELECT id, thread_id, sender_id, body, created_at
+	FROM messages
+	WHERE thread_id = $1 AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC
+	LIMIT $3
+	`
+
+	rows, err := pg.db.Query(query, threadID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		err = rows.Scan(&m.ID, &m.ThreadID, &m.SenderID, &m.Body, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkRead records that userID has read the thread up to messageID, or
+// up to its latest message when messageID is 0 or past it. Read receipts
+// never move backwards.
+func (pg *PostgresMessageStore) MarkRead(threadID, userID, messageID int) error {
+	var latestID int
+	err := pg.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE thread_id = $1`, threadID).Scan(&latestID)
+	if err != nil || latestID == 0 {
+		return err
+	}
+	if messageID == 0 || messageID > latestID {
+		messageID = latestID
+	}
+
+	return markRead(pg.db, threadID, userID, messageID)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func markRead(db execer, threadID, userID, messageID int) error {
+	_, err := db.Exec(`
+	INSERT INTO message_reads (thread_id, user_id, last_read_message_id)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (thread_id, user_id) DO UPDATE
+	SET last_read_message_id = GREATEST(message_reads.last_read_message_id, EXCLUDED.last_read_message_id),
+		read_at = CASE WHEN EXCLUDED.last_read_message_id > message_reads.last_read_message_id
+			THEN CURRENT_TIMESTAMP ELSE message_reads.read_at END
+	`, threadID, userID, messageID)
+	return err
+}
+
+// CountUnread counts the messages sent to userID that they haven't read,
+// across all threads.
+func (pg *PostgresMessageStore) CountUnread(userID int) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM message_threads t
+	INNER JOIN messages m ON m.thread_id = t.id
+	LEFT JOIN message_reads r ON r.thread_id = t.id AND r.user_id = $1
+	WHERE (t.user_low_id = $1 OR t.user_high_id = $1)
+		AND m.sender_id <> $1 AND m.id > COALESCE(r.last_read_message_id, 0)
+	`
+
+	var count int
+	err := pg.db.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
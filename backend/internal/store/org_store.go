@@ -0,0 +1,337 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleCoach  = "coach"
+	OrgRoleMember = "member"
+
+	LeaderboardVolume   = "volume"
+	LeaderboardWorkouts = "workouts"
+	LeaderboardLift     = "lift"
+)
+
+// Organization is a gym or team.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Location is the organization's timezone, falling back to UTC when it
+// can't be loaded.
+func (o *Organization) Location() *time.Location {
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Membership is one user's place in an organization.
+type Membership struct {
+	OrgID         int       `json:"org_id"`
+	UserID        int       `json:"user_id"`
+	Role          string    `json:"role"`
+	OnLeaderboard bool      `json:"on_leaderboard"`
+	JoinedAt      time.Time `json:"joined_at"`
+}
+
+// CanManage reports whether the member may add and remove members.
+func (m *Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleCoach
+}
+
+// OrgMember is a membership as listed to other members.
+type OrgMember struct {
+	User UserSummary `json:"user"`
+	Membership
+}
+
+// UserOrganization is an organization with the listing user's role in it.
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// LeaderboardRow is a member's score on a leaderboard.
+type LeaderboardRow struct {
+	User  UserSummary `json:"user"`
+	Value float64     `json:"value"`
+}
+
+type PostgresOrgStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOrgStore(db *sql.DB) *PostgresOrgStore {
+	return &PostgresOrgStore{
+		db: db,
+	}
+}
+
+type OrgStore interface {
+	CreateOrg(org *Organization, ownerID int) error
+	GetOrgByID(id int) (*Organization, error)
+	GetOrgsForUser(userID int) ([]UserOrganization, error)
+	GetMembership(orgID, userID int) (*Membership, error)
+	GetMembers(orgID int) ([]OrgMember, error)
+	AddMember(orgID, userID int, role string) error
+	UpdateMemberRole(orgID, userID int, role string) error
+	RemoveMember(orgID, userID int) error
+	SetOnLeaderboard(orgID, userID int, on bool) error
+	CountOwners(orgID int) (int, error)
+	GetLeaderboard(orgID int, metric, exerciseName string, from, to time.Time) ([]LeaderboardRow, error)
+}
+
+// CreateOrg creates an organization with ownerID as its first owner.
+func (pg *PostgresOrgStore) CreateOrg(org *Organization, ownerID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+	INSERT INTO organizations (name, timezone)
+	VALUES ($1, $2)
+	RETURNING id, created_at
+	`, org.Name, org.Timezone).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO org_members (org_id, user_id, role)
+	VALUES ($1, $2, 'owner')
+	`, org.ID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresOrgStore) GetOrgByID(id int) (*Organization, error) {
+	org := &Organization{}
+
+	query := `
+	SELECT id, name, timezone, created_at
+	FROM organizations
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(&org.ID, &org.Name, &org.Timezone, &org.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (pg *PostgresOrgStore) GetOrgsForUser(userID int) ([]UserOrganization, error) {
+	query := `
+	SELECT o.id, o.name, o.timezone, o.created_at, m.role
+	FROM org_members m
+	INNER JOIN organizations o ON o.id = m.org_id
+	WHERE m.user_id = $1
+	ORDER BY o.name, o.id
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []UserOrganization{}
+	for rows.Next() {
+		var o UserOrganization
+		err = rows.Scan(&o.ID, &o.Name, &o.Timezone, &o.CreatedAt, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+
+	return orgs, rows.Err()
+}
+
+// GetMembership returns userID's membership of orgID, or nil when they
+// aren't a member.
+func (pg *PostgresOrgStore) GetMembership(orgID, userID int) (*Membership, error) {
+	m := &Membership{}
+
+	query := `
+	SELECT org_id, user_id, role, on_leaderboard, joined_at
+	FROM org_members
+	WHERE org_id = $1 AND user_id = $2
+	`
+
+	err := pg.db.QueryRow(query, orgID, userID).Scan(&m.OrgID, &m.UserID, &m.Role, &m.OnLeaderboard, &m.JoinedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (pg *PostgresOrgStore) GetMembers(orgID int) ([]OrgMember, error) {
+	query := `
+	SELECT u.id, u.username, u.bio, u.is_private, m.org_id, m.user_id, m.role, m.on_leaderboard, m.joined_at
+	FROM org_members m
+	INNER JOIN users u ON u.id = m.user_id
+	WHERE m.org_id = $1
+	ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'coach' THEN 1 ELSE 2 END, u.username
+	`
+
+	rows, err := pg.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrgMember{}
+	for rows.Next() {
+		var m OrgMember
+		var bio sql.NullString
+		err = rows.Scan(&m.User.ID, &m.User.Username, &bio, &m.User.IsPrivate,
+			&m.OrgID, &m.UserID, &m.Role, &m.OnLeaderboard, &m.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		m.User.Bio = bio.String
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember adds userID to the organization. Adding an existing member is
+// reported as sql.ErrNoRows and leaves their role alone.
+func (pg *PostgresOrgStore) AddMember(orgID, userID int, role string) error {
+	query := `
+	INSERT INTO org_members (org_id, user_id, role)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+
+	return execOne(pg.db, query, orgID, userID, role)
+}
+
+func (pg *PostgresOrgStore) UpdateMemberRole(orgID, userID int, role string) error {
+	query := `
+	UPDATE org_members
+	SET role = $3
+	WHERE org_id = $1 AND user_id = $2
+	`
+
+	return execOne(pg.db, query, orgID, userID, role)
+}
+
+func (pg *PostgresOrgStore) RemoveMember(orgID, userID int) error {
+	query := `
+	DELETE FROM org_members
+	WHERE org_id = $1 AND user_id = $2
+	`
+
+	return execOne(pg.db, query, orgID, userID)
+}
+
+// SetOnLeaderboard opts a member in to or out of the organization's
+// leaderboards.
+func (pg *PostgresOrgStore) SetOnLeaderboard(orgID, userID int, on bool) error {
+	query := `
+	UPDATE org_members
+	SET on_leaderboard = $3
+	WHERE org_id = $1 AND user_id = $2
+	`
+
+	return execOne(pg.db, query, orgID, userID, on)
+}
+
+func (pg *PostgresOrgStore) CountOwners(orgID int) (int, error) {
+	var count int
+	err := pg.db.QueryRow(`SELECT COUNT(*) FROM org_members WHERE org_id = $1 AND role = 'owner'`, orgID).Scan(&count)
+	return count, err
+}
+
+// leaderboardMetrics computes a member's score from their workouts in
+// [$2, $3); $4 is the exercise name for lifts. Volume matches
+// analytics.WorkoutVolume. Only lifts can be missing, for members who
+// never did the exercise.
+var leaderboardMetrics = map[string]string{
+	LeaderboardVolume: `
+		SELECT COALESCE(SUM(e.sets * e.reps * e.weight * COALESCE(g.rounds, 1)), 0)
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		WHERE w.user_id = m.user_id AND w.started_at >= $2 AND w.started_at < $3`,
+	LeaderboardWorkouts: `
+		SELECT COUNT(*)
+		FROM workouts w
+		WHERE w.user_id = m.user_id AND w.started_at >= $2 AND w.started_at < $3`,
+	LeaderboardLift: `
+		SELECT MAX(e.weight)
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = m.user_id AND w.started_at >= $2 AND w.started_at < $3
+			AND LOWER(e.exercise_name) = LOWER($4) AND e.reps > 0`,
+}
+
+// ValidLeaderboardMetric reports whether metric is a known leaderboard.
+func ValidLeaderboardMetric(metric string) bool {
+	_, ok := leaderboardMetrics[metric]
+	return ok
+}
+
+// GetLeaderboard scores the organization's opted-in members on metric
+// over [from, to), best first. Members who never did the lift are left
+// out of lift leaderboards.
+func (pg *PostgresOrgStore) GetLeaderboard(orgID int, metric, exerciseName string, from, to time.Time) ([]LeaderboardRow, error) {
+	query := `
+	SELECT u.id, u.username, u.bio, u.is_private, score.value
+	FROM org_members m
+	INNER JOIN users u ON u.id = m.user_id
+	CROSS JOIN LATERAL (` + leaderboardMetrics[metric] + `
+	) AS score(value)
+	WHERE m.org_id = $1 AND m.on_leaderboard AND score.value IS NOT NULL
+	ORDER BY score.value DESC, u.username
+	`
+
+	args := []any{orgID, from, to}
+	if metric == LeaderboardLift {
+		args = append(args, exerciseName)
+	}
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	board := []LeaderboardRow{}
+	for rows.Next() {
+		var row LeaderboardRow
+		var bio sql.NullString
+		err = rows.Scan(&row.User.ID, &row.User.Username, &bio, &row.User.IsPrivate, &row.Value)
+		if err != nil {
+			return nil, err
+		}
+		row.User.Bio = bio.String
+		board = append(board, row)
+	}
+
+	return board, rows.Err()
+}
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	ExceptionSkipped     = "skipped"
+	ExceptionRescheduled = "rescheduled"
+
+	// LocalDateTimeLayout is how schedule start times are exchanged: a wall
+	// clock time without zone, interpreted in the user's timezone.
+	LocalDateTimeLayout = "2006-01-02T15:04"
+	DateLayout          = "2006-01-02"
+)
+
+// Schedule is a recurring planned workout. StartsAt holds the wall-clock
+// time of the first occurrence; its location is meaningless until the
+// schedule is expanded in the owner's timezone.
+type Schedule struct {
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	TemplateWorkoutID *int      `json:"template_workout_id"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description"`
+	StartsAt          time.Time `json:"-"`
+	DurationMinutes   int       `json:"duration_minutes"`
+	RRule             string    `json:"rrule"`
+	// CreatedBy is the coach who assigned the schedule, if it wasn't the
+	// owner.
+	CreatedBy  *int                `json:"created_by"`
+	Exceptions []ScheduleException `json:"exceptions"`
+}
+
+// ScheduleException skips or moves the occurrence originally falling on
+// OccurrenceDate, a local date in DateLayout.
+type ScheduleException struct {
+	ScheduleID     int        `json:"schedule_id"`
+	OccurrenceDate string     `json:"date"`
+	Status         string     `json:"status"`
+	RescheduledTo  *time.Time `json:"rescheduled_to"`
+}
+
+type PostgresScheduleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduleStore(db *sql.DB) *PostgresScheduleStore {
+	return &PostgresScheduleStore{
+		db: db,
+	}
+}
+
+type ScheduleStore interface {
+	CreateSchedule(*Schedule) error
+	GetScheduleByID(id int) (*Schedule, error)
+	GetSchedulesForUser(userID int) ([]Schedule, error)
+	DeleteSchedule(id int) error
+	SetScheduleException(*ScheduleException) error
+	DeleteScheduleException(scheduleID int, occurrenceDate string) error
+	GetLoggedWorkoutsBetween(userID int, from, to time.Time) ([]Workout, error)
+}
+
+func (pg *PostgresScheduleStore) CreateSchedule(schedule *Schedule) error {
+	query := `
+	INSERT INTO workout_schedules (user_id, template_workout_id, title, description, starts_at, duration_minutes, rrule, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`
+
+	return pg.db.QueryRow(
+		query,
+		schedule.UserID,
+		schedule.TemplateWorkoutID,
+		schedule.Title,
+		schedule.Description,
+		wallClock(schedule.StartsAt),
+		schedule.DurationMinutes,
+		schedule.RRule,
+		schedule.CreatedBy,
+	).Scan(&schedule.ID)
+}
+
+func (pg *PostgresScheduleStore) GetScheduleByID(id int) (*Schedule, error) {
+	schedule := &Schedule{}
+	var description sql.NullString
+
+	query := `
+	SELECT id, user_id, template_workout_id, title, description, starts_at, duration_minutes, rrule, created_by
+	FROM workout_schedules
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(
+		&schedule.ID,
+		&schedule.UserID,
+		&schedule.TemplateWorkoutID,
+		&schedule.Title,
+		&description,
+		&schedule.StartsAt,
+		&schedule.DurationMinutes,
+		&schedule.RRule,
+		&schedule.CreatedBy,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	schedule.Description = description.String
+
+	exceptions, err := pg.getExceptions(`WHERE schedule_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Exceptions = exceptions[id]
+
+	return schedule, nil
+}
+
+// GetSchedulesForUser returns every schedule of the user with its
+// exceptions.
+func (pg *PostgresScheduleStore) GetSchedulesForUser(userID int) ([]Schedule, error) {
+	query := `
+	SELECT id, user_id, template_workout_id, title, description, starts_at, duration_minutes, rrule, created_by
+	FROM workout_schedules
+	WHERE user_id = $1
+	ORDER BY id
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var schedule Schedule
+		var description sql.NullString
+		err = rows.Scan(
+			&schedule.ID,
+			&schedule.UserID,
+			&schedule.TemplateWorkoutID,
+			&schedule.Title,
+			&description,
+			&schedule.StartsAt,
+			&schedule.DurationMinutes,
+			&schedule.RRule,
+			&schedule.CreatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Description = description.String
+		schedules = append(schedules, schedule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	exceptions, err := pg.getExceptions(`
+	INNER JOIN workout_schedules s ON s.id = schedule_id
+	WHERE s.user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		schedules[i].Exceptions = exceptions[schedules[i].ID]
+	}
+
+	return schedules, nil
+}
+
+// getExceptions loads exceptions matching the given join/where clause,
+// keyed by schedule ID.
+func (pg *PostgresScheduleStore) getExceptions(clause string, arg int) (map[int][]ScheduleException, error) {
+	query := `
+	SELECT schedule_id, occurrence_date, status, rescheduled_to
+	FROM schedule_exceptions
+	` + clause + `
+	ORDER BY schedule_id, occurrence_date
+	`
+
+	rows, err := pg.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := make(map[int][]ScheduleException)
+	for rows.Next() {
+		var exception ScheduleException
+		var date time.Time
+		err = rows.Scan(
+			&exception.ScheduleID,
+			&date,
+			&exception.Status,
+			&exception.RescheduledTo,
+		)
+		if err != nil {
+			return nil, err
+		}
+		exception.OccurrenceDate = date.Format(DateLayout)
+		exceptions[exception.ScheduleID] = append(exceptions[exception.ScheduleID], exception)
+	}
+
+	return exceptions, rows.Err()
+}
+
+func (pg *PostgresScheduleStore) DeleteSchedule(id int) error {
+	query := `
+	DELETE FROM workout_schedules
+	WHERE id = $1
+	`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// SetScheduleException records a skip or reschedule, replacing any earlier
+// exception for the same occurrence.
+func (pg *PostgresScheduleStore) SetScheduleException(exception *ScheduleException) error {
+	query := `
+	INSERT INTO schedule_exceptions (schedule_id, occurrence_date, status, rescheduled_to)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (schedule_id, occurrence_date)
+	DO UPDATE SET status = EXCLUDED.status, rescheduled_to = EXCLUDED.rescheduled_to
+	`
+
+	_, err := pg.db.Exec(
+		query,
+		exception.ScheduleID,
+		exception.OccurrenceDate,
+		exception.Status,
+		exception.RescheduledTo,
+	)
+	return err
+}
+
+// DeleteScheduleException restores an occurrence to its planned time.
+func (pg *PostgresScheduleStore) DeleteScheduleException(scheduleID int, occurrenceDate string) error {
+	query := `
+	DELETE FROM schedule_exceptions
+	WHERE schedule_id = $1 AND occurrence_date = $2
+	`
+
+	result, err := pg.db.Exec(query, scheduleID, occurrenceDate)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetLoggedWorkoutsBetween returns the user's workouts started in
+// [from, to) without entries, for matching against planned occurrences.
+func (pg *PostgresScheduleStore) GetLoggedWorkoutsBetween(userID int, from, to time.Time) ([]Workout, error) {
+	query := `
+	SELECT id, user_id, title, started_at, duration_minutes
+	FROM workouts
+	WHERE user_id = $1 AND started_at >= $2 AND started_at < $3
+	ORDER BY started_at, id
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workouts []Workout
+	for rows.Next() {
+		var w Workout
+		err = rows.Scan(&w.ID, &w.UserID, &w.Title, &w.StartedAt, &w.DurationMinutes)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, w)
+	}
+
+	return workouts, rows.Err()
+}
+
+// wallClock strips the zone from t so it is stored as the local time it
+// reads as, not converted to the session's timezone.
+func wallClock(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
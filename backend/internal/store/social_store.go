@@ -0,0 +1,332 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	FollowPending  = "pending"
+	FollowAccepted = "accepted"
+)
+
+// UserSummary is the public face of a user shown to other users.
+type UserSummary struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	Bio       string `json:"bio"`
+	IsPrivate bool   `json:"is_private"`
+}
+
+// Follow is one side of a follow relationship: the other user and its
+// status.
+type Follow struct {
+	User      UserSummary `json:"user"`
+	Status    string      `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// FeedCursor marks the last workout of a feed page; the next page starts
+// strictly after it in (started_at, id) descending order.
+type FeedCursor struct {
+	StartedAt time.Time
+	ID        int
+}
+
+// FeedWorkout is a workout in someone's feed with its author.
+type FeedWorkout struct {
+	Workout
+	Author UserSummary `json:"author"`
+}
+
+type PostgresSocialStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSocialStore(db *sql.DB) *PostgresSocialStore {
+	return &PostgresSocialStore{
+		db: db,
+	}
+}
+
+type SocialStore interface {
+	GetUserSummary(userID int) (*UserSummary, error)
+	Follow(followerID, followeeID int) (string, error)
+	Unfollow(followerID, followeeID int) error
+	AcceptFollow(followerID, followeeID int) error
+	IsFollowing(followerID, followeeID int) (bool, error)
+	GetFollowers(userID int, status string) ([]Follow, error)
+	GetFollowing(userID int) ([]Follow, error)
+	SetPrivate(userID int, private bool) error
+	GetFeed(userID int, after *FeedCursor, limit int) ([]FeedWorkout, error)
+}
+
+func (pg *PostgresSocialStore) GetUserSummary(userID int) (*UserSummary, error) {
+	user := &UserSummary{}
+
+	query := `
+	SELECT id, username, bio, is_private
+	FROM users
+	WHERE id = $1
+	`
+
+	var bio sql.NullString
+	err := pg.db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &bio, &user.IsPrivate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Bio = bio.String
+
+	return user, nil
+}
+
+// Follow makes followerID follow followeeID, pending approval when the
+// followee is private. Following again is a no-op that returns the
+// existing status.
+func (pg *PostgresSocialStore) Follow(followerID, followeeID int) (string, error) {
+	query := `
+	INSERT INTO follows (follower_id, followee_id, status, accepted_at)
+	SELECT $1, u.id,
+		CASE WHEN u.is_private THEN 'pending' ELSE 'accepted' END,
+		CASE WHEN u.is_private THEN NULL ELSE CURRENT_TIMESTAMP END
+	FROM users u
+	WHERE u.id = $2
+	ON CONFLICT (follower_id, followee_id) DO UPDATE SET status = follows.status
+	RETURNING status
+	`
+
+	var status string
+	err := pg.db.QueryRow(query, followerID, followeeID).Scan(&status)
+	return status, err
+}
+
+// Unfollow removes a follow or a pending request.
+func (pg *PostgresSocialStore) Unfollow(followerID, followeeID int) error {
+	query := `
+	DELETE FROM follows
+	WHERE follower_id = $1 AND followee_id = $2
+	`
+
+	result, err := pg.db.Exec(query, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// AcceptFollow approves a pending request to follow followeeID.
+func (pg *PostgresSocialStore) AcceptFollow(followerID, followeeID int) error {
+	query := `
+	UPDATE follows
+	SET status = 'accepted', accepted_at = CURRENT_TIMESTAMP
+	WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending'
+	`
+
+	result, err := pg.db.Exec(query, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// IsFollowing reports whether followerID has an accepted follow of
+// followeeID.
+func (pg *PostgresSocialStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM follows
+		WHERE follower_id = $1 AND followee_id = $2 AND status = 'accepted'
+	)
+	`
+
+	var following bool
+	err := pg.db.QueryRow(query, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+// GetFollowers returns the users following userID with the given status,
+// newest first.
+func (pg *PostgresSocialStore) GetFollowers(userID int, status string) ([]Follow, error) {
+	return pg.getFollows(`
+	INNER JOIN users u ON u.id = f.follower_id
+	WHERE f.followee_id = $1 AND f.status = $2
+	`, userID, status)
+}
+
+// GetFollowing returns the users userID follows or has asked to follow.
+func (pg *PostgresSocialStore) GetFollowing(userID int) ([]Follow, error) {
+	return pg.getFollows(`
+	INNER JOIN users u ON u.id = f.followee_id
+	WHERE f.follower_id = $1 AND ($2 = '' OR f.status = $2)
+	`, userID, "")
+}
+
+func (pg *PostgresSocialStore) getFollows(clause string, userID int, status string) ([]Follow, error) {
+	query := `
+	SELECT u.id, u.username, u.bio, u.is_private, f.status, f.created_at
+	FROM follows f
+	` + clause + `
+	ORDER BY f.created_at DESC
+	`
+
+	rows, err := pg.db.Query(query, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []Follow{}
+	for rows.Next() {
+		var f Follow
+		var bio sql.NullString
+		err = rows.Scan(&f.User.ID, &f.User.Username, &bio, &f.User.IsPrivate, &f.Status, &f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		f.User.Bio = bio.String
+		follows = append(follows, f)
+	}
+
+	return follows, rows.Err()
+}
+
+// SetPrivate changes the account's privacy. Going public accepts every
+// pending follow request, since approval is no longer needed.
+func (pg *PostgresSocialStore) SetPrivate(userID int, private bool) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET is_private = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, private, userID)
+	if err != nil {
+		return err
+	}
+
+	if !private {
+		_, err = tx.Exec(`
+		UPDATE follows
+		SET status = 'accepted', accepted_at = CURRENT_TIMESTAMP
+		WHERE followee_id = $1 AND status = 'pending'
+		`, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetFeed returns up to limit non-private workouts of the users userID
+// follows, newest first, starting after the cursor, or from the top when
+// it is nil. Paging on (started_at, id) instead of an offset keeps pages
+// stable as new workouts arrive. Each followee contributes at most limit
+// rows read straight off workouts_user_started_idx, so a page costs
+// followees × limit rows however long their histories are.
+func (pg *PostgresSocialStore) GetFeed(userID int, after *FeedCursor, limit int) ([]FeedWorkout, error) {
+	cursor := FeedCursor{StartedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if after != nil {
+		cursor = *after
+	}
+
+	query := `
+	SELECT w.id, w.user_id, w.title, w.description, w.started_at, w.duration_minutes, w.calories_burned,
+		w.distance_meters, w.avg_heart_rate, w.max_heart_rate, w.visibility, w.activity_type, ` + wodColumnList + `,
+		u.username, u.bio, u.is_private
+	FROM follows f
+	INNER JOIN users u ON u.id = f.followee_id
+	CROSS JOIN LATERAL (
+		SELECT id, user_id, title, description, started_at, duration_minutes, calories_burned,
+			distance_meters, avg_heart_rate, max_heart_rate, visibility, activity_type, ` + wodColumnList + `
+		FROM workouts
+		WHERE user_id = f.followee_id AND visibility <> 'private' AND (started_at, id) < ($2, $3)
+		ORDER BY started_at DESC, id DESC
+		LIMIT $4
+	) w
+	WHERE f.follower_id = $1 AND f.status = 'accepted'
+	ORDER BY w.started_at DESC, w.id DESC
+	LIMIT $4
+	`
+
+	rows, err := pg.db.Query(query, userID, cursor.StartedAt, cursor.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workouts []Workout
+	var authors []UserSummary
+	for rows.Next() {
+		var w Workout
+		var author UserSummary
+		var bio sql.NullString
+		var wodCols wodColumns
+		dest := []any{
+			&w.ID,
+			&w.UserID,
+			&w.Title,
+			&w.Description,
+			&w.StartedAt,
+			&w.DurationMinutes,
+			&w.CaloriesBurned,
+			&w.DistanceMeters,
+			&w.AvgHeartRate,
+			&w.MaxHeartRate,
+			&w.Visibility,
+			&w.ActivityType,
+		}
+		dest = append(dest, wodCols.scanDest()...)
+		err = rows.Scan(append(dest, &author.Username, &bio, &author.IsPrivate)...)
+		if err != nil {
+			return nil, err
+		}
+		w.WOD = wodCols.wod()
+		author.ID = w.UserID
+		author.Bio = bio.String
+		workouts = append(workouts, w)
+		authors = append(authors, author)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadEntries(pg.db, workouts)
+	if err != nil {
+		return nil, err
+	}
+	err = loadEngagement(pg.db, workouts)
+	if err == nil {
+		err = loadTags(pg.db, workouts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed := make([]FeedWorkout, len(workouts))
+	for i := range workouts {
+		feed[i] = FeedWorkout{Workout: workouts[i], Author: authors[i]}
+	}
+	return feed, nil
+}
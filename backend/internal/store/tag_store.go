@@ -0,0 +1,185 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Tag is a user's free-form label for workouts. Names are unique per user
+// regardless of case.
+type Tag struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	WorkoutCount int       `json:"workout_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PostgresTagStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{
+		db: db,
+	}
+}
+
+type TagStore interface {
+	GetTagsForUser(userID int) ([]Tag, error)
+	GetTagByID(id int) (*Tag, error)
+	GetTagByName(userID int, name string) (*Tag, error)
+	RenameTag(id int, name string) error
+	MergeTags(fromID, intoID int) error
+	DeleteTag(id int) error
+}
+
+const tagColumns = `t.id, t.user_id, t.name, t.created_at,
+	(SELECT COUNT(*) FROM workout_tags WHERE tag_id = t.id)`
+
+func (t *Tag) scan(row interface{ Scan(...any) error }) error {
+	return row.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt, &t.WorkoutCount)
+}
+
+func (pg *PostgresTagStore) GetTagsForUser(userID int) ([]Tag, error) {
+	rows, err := pg.db.Query(`SELECT `+tagColumns+` FROM tags t WHERE t.user_id = $1 ORDER BY LOWER(t.name)`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		err = t.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (pg *PostgresTagStore) GetTagByID(id int) (*Tag, error) {
+	return pg.getTag(`WHERE t.id = $1`, id)
+}
+
+// GetTagByName finds the user's tag by name, ignoring case.
+func (pg *PostgresTagStore) GetTagByName(userID int, name string) (*Tag, error) {
+	return pg.getTag(`WHERE t.user_id = $1 AND LOWER(t.name) = LOWER($2)`, userID, name)
+}
+
+func (pg *PostgresTagStore) getTag(clause string, args ...any) (*Tag, error) {
+	t := &Tag{}
+
+	err := t.scan(pg.db.QueryRow(`SELECT `+tagColumns+` FROM tags t `+clause, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (pg *PostgresTagStore) RenameTag(id int, name string) error {
+	return execOne(pg.db, `UPDATE tags SET name = $1 WHERE id = $2`, name, id)
+}
+
+// MergeTags moves every workout tagged fromID over to intoID and deletes
+// fromID. Both must belong to the same user.
+func (pg *PostgresTagStore) MergeTags(fromID, intoID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO workout_tags (workout_id, tag_id)
+	SELECT workout_id, $2 FROM workout_tags WHERE tag_id = $1
+	ON CONFLICT (workout_id, tag_id) DO NOTHING
+	`, fromID, intoID)
+	if err != nil {
+		return err
+	}
+
+	err = execOne(tx, `DELETE FROM tags WHERE id = $1`, fromID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresTagStore) DeleteTag(id int) error {
+	return execOne(pg.db, `DELETE FROM tags WHERE id = $1`, id)
+}
+
+// setWorkoutTags replaces the workout's tags with names, creating the
+// owner's tags that don't exist yet. Names are expected to be deduplicated.
+func setWorkoutTags(tx *sql.Tx, workoutID, userID int, names []string) error {
+	_, err := tx.Exec(`DELETE FROM workout_tags WHERE workout_id = $1`, workoutID)
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO tags (user_id, name)
+	SELECT $1, name FROM unnest($2::text[]) AS name
+	ON CONFLICT (user_id, LOWER(name)) DO NOTHING
+	`, userID, names)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO workout_tags (workout_id, tag_id)
+	SELECT $1, t.id
+	FROM tags t
+	WHERE t.user_id = $2 AND LOWER(t.name) IN (SELECT LOWER(name) FROM unnest($3::text[]) AS name)
+	`, workoutID, userID, names)
+	return err
+}
+
+// loadTags fills in the tag names of workouts with one query.
+func loadTags(db queryer, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(workouts))
+	index := make(map[int]int, len(workouts))
+	for i := range workouts {
+		ids[i] = workouts[i].ID
+		index[workouts[i].ID] = i
+		workouts[i].Tags = []string{}
+	}
+
+	rows, err := db.Query(`
+	SELECT wt.workout_id, t.name
+	FROM workout_tags wt
+	INNER JOIN tags t ON t.id = wt.tag_id
+	WHERE wt.workout_id = ANY($1)
+	ORDER BY LOWER(t.name)
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var name string
+		err = rows.Scan(&workoutID, &name)
+		if err != nil {
+			return err
+		}
+		w := &workouts[index[workoutID]]
+		w.Tags = append(w.Tags, name)
+	}
+
+	return rows.Err()
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"time"
 
@@ -21,6 +22,9 @@ type TokenStore interface {
 	Insert(token *tokens.Token) error
 	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
 	DeleteAllTokensForUser(userID int, scope string) error
+	CreateShareToken(userID, workoutID int, ttl time.Duration) (*tokens.Token, error)
+	GetSharedWorkoutID(tokenPlainText string) (int, error)
+	DeleteShareTokens(workoutID int) error
 }
 
 func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
@@ -39,11 +43,11 @@ func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope
 
 func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO tokens (hash, user_id, expiry, scope, workout_id)
+	VALUES ($1, $2, $3, $4, $5)
 	`
 
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope, token.WorkoutID)
 	return err
 }
 
@@ -56,3 +60,49 @@ func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) er
 	_, err := t.db.Exec(query, scope, userID)
 	return err
 }
+
+// CreateShareToken issues a link token that opens workoutID.
+func (t *PostgresTokenStore) CreateShareToken(userID, workoutID int, ttl time.Duration) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, tokens.ScopeShare)
+	if err != nil {
+		return nil, err
+	}
+	token.WorkoutID = &workoutID
+
+	err = t.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetSharedWorkoutID returns the workout an unexpired share token opens,
+// or 0 when the token is unknown, expired or revoked.
+func (t *PostgresTokenStore) GetSharedWorkoutID(tokenPlainText string) (int, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+	SELECT workout_id
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3 AND workout_id IS NOT NULL
+	`
+
+	var workoutID int
+	err := t.db.QueryRow(query, tokenHash[:], tokens.ScopeShare, time.Now()).Scan(&workoutID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return workoutID, err
+}
+
+// DeleteShareTokens revokes every share link of the workout.
+func (t *PostgresTokenStore) DeleteShareTokens(workoutID int) error {
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND workout_id = $2
+	`
+
+	_, err := t.db.Exec(query, tokens.ScopeShare, workoutID)
+	return err
+}
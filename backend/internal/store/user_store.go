@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -51,6 +52,18 @@ type User struct {
 	Bio          string    `json:"bio"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	MaxHeartRate       *int   `json:"max_heart_rate"`
+	RestingHeartRate   *int   `json:"resting_heart_rate"`
+	ThresholdHeartRate *int   `json:"threshold_heart_rate"`
+	HeartRateZoneModel string `json:"hr_zone_model"`
+
+	// Timezone is an IANA zone name used to work out calendar days and
+	// weeks, e.g. for schedules and weekly analytics.
+	Timezone string `json:"timezone"`
+
+	// IsPrivate accounts approve followers before they see any workouts.
+	IsPrivate bool `json:"is_private"`
 }
 
 var AnonymousUser = &User{}
@@ -59,6 +72,35 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// HeartRateProfile collects the user's heart-rate settings, leaving unset
+// values at zero.
+func (u *User) HeartRateProfile() heartrate.Profile {
+	profile := heartrate.Profile{Model: u.HeartRateZoneModel}
+	if u.MaxHeartRate != nil {
+		profile.MaxHR = *u.MaxHeartRate
+	}
+	if u.RestingHeartRate != nil {
+		profile.RestingHR = *u.RestingHeartRate
+	}
+	if u.ThresholdHeartRate != nil {
+		profile.ThresholdHR = *u.ThresholdHeartRate
+	}
+	if profile.Model == "" {
+		profile.Model = heartrate.ModelPercentMax
+	}
+	return profile
+}
+
+// Location returns the user's time zone, falling back to UTC when it is
+// unset or unknown to this system.
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 // struct for db operations
 type PostgresUserStore struct {
 	db *sql.DB
@@ -84,7 +126,7 @@ func (s *PostgresUserStore) CreateUser(user *User) error {
 	query := `
 	INSERT INTO users (username, email, password_hash, bio)
 	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, updated_at
+	RETURNING id, created_at, updated_at, hr_zone_model, timezone, is_private
 	`
 
 	err := s.db.QueryRow(
@@ -97,6 +139,9 @@ func (s *PostgresUserStore) CreateUser(user *User) error {
 		&user.ID,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.HeartRateZoneModel,
+		&user.Timezone,
+		&user.IsPrivate,
 	)
 	if err != nil {
 		return err
@@ -112,7 +157,8 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	}
 
 	query := `
-	SELECT id, username, email, password_hash, bio, created_at, updated_at
+	SELECT id, username, email, password_hash, bio, created_at, updated_at,
+		max_heart_rate, resting_heart_rate, threshold_heart_rate, hr_zone_model, timezone, is_private
 	FROM users
 	WHERE username = $1
 	`
@@ -128,6 +174,12 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 		&user.Bio,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.MaxHeartRate,
+		&user.RestingHeartRate,
+		&user.ThresholdHeartRate,
+		&user.HeartRateZoneModel,
+		&user.Timezone,
+		&user.IsPrivate,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -143,8 +195,9 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 func (s *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 	UPDATE users
-	SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP
-	WHERE id = $4
+	SET username = $1, email = $2, bio = $3, max_heart_rate = $4, resting_heart_rate = $5,
+		threshold_heart_rate = $6, hr_zone_model = $7, timezone = $8, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $9
 	RETURNING updated_at
 	`
 
@@ -153,6 +206,11 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 		user.Username,
 		user.Email,
 		user.Bio,
+		user.MaxHeartRate,
+		user.RestingHeartRate,
+		user.ThresholdHeartRate,
+		user.HeartRateZoneModel,
+		user.Timezone,
 		user.ID,
 	)
 	if err != nil {
@@ -175,7 +233,8 @@ func (s *PostgresUserStore) GetUserToken(scope, plainTextPassword string) (*User
 	tokenHash := sha256.Sum256([]byte(plainTextPassword))
 
 	query := `
-	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at,
+		u.max_heart_rate, u.resting_heart_rate, u.threshold_heart_rate, u.hr_zone_model, u.timezone, u.is_private
 	FROM users u
 	INNER JOIN tokens t ON t.user_id = u.id
 	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
@@ -198,6 +257,12 @@ func (s *PostgresUserStore) GetUserToken(scope, plainTextPassword string) (*User
 		&user.Bio,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.MaxHeartRate,
+		&user.RestingHeartRate,
+		&user.ThresholdHeartRate,
+		&user.HeartRateZoneModel,
+		&user.Timezone,
+		&user.IsPrivate,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ExerciseSuggestion is one of a user's exercise names with how well it
+// matches what was typed and how often it has been logged.
+type ExerciseSuggestion struct {
+	Name       string    `json:"name"`
+	Uses       int       `json:"uses"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Similarity float64   `json:"similarity"`
+}
+
+// ExerciseMerge describes renaming a user's entries from one exercise name
+// to another, as previewed or as done.
+type ExerciseMerge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Entries  int    `json:"entries"`
+	Workouts int    `json:"workouts"`
+	Goals    int    `json:"goals"`
+	// ExistingEntries were already logged under To.
+	ExistingEntries  int             `json:"existing_entries"`
+	AffectedWorkouts []MergedWorkout `json:"affected_workouts"`
+}
+
+// MergedWorkout is a workout with entries under the merged name.
+type MergedWorkout struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	StartedAt time.Time `json:"started_at"`
+	Entries   int       `json:"entries"`
+}
+
+// mergedName matches the names a merge renames: from in any case, like
+// goals and records match exercises, except those already spelled as to.
+// It expects from as $2 and to as $3.
+const mergedName = `LOWER(exercise_name) = LOWER($2) AND exercise_name <> $3`
+
+// maxMergePreviewWorkouts caps the workouts listed in a merge, most
+// recent first; the counts always cover all of them.
+const maxMergePreviewWorkouts = 50
+
+// SuggestExercises ranks the user's own exercise names against q. Names
+// match when they are similar as a whole ("Benchpress") or contain words
+// like it ("bench" in "BB Bench Press"); similar names logged more often
+// rank higher.
+func (pg *PostgresWorkoutStore) SuggestExercises(userID int, q string, limit int) ([]ExerciseSuggestion, error) {
+	query := `
+	SELECT name, uses, last_used_at, score
+	FROM (
+		SELECT e.exercise_name AS name, COUNT(*) AS uses, MAX(w.started_at) AS last_used_at,
+			GREATEST(similarity(e.exercise_name, $2), word_similarity($2, e.exercise_name)) AS score
+		FROM workout_entries e
+		INNER JOIN workouts w ON w.id = e.workout_id
+		WHERE w.user_id = $1 AND (e.exercise_name % $2 OR $2 <% e.exercise_name)
+		GROUP BY e.exercise_name
+	) names
+	ORDER BY score * (1 + 0.1 * ln(uses)) DESC, uses DESC, name
+	LIMIT $3
+	`
+
+	rows, err := pg.db.Query(query, userID, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []ExerciseSuggestion{}
+	for rows.Next() {
+		var s ExerciseSuggestion
+		err = rows.Scan(&s.Name, &s.Uses, &s.LastUsedAt, &s.Similarity)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// PreviewExerciseMerge reports what MergeExercises would change without
+// changing anything.
+func (pg *PostgresWorkoutStore) PreviewExerciseMerge(userID int, from, to string) (*ExerciseMerge, error) {
+	return previewExerciseMerge(pg.db, userID, from, to)
+}
+
+// MergeExercises renames every one of the user's entries and goals logged
+// as from, in any case, to to, in one transaction. It returns
+// sql.ErrNoRows when no entry would change.
+func (pg *PostgresWorkoutStore) MergeExercises(userID int, from, to string) (*ExerciseMerge, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	merge, err := previewExerciseMerge(tx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if merge.Entries == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`
+	UPDATE workout_entries
+	SET exercise_name = $3
+	WHERE workout_id IN (SELECT id FROM workouts WHERE user_id = $1) AND `+mergedName,
+		userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE goals SET exercise_name = $3 WHERE user_id = $1 AND `+mergedName, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.run(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return merge, nil
+}
+
+func previewExerciseMerge(db queryer, userID int, from, to string) (*ExerciseMerge, error) {
+	merge := &ExerciseMerge{From: from, To: to, AffectedWorkouts: []MergedWorkout{}}
+
+	err := db.QueryRow(`
+	SELECT
+		COUNT(*) FILTER (WHERE `+mergedName+`),
+		COUNT(DISTINCT e.workout_id) FILTER (WHERE `+mergedName+`),
+		COUNT(*) FILTER (WHERE exercise_name = $3),
+		(SELECT COUNT(*) FROM goals WHERE user_id = $1 AND `+mergedName+`)
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1 AND (LOWER(exercise_name) = LOWER($2) OR exercise_name = $3)
+	`, userID, from, to).Scan(&merge.Entries, &merge.Workouts, &merge.ExistingEntries, &merge.Goals)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+	SELECT w.id, w.title, w.started_at, COUNT(*)
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1 AND `+mergedName+`
+	GROUP BY w.id
+	ORDER BY w.started_at DESC, w.id DESC
+	LIMIT $4
+	`, userID, from, to, maxMergePreviewWorkouts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mw MergedWorkout
+		err = rows.Scan(&mw.ID, &mw.Title, &mw.StartedAt, &mw.Entries)
+		if err != nil {
+			return nil, err
+		}
+		merge.AffectedWorkouts = append(merge.AffectedWorkouts, mw)
+	}
+
+	return merge, rows.Err()
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"database/sql"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WorkoutSearch is a full-text query with optional filters. Zero fields
+// don't filter.
+type WorkoutSearch struct {
+	// Query is in web search syntax: quoted phrases, "or" and -negation.
+	Query        string
+	UserID       int
+	ActivityType string
+	Tag          string
+	From, To     time.Time
+	Limit        int
+	Offset       int
+}
+
+// SearchResult is a workout matching a search. The highlights are HTML
+// escaped, with the matched words wrapped in <mark> tags.
+type SearchResult struct {
+	WorkoutID      int         `json:"workout_id"`
+	Owner          UserSummary `json:"owner"`
+	Title          string      `json:"title"`
+	StartedAt      time.Time   `json:"started_at"`
+	ActivityType   string      `json:"activity_type"`
+	Visibility     string      `json:"visibility"`
+	Rank           float64     `json:"rank"`
+	TitleHighlight string      `json:"title_highlight"`
+	Snippet        string      `json:"snippet"`
+}
+
+// visibleToViewer mirrors authz.Checker.Workout for View access with the
+// viewer's ID as $1: their own workouts, public ones, followers-only ones
+// of people they follow and everything of athletes they coach with read
+// access.
+const visibleToViewer = `(
+	w.user_id = $1
+	OR w.visibility = 'public'
+	OR (w.visibility = 'followers' AND EXISTS (
+		SELECT 1 FROM follows f
+		WHERE f.follower_id = $1 AND f.followee_id = w.user_id AND f.status = 'accepted'))
+	OR EXISTS (
+		SELECT 1 FROM coaching_grants g
+		WHERE g.coach_id = $1 AND g.athlete_id = w.user_id AND g.status = 'active' AND g.can_read)
+)`
+
+// Highlights are built with markers no one types so the text around them
+// can be escaped before they become <mark> tags.
+const (
+	highlightStart = "⟦"
+	highlightStop  = "⟧"
+)
+
+var highlightTags = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+func highlight(s string) string {
+	return highlightTags.Replace(html.EscapeString(s))
+}
+
+// SearchWorkouts finds the workouts viewerID may see that match the
+// search, best match first. Titles weigh most, then descriptions and
+// exercise names, then entry notes.
+func (pg *PostgresWorkoutStore) SearchWorkouts(viewerID int, search WorkoutSearch) ([]SearchResult, error) {
+	args := []any{viewerID, search.Query}
+	where := `w.search_vector @@ q.query AND ` + visibleToViewer
+	arg := func(v any) string {
+		args = append(args, v)
+		return `$` + strconv.Itoa(len(args))
+	}
+
+	if search.UserID != 0 {
+		where += ` AND w.user_id = ` + arg(search.UserID)
+	}
+	if search.ActivityType != "" {
+		where += ` AND w.activity_type = ` + arg(search.ActivityType)
+	}
+	if search.Tag != "" {
+		where += ` AND w.id IN (
+			SELECT wt.workout_id FROM workout_tags wt INNER JOIN tags t ON t.id = wt.tag_id
+			WHERE LOWER(t.name) = LOWER(` + arg(search.Tag) + `))`
+	}
+	if !search.From.IsZero() {
+		where += ` AND w.started_at >= ` + arg(search.From)
+	}
+	if !search.To.IsZero() {
+		where += ` AND w.started_at < ` + arg(search.To)
+	}
+
+	selectors := `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+	titleOptions := arg(`HighlightAll=true, ` + selectors)
+	snippetOptions := arg(`MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=" … ", ` + selectors)
+
+	// snippets are only worked out for the page of hits
+	query := `
+	WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+	SELECT w.id, u.id, u.username, u.bio, u.is_private, w.title, w.started_at, w.activity_type, w.visibility, hits.rank,
+		ts_headline('english', w.title, q.query, ` + titleOptions + `),
+		ts_headline('english', concat_ws(' … ', NULLIF(w.description, ''), (
+			SELECT string_agg(concat_ws(': ', e.exercise_name, NULLIF(e.notes, '')), ' … ' ORDER BY e.order_index)
+			FROM workout_entries e
+			WHERE e.workout_id = w.id
+		)), q.query, ` + snippetOptions + `)
+	FROM (
+		SELECT w.id, ts_rank_cd(w.search_vector, q.query) AS rank
+		FROM workouts w, q
+		WHERE ` + where + `
+		ORDER BY rank DESC, w.started_at DESC, w.id DESC
+		LIMIT ` + arg(search.Limit) + ` OFFSET ` + arg(search.Offset) + `
+	) hits
+	INNER JOIN workouts w ON w.id = hits.id
+	INNER JOIN users u ON u.id = w.user_id
+	CROSS JOIN q
+	ORDER BY hits.rank DESC, w.started_at DESC, w.id DESC
+	`
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var bio, snippet sql.NullString
+		err = rows.Scan(&r.WorkoutID, &r.Owner.ID, &r.Owner.Username, &bio, &r.Owner.IsPrivate,
+			&r.Title, &r.StartedAt, &r.ActivityType, &r.Visibility, &r.Rank, &r.TitleHighlight, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Owner.Bio = bio.String
+		r.TitleHighlight = highlight(r.TitleHighlight)
+		r.Snippet = highlight(snippet.String)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
@@ -1,17 +1,54 @@
 package store
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/strangecousinwst/goworkout/internal/heartrate"
+	"github.com/strangecousinwst/goworkout/internal/wod"
+)
+
+// Workout is a logged session. Entries holds the entries that aren't part
+// of a group; grouped ones are nested under Groups.
 type Workout struct {
-	ID              int            `json:"id"`
-	UserID          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calorties_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID              int       `json:"id"`
+	UserID          int       `json:"user_id"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationMinutes int       `json:"duration_minutes"`
+	CaloriesBurned  int       `json:"calorties_burned"`
+	DistanceMeters  *float64  `json:"distance_meters"`
+	AvgHeartRate    *int      `json:"avg_heart_rate"`
+	MaxHeartRate    *int      `json:"max_heart_rate"`
+	Source          string    `json:"source,omitempty"`
+	SourceID        string    `json:"source_id,omitempty"`
+	WOD             *wod.WOD  `json:"wod"`
+	// ActivityType is one of the Activity* constants.
+	ActivityType string `json:"activity_type"`
+	// Tags are the owner's tag names, see TagStore.
+	Tags []string `json:"tags"`
+	// Visibility is who besides the owner may read the workout; see
+	// package authz.
+	Visibility string `json:"visibility"`
+	// CreatedBy and UpdatedBy differ from UserID when a coach wrote the
+	// workout on the athlete's behalf.
+	CreatedBy *int `json:"created_by"`
+	UpdatedBy *int `json:"updated_by"`
+	// Engagement is only loaded where workouts are shown to people, not
+	// for exports and analytics.
+	Engagement *Engagement    `json:"engagement,omitempty"`
+	Entries    []WorkoutEntry `json:"entries"`
+	Groups     []EntryGroup   `json:"groups"`
 }
 
+// ErrDuplicateSource is returned when a record imported from another app
+// was already imported, as identified by its source and source ID.
+var ErrDuplicateSource = errors.New("record from this source was already imported")
+
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
 	ExerciseName    string   `json:"exercise_name"`
@@ -19,12 +56,93 @@ type WorkoutEntry struct {
 	Reps            *int     `json:"reps"`
 	DurationSeconds *int     `json:"duration_seconds"`
 	Weight          *float64 `json:"weight"`
+	DistanceMeters  *float64 `json:"distance_meters"`
 	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	// RestSeconds is the rest taken between sets.
+	RestSeconds *int `json:"rest_seconds"`
+	// Tempo is the prescribed lifting tempo, e.g. "3-1-1-0"; see package
+	// tempo.
+	Tempo      string `json:"tempo"`
+	OrderIndex int    `json:"order_index"`
+}
+
+const (
+	ActivityRunning  = "running"
+	ActivityWalking  = "walking"
+	ActivityCycling  = "cycling"
+	ActivitySwimming = "swimming"
+	ActivityRowing   = "rowing"
+	ActivityStrength = "strength"
+	ActivityHIIT     = "hiit"
+	ActivityCrossFit = "crossfit"
+	ActivityYoga     = "yoga"
+	ActivityPilates  = "pilates"
+	ActivityOther    = "other"
+)
+
+// ActivityTypes lists the activity types in display order.
+var ActivityTypes = []string{
+	ActivityRunning, ActivityWalking, ActivityCycling, ActivitySwimming, ActivityRowing,
+	ActivityStrength, ActivityHIIT, ActivityCrossFit, ActivityYoga, ActivityPilates, ActivityOther,
+}
+
+// ValidActivityType reports whether activityType is one of ActivityTypes.
+func ValidActivityType(activityType string) bool {
+	for _, t := range ActivityTypes {
+		if t == activityType {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	VisibilityPrivate   = "private"
+	VisibilityFollowers = "followers"
+	VisibilityPublic    = "public"
+)
+
+const (
+	GroupSuperset = "superset"
+	GroupCircuit  = "circuit"
+	GroupGiantSet = "giant_set"
+)
+
+// EntryGroup is a block of entries performed back to back for a number of
+// rounds, like an A1/A2 superset. Its OrderIndex places it among the
+// workout's ungrouped entries; the OrderIndex of its entries orders them
+// within the group, and their Sets count per round.
+type EntryGroup struct {
+	ID                       int            `json:"id"`
+	Kind                     string         `json:"kind"`
+	Rounds                   int            `json:"rounds"`
+	RestBetweenRoundsSeconds *int           `json:"rest_between_rounds_seconds"`
+	OrderIndex               int            `json:"order_index"`
+	Entries                  []WorkoutEntry `json:"entries"`
+}
+
+// EachEntry calls fn for every entry of the workout in workout order,
+// passing the entry's group, or nil for ungrouped entries.
+func (w *Workout) EachEntry(fn func(entry *WorkoutEntry, group *EntryGroup)) {
+	i, j := 0, 0
+	for i < len(w.Entries) || j < len(w.Groups) {
+		if j == len(w.Groups) || (i < len(w.Entries) && w.Entries[i].OrderIndex <= w.Groups[j].OrderIndex) {
+			fn(&w.Entries[i], nil)
+			i++
+			continue
+		}
+
+		group := &w.Groups[j]
+		for k := range group.Entries {
+			fn(&group.Entries[k], group)
+		}
+		j++
+	}
 }
 
 type PostgresWorkoutStore struct {
 	db *sql.DB
+	writeHooks
 }
 
 func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
@@ -35,11 +153,25 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
+	ImportWorkouts([]*Workout) (int, error)
+	RunWriteHooks(userID int) error
 	GetWorkoutByID(id int) (*Workout, error)
 	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int) error
+	DeleteWorkout(id, actorID int) error
 	GetWorkoutOwner(id int) (int, error)
-	GetWorkoutsForUser(id int) ([]Workout, error)
+	GetWorkoutsForUser(id int, filter WorkoutFilter) ([]Workout, error)
+	ReplaceHeartRateSamples(workoutID int, samples []heartrate.Sample) error
+	CreateWorkoutWithHeartRate(workout *Workout, samples []heartrate.Sample) (*Workout, error)
+	GetHeartRateSamples(workoutID int) ([]heartrate.Sample, error)
+	StreamWorkoutsForUser(userID int, fn func(*Workout) error) error
+	GetWorkoutStarts(userID int, from, to time.Time) ([]WorkoutStart, error)
+	GetExerciseNamesForUser(userID int) ([]string, error)
+	SuggestExercises(userID int, q string, limit int) ([]ExerciseSuggestion, error)
+	PreviewExerciseMerge(userID int, from, to string) (*ExerciseMerge, error)
+	MergeExercises(userID int, from, to string) (*ExerciseMerge, error)
+	GetWODResults(userID int, name string) ([]Workout, error)
+	GetWorkoutVisibility(id int) (ownerID int, visibility string, err error)
+	SearchWorkouts(viewerID int, search WorkoutSearch) ([]SearchResult, error)
 }
 
 func (s *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -49,70 +181,162 @@ func (s *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error)
 	}
 	defer tx.Rollback()
 
+	err = insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.run(tx, workout.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// ImportWorkouts creates imported workouts in one transaction without
+// running the write hooks, which the caller runs once with RunWriteHooks
+// when the whole import is in. Workouts that were already imported are
+// skipped and keep a zero ID. It returns how many were created.
+func (s *PostgresWorkoutStore) ImportWorkouts(workouts []*Workout) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	for _, workout := range workouts {
+		err = insertWorkout(tx, workout)
+		if err == ErrDuplicateSource {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		created++
+	}
+
+	return created, tx.Commit()
+}
+
+// RunWriteHooks runs the write hooks for userID in a transaction of their
+// own, for writes made through ImportWorkouts.
+func (s *PostgresWorkoutStore) RunWriteHooks(userID int) error {
+	return s.runInTx(s.db, userID)
+}
+
+// insertWorkout inserts a workout with its entries, groups and tags, and
+// audits the creation. An imported workout that was already imported
+// returns ErrDuplicateSource.
+func insertWorkout(tx *sql.Tx, workout *Workout) error {
+	if workout.StartedAt.IsZero() {
+		workout.StartedAt = time.Now()
+	}
+	if workout.Visibility == "" {
+		workout.Visibility = VisibilityPrivate
+	}
+	if workout.CreatedBy == nil {
+		workout.CreatedBy = &workout.UserID
+	}
+	if workout.ActivityType == "" {
+		workout.ActivityType = ActivityOther
+	}
+
 	query := `
-	INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO workouts (user_id, title, description, started_at, duration_minutes, calories_burned, distance_meters, avg_heart_rate, max_heart_rate, source, source_id,
+		visibility, created_by, ` + wodColumnList + `, activity_type)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+	ON CONFLICT (user_id, source, source_id) WHERE source_id IS NOT NULL DO NOTHING
 	RETURNING ID
 	`
 
-	err = tx.QueryRow(
-		query,
+	args := []any{
 		workout.UserID,
 		workout.Title,
 		workout.Description,
+		workout.StartedAt,
 		workout.DurationMinutes,
 		workout.CaloriesBurned,
-	).Scan(
+		workout.DistanceMeters,
+		workout.AvgHeartRate,
+		workout.MaxHeartRate,
+		workout.Source,
+		workout.SourceID,
+		workout.Visibility,
+		workout.CreatedBy,
+	}
+	args = append(args, wodArgs(workout.WOD)...)
+	err := tx.QueryRow(query, append(args, workout.ActivityType)...).Scan(
 		&workout.ID,
 	)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateSource
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for i := range workout.Entries {
-		entry := &workout.Entries[i]
+	err = insertEntries(tx, workout.ID, nil, workout.Entries)
+	if err != nil {
+		return err
+	}
 
-		query = `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-		`
+	err = insertGroups(tx, workout.ID, workout.Groups)
+	if err != nil {
+		return err
+	}
 
-		err = tx.QueryRow(
-			query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		).Scan(
-			&entry.ID,
-		)
-		if err != nil {
-			return nil, err
-		}
+	err = setWorkoutTags(tx, workout.ID, workout.UserID, workout.Tags)
+	if err != nil {
+		return err
+	}
+	if workout.Tags == nil {
+		workout.Tags = []string{}
 	}
 
-	err = tx.Commit()
+	err = recordAudit(tx, workout.ID, workout.UserID, workout.CreatedBy, "create")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return workout, nil
+	return nil
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 	workout := &Workout{}
 	query := `
-	SELECT id, title, description, duration_minutes, calories_burned
+	SELECT id, user_id, title, description, started_at, duration_minutes, calories_burned, distance_meters, avg_heart_rate, max_heart_rate,
+		COALESCE(source, ''), COALESCE(source_id, ''), visibility, created_by, updated_by, activity_type, ` + wodColumnList + `
 	FROM workouts
 	WHERE id = $1
 	`
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	var wodCols wodColumns
+	dest := []any{
+		&workout.ID,
+		&workout.UserID,
+		&workout.Title,
+		&workout.Description,
+		&workout.StartedAt,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.DistanceMeters,
+		&workout.AvgHeartRate,
+		&workout.MaxHeartRate,
+		&workout.Source,
+		&workout.SourceID,
+		&workout.Visibility,
+		&workout.CreatedBy,
+		&workout.UpdatedBy,
+		&workout.ActivityType,
+	}
+	err := pg.db.QueryRow(query, id).Scan(append(dest, wodCols.scanDest()...)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -120,13 +344,15 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 	if err != nil {
 		return nil, err
 	}
+	workout.WOD = wodCols.wod()
 
 	// get the entries
 	entryQuery := `
-	SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-	FROM workout_entries
-	WHERE workout_id = $1
-	ORDER BY order_index
+	SELECT ` + entryColumns + `
+	FROM workout_entries e
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE e.workout_id = $1
+	ORDER BY ` + entryOrder + `
 	`
 
 	rows, err := pg.db.Query(entryQuery, workout.ID)
@@ -137,21 +363,27 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 
 	for rows.Next() {
 		var entry WorkoutEntry
-		err := rows.Scan(
-			&entry.ID,
-			&entry.ExerciseName,
-			&entry.Sets,
-			&entry.Reps,
-			&entry.DurationSeconds,
-			&entry.Weight,
-			&entry.Notes,
-			&entry.OrderIndex,
-		)
+		var group groupColumns
+		err := rows.Scan(append(entry.scanDest(), group.scanDest()...)...)
 		if err != nil {
 			return nil, err
 		}
-		workout.Entries = append(workout.Entries, entry)
+		workout.addEntry(entry, &group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	engaged := []Workout{*workout}
+	err = loadEngagement(pg.db, engaged)
+	if err == nil {
+		err = loadTags(pg.db, engaged)
+	}
+	if err != nil {
+		return nil, err
 	}
+	workout.Engagement = engaged[0].Engagement
+	workout.Tags = engaged[0].Tags
 
 	return workout, nil
 }
@@ -165,73 +397,328 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 
 	query := `
 	UPDATE workouts
-	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-	WHERE id = $5
+	SET title = $1, description = $2, started_at = $3, duration_minutes = $4, calories_burned = $5,
+		distance_meters = $6, avg_heart_rate = $7, max_heart_rate = $8, updated_at = CURRENT_TIMESTAMP,
+		wod_format = $10, wod_name = $11, wod_time_cap_seconds = $12, wod_interval_seconds = $13, wod_rounds = $14,
+		score_rounds = $15, score_reps = $16, score_time_seconds = $17, visibility = $18, updated_by = $19, activity_type = $20
+	WHERE id = $9
+	RETURNING user_id
 	`
 
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	args := []any{
+		workout.Title,
+		workout.Description,
+		workout.StartedAt,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.DistanceMeters,
+		workout.AvgHeartRate,
+		workout.MaxHeartRate,
+		workout.ID,
+	}
+	args = append(args, wodArgs(workout.WOD)...)
+	var userID int
+	err = tx.QueryRow(query, append(args, workout.Visibility, workout.UpdatedBy, workout.ActivityType)...).Scan(&userID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	_, err = tx.Exec("DELETE FROM workout_entries WHERE workout_id = $1", workout.ID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	_, err = tx.Exec("DELETE FROM workout_entry_groups WHERE workout_id = $1", workout.ID)
+	if err != nil {
+		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM workout_entries WHERE workout_id = $1", workout.ID)
+	err = insertEntries(tx, workout.ID, nil, workout.Entries)
+	if err != nil {
+		return err
+	}
+
+	err = insertGroups(tx, workout.ID, workout.Groups)
+	if err != nil {
+		return err
+	}
+
+	err = setWorkoutTags(tx, workout.ID, userID, workout.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(tx, workout.ID, userID, workout.UpdatedBy, "update")
+	if err != nil {
+		return err
+	}
+
+	err = pg.run(tx, userID)
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range workout.Entries {
-		query = `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
+	return tx.Commit()
+}
 
-		_, err = tx.Exec(query,
-			workout.ID,
+// insertEntries inserts entries for the workout, as members of groupID
+// when it is not nil, and sets their IDs.
+func insertEntries(tx *sql.Tx, workoutID int, groupID *int, entries []WorkoutEntry) error {
+	query := `
+	INSERT INTO workout_entries (workout_id, group_id, exercise_name, sets, reps, duration_seconds, weight, distance_meters, notes, rest_seconds, tempo, order_index)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id
+	`
+
+	for i := range entries {
+		entry := &entries[i]
+
+		err := tx.QueryRow(
+			query,
+			workoutID,
+			groupID,
 			entry.ExerciseName,
 			entry.Sets,
 			entry.Reps,
 			entry.DurationSeconds,
 			entry.Weight,
+			entry.DistanceMeters,
 			entry.Notes,
+			entry.RestSeconds,
+			entry.Tempo,
 			entry.OrderIndex,
+		).Scan(
+			&entry.ID,
 		)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return nil
+}
+
+// insertGroups inserts the workout's entry groups with their entries.
+func insertGroups(tx *sql.Tx, workoutID int, groups []EntryGroup) error {
+	query := `
+	INSERT INTO workout_entry_groups (workout_id, kind, rounds, rest_between_rounds_seconds, order_index)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id
+	`
+
+	for i := range groups {
+		group := &groups[i]
+
+		err := tx.QueryRow(
+			query,
+			workoutID,
+			group.Kind,
+			group.Rounds,
+			group.RestBetweenRoundsSeconds,
+			group.OrderIndex,
+		).Scan(
+			&group.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = insertEntries(tx, workoutID, &group.ID, group.Entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wodColumnList is the workout's format and score, scanned with
+// wodColumns.scanDest and written with wodArgs.
+const wodColumnList = `wod_format, wod_name, wod_time_cap_seconds, wod_interval_seconds, wod_rounds,
+	score_rounds, score_reps, score_time_seconds`
+
+// wodColumns receives the nullable WOD columns of a workout row.
+type wodColumns struct {
+	format, name                      sql.NullString
+	timeCap, interval, rounds         *int
+	scoreRounds, scoreReps, scoreTime *int
+}
+
+func (c *wodColumns) scanDest() []any {
+	return []any{&c.format, &c.name, &c.timeCap, &c.interval, &c.rounds, &c.scoreRounds, &c.scoreReps, &c.scoreTime}
+}
+
+// wod returns nil for workouts without a format.
+func (c *wodColumns) wod() *wod.WOD {
+	if !c.format.Valid {
+		return nil
+	}
+
+	w := &wod.WOD{
+		Format:          wod.Format(c.format.String),
+		Name:            c.name.String,
+		TimeCapSeconds:  c.timeCap,
+		IntervalSeconds: c.interval,
+		Rounds:          c.rounds,
+	}
+	if c.scoreRounds != nil || c.scoreReps != nil || c.scoreTime != nil {
+		w.Score = &wod.Score{Rounds: c.scoreRounds, Reps: c.scoreReps, TimeSeconds: c.scoreTime}
+	}
+	return w
+}
+
+// wodArgs returns the values for wodColumnList, all NULL when w is nil.
+func wodArgs(w *wod.WOD) []any {
+	if w == nil {
+		return make([]any, 8)
+	}
+
+	var name *string
+	if w.Name != "" {
+		name = &w.Name
+	}
+	score := w.Score
+	if score == nil {
+		score = &wod.Score{}
+	}
+	return []any{string(w.Format), name, w.TimeCapSeconds, w.IntervalSeconds, w.Rounds, score.Rounds, score.Reps, score.TimeSeconds}
+}
+
+// entryColumns selects an entry followed by its group's columns, which are
+// all NULL for ungrouped entries. Use with
+// "workout_entries e LEFT JOIN workout_entry_groups g ON g.id = e.group_id"
+// and scan with WorkoutEntry.scanDest and groupColumns.scanDest.
+const entryColumns = `e.id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.distance_meters, e.notes, e.rest_seconds, e.tempo, e.order_index,
+	g.id, g.kind, g.rounds, g.rest_between_rounds_seconds, g.order_index`
+
+// entryOrder keeps a group's entries together at the group's position.
+const entryOrder = `COALESCE(g.order_index, e.order_index), g.id NULLS FIRST, e.order_index`
+
+func (e *WorkoutEntry) scanDest() []any {
+	return []any{
+		&e.ID,
+		&e.ExerciseName,
+		&e.Sets,
+		&e.Reps,
+		&e.DurationSeconds,
+		&e.Weight,
+		&e.DistanceMeters,
+		&e.Notes,
+		&e.RestSeconds,
+		&e.Tempo,
+		&e.OrderIndex,
+	}
+}
+
+// groupColumns receives the nullable group columns of an entry row.
+type groupColumns struct {
+	id         sql.NullInt64
+	kind       sql.NullString
+	rounds     sql.NullInt64
+	rest       *int
+	orderIndex sql.NullInt64
+}
+
+func (g *groupColumns) scanDest() []any {
+	return []any{&g.id, &g.kind, &g.rounds, &g.rest, &g.orderIndex}
+}
+
+// addEntry appends entry to the workout, nesting it under its group when
+// it has one. Rows must arrive in entryOrder.
+func (w *Workout) addEntry(entry WorkoutEntry, g *groupColumns) {
+	if !g.id.Valid {
+		w.Entries = append(w.Entries, entry)
+		return
+	}
+
+	n := len(w.Groups)
+	if n == 0 || w.Groups[n-1].ID != int(g.id.Int64) {
+		w.Groups = append(w.Groups, EntryGroup{
+			ID:                       int(g.id.Int64),
+			Kind:                     g.kind.String,
+			Rounds:                   int(g.rounds.Int64),
+			RestBetweenRoundsSeconds: g.rest,
+			OrderIndex:               int(g.orderIndex.Int64),
+		})
+		n++
+	}
+	w.Groups[n-1].Entries = append(w.Groups[n-1].Entries, entry)
+}
+
+// loadEntries fills in the entries and groups of workouts with one query.
+func loadEntries(db queryer, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(workouts))
+	index := make(map[int]int, len(workouts))
+	for i := range workouts {
+		ids[i] = workouts[i].ID
+		index[workouts[i].ID] = i
+	}
+
+	query := `
+	SELECT e.workout_id, ` + entryColumns + `
+	FROM workout_entries e
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE e.workout_id = ANY($1)
+	ORDER BY e.workout_id, ` + entryOrder + `
+	`
+
+	rows, err := db.Query(query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		var group groupColumns
+		dest := append([]any{&workoutID}, entry.scanDest()...)
+		err = rows.Scan(append(dest, group.scanDest()...)...)
+		if err != nil {
+			return err
+		}
+		workouts[index[workoutID]].addEntry(entry, &group)
+	}
+
+	return rows.Err()
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
+// DeleteWorkout deletes a workout on behalf of actorID, who is the owner
+// or one of their coaches.
+func (pg *PostgresWorkoutStore) DeleteWorkout(id, actorID int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 	DELETE FROM workouts
 	WHERE id = $1
+	RETURNING user_id
 	`
 
-	result, err := pg.db.Exec(query, id)
+	var userID int
+	err = tx.QueryRow(query, id).Scan(&userID)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+
+	err = recordAudit(tx, id, userID, &actorID, "delete")
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	err = pg.run(tx, userID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int) (int, error) {
@@ -251,15 +738,36 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int) (int, error) {
 	return userID, nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutsForUser(userID int) ([]Workout, error) {
+// WorkoutFilter narrows a workout list. Zero fields don't filter.
+type WorkoutFilter struct {
+	ActivityType string
+	// Tag matches a tag name regardless of case.
+	Tag string
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutsForUser(userID int, filter WorkoutFilter) ([]Workout, error) {
+	args := []any{userID}
+	where := `user_id = $1`
+	if filter.ActivityType != "" {
+		args = append(args, filter.ActivityType)
+		where += ` AND activity_type = $` + strconv.Itoa(len(args))
+	}
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		where += ` AND id IN (
+			SELECT wt.workout_id FROM workout_tags wt INNER JOIN tags t ON t.id = wt.tag_id
+			WHERE t.user_id = $1 AND LOWER(t.name) = LOWER($` + strconv.Itoa(len(args)) + `))`
+	}
+
 	query := `
-    SELECT id, user_id, title, description, duration_minutes, calories_burned
+    SELECT id, user_id, title, description, started_at, duration_minutes, calories_burned, distance_meters, avg_heart_rate, max_heart_rate,
+        visibility, created_by, updated_by, activity_type, ` + wodColumnList + `
     FROM workouts
-    WHERE user_id = $1
-    ORDER BY created_at DESC
+    WHERE ` + where + `
+    ORDER BY started_at DESC
     `
 
-	rows, err := pg.db.Query(query, userID)
+	rows, err := pg.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -268,55 +776,393 @@ func (pg *PostgresWorkoutStore) GetWorkoutsForUser(userID int) ([]Workout, error
 	var workouts []Workout
 	for rows.Next() {
 		var w Workout
-		err := rows.Scan(
+		var wodCols wodColumns
+		dest := []any{
 			&w.ID,
 			&w.UserID,
 			&w.Title,
 			&w.Description,
+			&w.StartedAt,
 			&w.DurationMinutes,
 			&w.CaloriesBurned,
-		)
+			&w.DistanceMeters,
+			&w.AvgHeartRate,
+			&w.MaxHeartRate,
+			&w.Visibility,
+			&w.CreatedBy,
+			&w.UpdatedBy,
+			&w.ActivityType,
+		}
+		err := rows.Scan(append(dest, wodCols.scanDest()...)...)
+		if err != nil {
+			return nil, err
+		}
+		w.WOD = wodCols.wod()
+		workouts = append(workouts, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadEntries(pg.db, workouts)
+	if err == nil {
+		err = loadEngagement(pg.db, workouts)
+	}
+	if err == nil {
+		err = loadTags(pg.db, workouts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return workouts, nil
+}
+
+// ReplaceHeartRateSamples swaps the workout's heart-rate series for samples
+// and refreshes its average and max HR from the new series.
+func (pg *PostgresWorkoutStore) ReplaceHeartRateSamples(workoutID int, samples []heartrate.Sample) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceHeartRateSamples(tx, workoutID, samples)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateWorkoutWithHeartRate creates a workout together with its
+// heart-rate series, so an import never leaves a workout without the
+// samples it came with. Like CreateWorkout it returns ErrDuplicateSource
+// for a workout that was already imported.
+func (pg *PostgresWorkoutStore) CreateWorkoutWithHeartRate(workout *Workout, samples []heartrate.Sample) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = insertWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(samples) > 0 {
+		err = replaceHeartRateSamples(tx, workout.ID, samples)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = pg.run(tx, workout.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+func replaceHeartRateSamples(tx *sql.Tx, workoutID int, samples []heartrate.Sample) error {
+	_, err := tx.Exec("DELETE FROM workout_heart_rate_samples WHERE workout_id = $1", workoutID)
+	if err != nil {
+		return err
+	}
+
+	offsets := make([]int32, len(samples))
+	bpms := make([]int32, len(samples))
+	for i, sample := range samples {
+		offsets[i] = int32(sample.OffsetSeconds)
+		bpms[i] = int32(sample.BPM)
+	}
+
+	query := `
+	INSERT INTO workout_heart_rate_samples (workout_id, offset_seconds, bpm)
+	SELECT $1, s.offset_seconds, s.bpm
+	FROM unnest($2::int[], $3::int[]) AS s(offset_seconds, bpm)
+	ON CONFLICT (workout_id, offset_seconds) DO NOTHING
+	`
+
+	_, err = tx.Exec(query, workoutID, offsets, bpms)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	UPDATE workouts
+	SET avg_heart_rate = s.avg_bpm, max_heart_rate = s.max_bpm
+	FROM (
+		SELECT ROUND(AVG(bpm))::int AS avg_bpm, MAX(bpm)::int AS max_bpm
+		FROM workout_heart_rate_samples
+		WHERE workout_id = $1
+	) s
+	WHERE id = $1 AND s.max_bpm IS NOT NULL
+	`
+
+	_, err = tx.Exec(query, workoutID)
+	return err
+}
+
+func (pg *PostgresWorkoutStore) GetHeartRateSamples(workoutID int) ([]heartrate.Sample, error) {
+	query := `
+	SELECT offset_seconds, bpm
+	FROM workout_heart_rate_samples
+	WHERE workout_id = $1
+	ORDER BY offset_seconds
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []heartrate.Sample
+	for rows.Next() {
+		var sample heartrate.Sample
+		err = rows.Scan(&sample.OffsetSeconds, &sample.BPM)
 		if err != nil {
 			return nil, err
 		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+// StreamWorkoutsForUser calls fn with each of the user's workouts, oldest
+// first, complete with entries. Rows are read from a single cursor so only
+// one workout is held in memory at a time. Returning an error from fn stops
+// the iteration and is passed back to the caller.
+func (pg *PostgresWorkoutStore) StreamWorkoutsForUser(userID int, fn func(*Workout) error) error {
+	query := `
+	SELECT w.id, w.user_id, w.title, w.description, w.started_at, w.duration_minutes, w.calories_burned,
+		w.distance_meters, w.avg_heart_rate, w.max_heart_rate, w.visibility, w.activity_type, ` + wodColumnList + `,
+		tg.names, ` + entryColumns + `
+	FROM workouts w
+	-- tags are aggregated per workout so they ride along on the same cursor
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(json_agg(t.name ORDER BY LOWER(t.name)), '[]') AS names
+		FROM workout_tags wt
+		INNER JOIN tags t ON t.id = wt.tag_id
+		WHERE wt.workout_id = w.id
+	) tg
+	LEFT JOIN workout_entries e ON e.workout_id = w.id
+	LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+	WHERE w.user_id = $1
+	ORDER BY w.started_at, w.id, ` + entryOrder + `
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-		// For each workout, you might want to fetch its entries as well
-		// This makes the response more complete but adds N+1 query potential if not careful
-		// Option 1: Fetch entries here (N+1 potential)
-		entryQuery := `SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index FROM workout_entries WHERE workout_id = $1 ORDER BY order_index`
-		entryRows, entryErr := pg.db.Query(entryQuery, w.ID)
-		if entryErr != nil {
-			// Log error, decide if you want to return partial data or full error
-			return nil, entryErr
+	var current *Workout
+	for rows.Next() {
+		var w Workout
+		var entryID, sets, orderIndex sql.NullInt64
+		var exerciseName, notes, tempo sql.NullString
+		var entry WorkoutEntry
+		var group groupColumns
+		var wodCols wodColumns
+		var tags []byte
+
+		err = rows.Scan(
+			&w.ID,
+			&w.UserID,
+			&w.Title,
+			&w.Description,
+			&w.StartedAt,
+			&w.DurationMinutes,
+			&w.CaloriesBurned,
+			&w.DistanceMeters,
+			&w.AvgHeartRate,
+			&w.MaxHeartRate,
+			&w.Visibility,
+			&w.ActivityType,
+			&wodCols.format,
+			&wodCols.name,
+			&wodCols.timeCap,
+			&wodCols.interval,
+			&wodCols.rounds,
+			&wodCols.scoreRounds,
+			&wodCols.scoreReps,
+			&wodCols.scoreTime,
+			&tags,
+			&entryID,
+			&exerciseName,
+			&sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.DistanceMeters,
+			&notes,
+			&entry.RestSeconds,
+			&tempo,
+			&orderIndex,
+			&group.id,
+			&group.kind,
+			&group.rounds,
+			&group.rest,
+			&group.orderIndex,
+		)
+		if err != nil {
+			return err
 		}
-		defer entryRows.Close()
-
-		var entries []WorkoutEntry
-		for entryRows.Next() {
-			var entry WorkoutEntry
-			scanErr := entryRows.Scan(
-				&entry.ID,
-				&entry.ExerciseName,
-				&entry.Sets,
-				&entry.Reps,
-				&entry.DurationSeconds,
-				&entry.Weight,
-				&entry.Notes,
-				&entry.OrderIndex,
-			)
-			if scanErr != nil {
-				return nil, scanErr
+
+		if current == nil || current.ID != w.ID {
+			if current != nil {
+				err = fn(current)
+				if err != nil {
+					return err
+				}
+			}
+			w.WOD = wodCols.wod()
+			err = json.Unmarshal(tags, &w.Tags)
+			if err != nil {
+				return err
 			}
-			entries = append(entries, entry)
+			current = &w
 		}
-		w.Entries = entries
-		// End Option 1
 
-		workouts = append(workouts, w)
+		if entryID.Valid {
+			entry.ID = int(entryID.Int64)
+			entry.ExerciseName = exerciseName.String
+			entry.Sets = int(sets.Int64)
+			entry.Notes = notes.String
+			entry.Tempo = tempo.String
+			entry.OrderIndex = int(orderIndex.Int64)
+			current.addEntry(entry, &group)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
+
+// WorkoutStart is when a workout started and what it is called, which is
+// how imports recognise a session that is already logged.
+type WorkoutStart struct {
+	StartedAt time.Time
+	Title     string
+}
+
+// GetWorkoutStarts returns the start and title of each of the user's
+// workouts in [from, to].
+func (pg *PostgresWorkoutStore) GetWorkoutStarts(userID int, from, to time.Time) ([]WorkoutStart, error) {
+	query := `
+	SELECT started_at, title
+	FROM workouts
+	WHERE user_id = $1 AND started_at BETWEEN $2 AND $3
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
 	}
-	if err = rows.Err(); err != nil { // Check for errors during iteration
+	defer rows.Close()
+
+	var starts []WorkoutStart
+	for rows.Next() {
+		var start WorkoutStart
+		err = rows.Scan(&start.StartedAt, &start.Title)
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, start)
+	}
+
+	return starts, rows.Err()
+}
+
+// GetExerciseNamesForUser returns the distinct exercise names the user has
+// logged.
+func (pg *PostgresWorkoutStore) GetExerciseNamesForUser(userID int) ([]string, error) {
+	query := `
+	SELECT DISTINCT e.exercise_name
+	FROM workout_entries e
+	INNER JOIN workouts w ON w.id = e.workout_id
+	WHERE w.user_id = $1
+	ORDER BY e.exercise_name
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return workouts, nil
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// GetWODResults returns the user's scored workouts of the named WOD without
+// entries. Names match case-insensitively.
+func (pg *PostgresWorkoutStore) GetWODResults(userID int, name string) ([]Workout, error) {
+	query := `
+	SELECT id, user_id, title, started_at, ` + wodColumnList + `
+	FROM workouts
+	WHERE user_id = $1 AND LOWER(wod_name) = LOWER($2)
+	ORDER BY started_at DESC
+	`
+
+	rows, err := pg.db.Query(query, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workouts []Workout
+	for rows.Next() {
+		var w Workout
+		var wodCols wodColumns
+		dest := []any{&w.ID, &w.UserID, &w.Title, &w.StartedAt}
+		err = rows.Scan(append(dest, wodCols.scanDest()...)...)
+		if err != nil {
+			return nil, err
+		}
+		w.WOD = wodCols.wod()
+		workouts = append(workouts, w)
+	}
+
+	return workouts, rows.Err()
+}
+
+// GetWorkoutVisibility returns who owns the workout and who else may read
+// it, or sql.ErrNoRows when it doesn't exist.
+func (pg *PostgresWorkoutStore) GetWorkoutVisibility(id int) (int, string, error) {
+	query := `
+	SELECT user_id, visibility
+	FROM workouts
+	WHERE id = $1
+	`
+
+	var ownerID int
+	var visibility string
+	err := pg.db.QueryRow(query, id).Scan(&ownerID, &visibility)
+	return ownerID, visibility, err
 }
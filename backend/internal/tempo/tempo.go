@@ -0,0 +1,100 @@
+// Package tempo parses lifting tempo prescriptions like "3-1-1-0" and
+// turns them into time under tension.
+package tempo
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ExplosiveSeconds is what an "X" phase counts as: lifted as fast as
+// possible, which in practice still takes about a second.
+const ExplosiveSeconds = 1
+
+// maxPhaseSeconds keeps typos like "30-1-1-0" for "3-0-1-0" from turning
+// into minutes of tension.
+const maxPhaseSeconds = 20
+
+// Tempo is the length in seconds of each phase of a rep, in the usual
+// order: lowering, pause at the bottom, lifting, pause at the top.
+// Explosive phases are stored as -1.
+type Tempo struct {
+	Eccentric   int
+	BottomPause int
+	Concentric  int
+	TopPause    int
+}
+
+// Parse reads a four-phase tempo written with dashes ("3-1-X-0") or as
+// four single characters ("31X0"). Phases are whole seconds or X for
+// explosive.
+func Parse(s string) (Tempo, error) {
+	s = strings.TrimSpace(s)
+
+	var parts []string
+	if strings.Contains(s, "-") {
+		parts = strings.Split(s, "-")
+	} else {
+		parts = strings.Split(s, "")
+	}
+	if len(parts) != 4 {
+		return Tempo{}, errors.New("tempo must have four phases, like 3-1-1-0")
+	}
+
+	var phases [4]int
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if strings.EqualFold(part, "x") {
+			phases[i] = -1
+			continue
+		}
+
+		seconds, err := strconv.Atoi(part)
+		if err != nil || seconds < 0 {
+			return Tempo{}, errors.New("tempo phases must be seconds or X, like 3-1-X-0")
+		}
+		if seconds > maxPhaseSeconds {
+			return Tempo{}, errors.New("tempo phases can't be longer than 20 seconds")
+		}
+		phases[i] = seconds
+	}
+
+	return Tempo{
+		Eccentric:   phases[0],
+		BottomPause: phases[1],
+		Concentric:  phases[2],
+		TopPause:    phases[3],
+	}, nil
+}
+
+// String writes the tempo in its canonical dashed form, e.g. "3-1-X-0".
+func (t Tempo) String() string {
+	phases := []int{t.Eccentric, t.BottomPause, t.Concentric, t.TopPause}
+	parts := make([]string, len(phases))
+	for i, p := range phases {
+		if p < 0 {
+			parts[i] = "X"
+		} else {
+			parts[i] = strconv.Itoa(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// RepSeconds is the time a single rep takes.
+func (t Tempo) RepSeconds() int {
+	total := 0
+	for _, p := range []int{t.Eccentric, t.BottomPause, t.Concentric, t.TopPause} {
+		if p < 0 {
+			p = ExplosiveSeconds
+		}
+		total += p
+	}
+	return total
+}
+
+// TimeUnderTension is the time in seconds a set of reps takes at this tempo.
+func (t Tempo) TimeUnderTension(reps int) int {
+	return t.RepSeconds() * reps
+}
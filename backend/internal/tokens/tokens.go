@@ -9,6 +9,10 @@ import (
 
 const (
 	ScopeAuth = "authentication"
+	// ScopeCalendar tokens only grant read access to the calendar feed.
+	ScopeCalendar = "calendar"
+	// ScopeShare tokens open a single workout, read-only, without logging in.
+	ScopeShare = "share"
 )
 
 type Token struct {
@@ -17,6 +21,8 @@ type Token struct {
 	UserID    int       `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// WorkoutID is the workout a share token opens.
+	WorkoutID *int `json:"-"`
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -38,3 +39,19 @@ func ReadIDParam(r *http.Request) (int, error) {
 
 	return id, nil
 }
+
+// ReadQueryInt reads an integer query parameter, falling back to
+// defaultValue when it is absent.
+func ReadQueryInt(r *http.Request, key string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return i, nil
+}
@@ -0,0 +1,12 @@
+// Package week defines where weeks begin, so that badge streaks, weekly
+// analytics and reports all count the same weeks.
+package week
+
+import "time"
+
+// Start returns midnight on the Monday of t's week in loc.
+func Start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,249 @@
+// Package wod describes timed workout formats (AMRAP, EMOM, Tabata, For
+// Time, rounds for time), validates their scores and ranks results of the
+// same workout against each other.
+package wod
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Format string
+
+const (
+	AMRAP   Format = "amrap"
+	EMOM    Format = "emom"
+	Tabata  Format = "tabata"
+	ForTime Format = "for_time"
+	// RFT is a fixed number of rounds for time.
+	RFT Format = "rft"
+)
+
+// ScoreKind is what a format's results are measured in.
+type ScoreKind string
+
+const (
+	ScoreRoundsReps ScoreKind = "rounds_reps"
+	ScoreTime       ScoreKind = "time"
+	ScoreTotalReps  ScoreKind = "total_reps"
+)
+
+// TabataRounds is the classic 8 rounds of 20s work / 10s rest.
+const TabataRounds = 8
+
+// WOD is the format of a workout and, once done, its score.
+type WOD struct {
+	Format Format `json:"format"`
+	// Name identifies benchmark workouts like "Fran" so results can be
+	// compared across athletes and over time.
+	Name            string `json:"name,omitempty"`
+	TimeCapSeconds  *int   `json:"time_cap_seconds,omitempty"`
+	IntervalSeconds *int   `json:"interval_seconds,omitempty"`
+	// Rounds is the prescribed number of rounds for EMOM, Tabata and RFT.
+	Rounds *int   `json:"rounds,omitempty"`
+	Score  *Score `json:"score,omitempty"`
+}
+
+// Score is a result. Which fields are set depends on the format:
+//
+//	amrap            rounds + reps
+//	emom, tabata     reps (total)
+//	for_time, rft    time_seconds, or when time-capped, the work done
+//	                 before the cap: reps for for_time, rounds + reps for rft
+type Score struct {
+	Rounds      *int `json:"rounds,omitempty"`
+	Reps        *int `json:"reps,omitempty"`
+	TimeSeconds *int `json:"time_seconds,omitempty"`
+}
+
+// Capped reports whether a timed score hit the time cap instead of
+// finishing.
+func (s *Score) Capped() bool {
+	return s.TimeSeconds == nil
+}
+
+// Kind returns how results of the format are scored.
+func (f Format) Kind() ScoreKind {
+	switch f {
+	case AMRAP:
+		return ScoreRoundsReps
+	case ForTime, RFT:
+		return ScoreTime
+	default:
+		return ScoreTotalReps
+	}
+}
+
+// ValidFormat reports whether f is a known format.
+func ValidFormat(f Format) bool {
+	switch f {
+	case AMRAP, EMOM, Tabata, ForTime, RFT:
+		return true
+	}
+	return false
+}
+
+// Validate checks the format's parameters and, when present, the score.
+// Tabata's rounds default to TabataRounds.
+func (w *WOD) Validate() error {
+	if !ValidFormat(w.Format) {
+		return errors.New("format must be one of amrap, emom, tabata, for_time, rft")
+	}
+	w.Name = strings.TrimSpace(w.Name)
+
+	switch w.Format {
+	case AMRAP:
+		if !positive(w.TimeCapSeconds) {
+			return errors.New("amrap needs a time_cap_seconds")
+		}
+	case EMOM:
+		if !positive(w.IntervalSeconds) || !positive(w.Rounds) {
+			return errors.New("emom needs interval_seconds and rounds")
+		}
+	case Tabata:
+		if w.Rounds == nil {
+			rounds := TabataRounds
+			w.Rounds = &rounds
+		}
+		if !positive(w.Rounds) {
+			return errors.New("tabata rounds must be positive")
+		}
+	case RFT:
+		if !positive(w.Rounds) {
+			return errors.New("rft needs rounds")
+		}
+	}
+	if w.TimeCapSeconds != nil && *w.TimeCapSeconds <= 0 {
+		return errors.New("time_cap_seconds must be positive")
+	}
+
+	if w.Score != nil {
+		return w.validateScore()
+	}
+	return nil
+}
+
+func (w *WOD) validateScore() error {
+	s := w.Score
+	for _, v := range []*int{s.Rounds, s.Reps, s.TimeSeconds} {
+		if v != nil && *v < 0 {
+			return errors.New("score values must not be negative")
+		}
+	}
+
+	switch w.Format.Kind() {
+	case ScoreRoundsReps:
+		if s.Rounds == nil || s.TimeSeconds != nil {
+			return fmt.Errorf("%s is scored in rounds and reps", w.Format)
+		}
+	case ScoreTotalReps:
+		if s.Reps == nil || s.Rounds != nil || s.TimeSeconds != nil {
+			return fmt.Errorf("%s is scored in total reps", w.Format)
+		}
+	case ScoreTime:
+		if !s.Capped() {
+			if s.Rounds != nil || s.Reps != nil {
+				return errors.New("a finished score has only time_seconds")
+			}
+			if w.TimeCapSeconds != nil && *s.TimeSeconds > *w.TimeCapSeconds {
+				return errors.New("time_seconds is over the time cap")
+			}
+			return nil
+		}
+
+		// didn't finish: record the work done before the cap
+		if w.TimeCapSeconds == nil {
+			return errors.New("a score without time_seconds is only valid with a time cap")
+		}
+		if w.Format == ForTime && (s.Reps == nil || s.Rounds != nil) {
+			return errors.New("a capped for_time score is the reps completed")
+		}
+		if w.Format == RFT {
+			if s.Rounds == nil {
+				return errors.New("a capped rft score is the rounds and reps completed")
+			}
+			if w.Rounds != nil && *s.Rounds >= *w.Rounds {
+				return errors.New("a capped rft score must have fewer rounds than prescribed")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Compare ranks two scores of the same format. It returns a negative
+// number when a is the better result, positive when b is, and 0 for a tie.
+// A missing score ranks last.
+func Compare(format Format, a, b *Score) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch format.Kind() {
+	case ScoreRoundsReps:
+		return compareRoundsReps(a, b)
+	case ScoreTime:
+		switch {
+		case !a.Capped() && !b.Capped():
+			return value(a.TimeSeconds) - value(b.TimeSeconds)
+		case !a.Capped():
+			return -1
+		case !b.Capped():
+			return 1
+		default:
+			return compareRoundsReps(a, b)
+		}
+	default:
+		return value(b.Reps) - value(a.Reps)
+	}
+}
+
+// compareRoundsReps puts more rounds first, then more reps.
+func compareRoundsReps(a, b *Score) int {
+	if value(a.Rounds) != value(b.Rounds) {
+		return value(b.Rounds) - value(a.Rounds)
+	}
+	return value(b.Reps) - value(a.Reps)
+}
+
+// String formats a score the way it is written on the whiteboard: "12+5"
+// for rounds and reps, "4:32" for a time, "CAP 87" or "CAP 4+12" for
+// capped timed workouts and "142 reps" for totals.
+func (w *WOD) String() string {
+	if w.Score == nil {
+		return ""
+	}
+	s := w.Score
+
+	switch w.Format.Kind() {
+	case ScoreRoundsReps:
+		return fmt.Sprintf("%d+%d", value(s.Rounds), value(s.Reps))
+	case ScoreTime:
+		if !s.Capped() {
+			return fmt.Sprintf("%d:%02d", value(s.TimeSeconds)/60, value(s.TimeSeconds)%60)
+		}
+		if s.Rounds != nil {
+			return fmt.Sprintf("CAP %d+%d", value(s.Rounds), value(s.Reps))
+		}
+		return fmt.Sprintf("CAP %d", value(s.Reps))
+	default:
+		return fmt.Sprintf("%d reps", value(s.Reps))
+	}
+}
+
+func positive(v *int) bool {
+	return v != nil && *v > 0
+}
+
+func value(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN distance_meters DECIMAL(10, 2),
+ADD COLUMN avg_heart_rate INTEGER,
+ADD COLUMN max_heart_rate INTEGER;
+
+UPDATE workouts SET started_at = created_at;
+
+ALTER TABLE workouts
+ALTER COLUMN started_at SET DEFAULT CURRENT_TIMESTAMP,
+ALTER COLUMN started_at SET NOT NULL;
+
+ALTER TABLE workout_entries
+ADD COLUMN distance_meters DECIMAL(10, 2);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN distance_meters;
+
+ALTER TABLE workouts
+DROP COLUMN max_heart_rate,
+DROP COLUMN avg_heart_rate,
+DROP COLUMN distance_meters,
+DROP COLUMN started_at;
+-- +goose StatementEnd
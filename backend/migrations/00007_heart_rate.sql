@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN resting_heart_rate INTEGER,
+ADD COLUMN threshold_heart_rate INTEGER,
+ADD COLUMN hr_zone_model VARCHAR(20) NOT NULL DEFAULT 'percent_max';
+
+CREATE TABLE IF NOT EXISTS workout_heart_rate_samples (
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    offset_seconds INTEGER NOT NULL,
+    bpm SMALLINT NOT NULL,
+    PRIMARY KEY (workout_id, offset_seconds),
+    CONSTRAINT valid_offset CHECK (offset_seconds >= 0),
+    CONSTRAINT valid_bpm CHECK (bpm > 0 AND bpm < 260)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_heart_rate_samples;
+
+ALTER TABLE users
+DROP COLUMN hr_zone_model,
+DROP COLUMN threshold_heart_rate,
+DROP COLUMN resting_heart_rate,
+DROP COLUMN max_heart_rate;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN source VARCHAR(30),
+ADD COLUMN source_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS workouts_source_idx
+ON workouts (user_id, source, source_id)
+WHERE source_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS measurements (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(30) NOT NULL,
+    value DECIMAL(7, 2) NOT NULL,
+    measured_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    source VARCHAR(30),
+    source_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_measurement_kind CHECK (kind IN ('body_weight'))
+);
+
+CREATE INDEX IF NOT EXISTS measurements_user_kind_idx
+ON measurements (user_id, kind, measured_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS measurements_source_idx
+ON measurements (user_id, source, source_id)
+WHERE source_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE measurements;
+
+DROP INDEX IF EXISTS workouts_source_idx;
+
+ALTER TABLE workouts
+DROP COLUMN source_id,
+DROP COLUMN source;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- starts_at is a wall-clock time in the owner's timezone, so occurrences
+-- stay at the same local time across DST changes
+CREATE TABLE IF NOT EXISTS workout_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    template_workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    starts_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    duration_minutes INTEGER NOT NULL DEFAULT 0,
+    rrule TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_schedule_duration CHECK (duration_minutes >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS workout_schedules_user_id_idx ON workout_schedules (user_id);
+
+CREATE TABLE IF NOT EXISTS schedule_exceptions (
+    schedule_id BIGINT NOT NULL REFERENCES workout_schedules(id) ON DELETE CASCADE,
+    occurrence_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    rescheduled_to TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (schedule_id, occurrence_date),
+    CONSTRAINT valid_exception_status CHECK (status IN ('skipped', 'rescheduled')),
+    CONSTRAINT rescheduled_has_time CHECK (status <> 'rescheduled' OR rescheduled_to IS NOT NULL)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE schedule_exceptions;
+DROP TABLE workout_schedules;
+
+ALTER TABLE users
+DROP COLUMN timezone;
+-- +goose StatementEnd
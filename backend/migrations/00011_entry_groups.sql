@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    rounds INTEGER NOT NULL DEFAULT 1,
+    rest_between_rounds_seconds INTEGER,
+    order_index INTEGER NOT NULL,
+    CONSTRAINT valid_group_kind CHECK (kind IN ('superset', 'circuit', 'giant_set')),
+    CONSTRAINT valid_group_rounds CHECK (rounds >= 1),
+    CONSTRAINT valid_group_rest CHECK (rest_between_rounds_seconds IS NULL OR rest_between_rounds_seconds >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS workout_entry_groups_workout_id_idx ON workout_entry_groups (workout_id);
+
+-- entries of a group are ordered within the group; ungrouped entries and
+-- groups share the workout-level order
+ALTER TABLE workout_entries
+ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS workout_entries_group_id_idx ON workout_entries (group_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP COLUMN group_id;
+
+DROP TABLE workout_entry_groups;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN wod_format VARCHAR(20),
+ADD COLUMN wod_name VARCHAR(255),
+ADD COLUMN wod_time_cap_seconds INTEGER,
+ADD COLUMN wod_interval_seconds INTEGER,
+ADD COLUMN wod_rounds INTEGER,
+ADD COLUMN score_rounds INTEGER,
+ADD COLUMN score_reps INTEGER,
+ADD COLUMN score_time_seconds INTEGER,
+ADD CONSTRAINT valid_wod_format CHECK (wod_format IN ('amrap', 'emom', 'tabata', 'for_time', 'rft')),
+ADD CONSTRAINT valid_wod_score CHECK (
+    (score_rounds IS NULL OR score_rounds >= 0) AND
+    (score_reps IS NULL OR score_reps >= 0) AND
+    (score_time_seconds IS NULL OR score_time_seconds >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS workouts_wod_name_idx
+ON workouts (LOWER(wod_name))
+WHERE wod_name IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS workouts_wod_name_idx;
+
+ALTER TABLE workouts
+DROP CONSTRAINT valid_wod_score,
+DROP CONSTRAINT valid_wod_format,
+DROP COLUMN score_time_seconds,
+DROP COLUMN score_reps,
+DROP COLUMN score_rounds,
+DROP COLUMN wod_rounds,
+DROP COLUMN wod_interval_seconds,
+DROP COLUMN wod_time_cap_seconds,
+DROP COLUMN wod_name,
+DROP COLUMN wod_format;
+-- +goose StatementEnd
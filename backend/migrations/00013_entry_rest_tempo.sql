@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+ADD COLUMN rest_seconds INTEGER,
+ADD COLUMN tempo VARCHAR(16) NOT NULL DEFAULT '',
+ADD CONSTRAINT valid_entry_rest CHECK (rest_seconds IS NULL OR rest_seconds >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_entry_rest,
+DROP COLUMN tempo,
+DROP COLUMN rest_seconds;
+-- +goose StatementEnd
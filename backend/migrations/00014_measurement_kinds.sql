@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE measurements
+DROP CONSTRAINT valid_measurement_kind,
+ADD CONSTRAINT valid_measurement_kind CHECK (kind IN ('body_weight', 'body_fat', 'waist', 'chest', 'arms', 'thighs')),
+ADD CONSTRAINT valid_measurement_value CHECK (value > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM measurements WHERE kind <> 'body_weight';
+
+ALTER TABLE measurements
+DROP CONSTRAINT valid_measurement_value,
+DROP CONSTRAINT valid_measurement_kind,
+ADD CONSTRAINT valid_measurement_kind CHECK (kind IN ('body_weight'));
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(30) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    exercise_name VARCHAR(255),
+    target_value DECIMAL(12, 2) NOT NULL,
+    target_reps INTEGER,
+    start_value DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    current_value DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- the deadline is a local date; ends_at is the end of that day in the
+    -- owner's timezone when the goal was set
+    deadline DATE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal_kind CHECK (kind IN ('weekly_frequency', 'monthly_volume', 'lift', 'body_weight', 'distance')),
+    CONSTRAINT valid_goal_target CHECK (target_value > 0),
+    CONSTRAINT valid_goal_span CHECK (ends_at > starts_at),
+    CONSTRAINT lift_goal_exercise CHECK (kind <> 'lift' OR (exercise_name IS NOT NULL AND target_reps >= 1))
+);
+
+CREATE INDEX IF NOT EXISTS goals_user_id_idx ON goals (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE goals;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS achievements (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- rule keys come from the registry in internal/achievement
+    key VARCHAR(50) NOT NULL,
+    awarded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE achievements;
+-- +goose StatementEnd
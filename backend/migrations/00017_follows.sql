@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- follows of private accounts wait for the followee's approval
+    status VARCHAR(10) NOT NULL DEFAULT 'accepted',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT valid_follow_status CHECK (status IN ('pending', 'accepted')),
+    CONSTRAINT no_self_follow CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows (followee_id, status);
+
+-- the feed walks each followed user's workouts newest first
+CREATE INDEX IF NOT EXISTS workouts_user_started_idx ON workouts (user_id, started_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS workouts_user_started_idx;
+
+DROP TABLE follows;
+
+ALTER TABLE users
+DROP COLUMN is_private;
+-- +goose StatementEnd
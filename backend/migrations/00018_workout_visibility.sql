@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'private',
+ADD CONSTRAINT valid_workout_visibility CHECK (visibility IN ('private', 'followers', 'public'));
+
+-- share tokens point at the workout they open
+ALTER TABLE tokens
+ADD COLUMN workout_id BIGINT REFERENCES workouts(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS tokens_workout_id_idx ON tokens (workout_id) WHERE workout_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM tokens WHERE scope = 'share';
+
+DROP INDEX IF EXISTS tokens_workout_id_idx;
+
+ALTER TABLE tokens
+DROP COLUMN workout_id;
+
+ALTER TABLE workouts
+DROP CONSTRAINT valid_workout_visibility,
+DROP COLUMN visibility;
+-- +goose StatementEnd
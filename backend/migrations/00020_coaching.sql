@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+-- an athlete grants a coach scoped access; the grant is pending until the
+-- coach accepts it
+CREATE TABLE IF NOT EXISTS coaching_grants (
+    athlete_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    coach_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    can_read BOOLEAN NOT NULL DEFAULT FALSE,
+    can_write BOOLEAN NOT NULL DEFAULT FALSE,
+    can_assign BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (athlete_id, coach_id),
+    CONSTRAINT valid_grant_status CHECK (status IN ('pending', 'active')),
+    CONSTRAINT no_self_coaching CHECK (athlete_id <> coach_id)
+);
+
+CREATE INDEX IF NOT EXISTS coaching_grants_coach_idx ON coaching_grants (coach_id);
+
+ALTER TABLE workouts
+ADD COLUMN created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN updated_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE workout_schedules
+ADD COLUMN created_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+-- writes made on someone else's behalf; workout_id has no foreign key so
+-- deletions stay on record
+CREATE TABLE IF NOT EXISTS workout_audit (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL,
+    owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_audit_action CHECK (action IN ('create', 'update', 'delete'))
+);
+
+CREATE INDEX IF NOT EXISTS workout_audit_owner_idx ON workout_audit (owner_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_audit;
+
+ALTER TABLE workout_schedules
+DROP COLUMN created_by;
+
+ALTER TABLE workouts
+DROP COLUMN updated_by,
+DROP COLUMN created_by;
+
+DROP TABLE coaching_grants;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a conversation between two users, user_low_id < user_high_id, optionally
+-- about a workout or one of its entries. Editing a workout replaces its
+-- entries, which drops an entry anchor back to the workout.
+CREATE TABLE IF NOT EXISTS message_threads (
+    id BIGSERIAL PRIMARY KEY,
+    user_low_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_high_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+    entry_id BIGINT REFERENCES workout_entries(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_message_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT ordered_thread_users CHECK (user_low_id < user_high_id)
+);
+
+CREATE INDEX IF NOT EXISTS message_threads_low_idx ON message_threads (user_low_id);
+CREATE INDEX IF NOT EXISTS message_threads_high_idx ON message_threads (user_high_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGSERIAL PRIMARY KEY,
+    thread_id BIGINT NOT NULL REFERENCES message_threads(id) ON DELETE CASCADE,
+    sender_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_message_body CHECK (LENGTH(body) BETWEEN 1 AND 4000)
+);
+
+CREATE INDEX IF NOT EXISTS messages_thread_idx ON messages (thread_id, id DESC);
+
+-- read receipts: how far each participant has read
+CREATE TABLE IF NOT EXISTS message_reads (
+    thread_id BIGINT NOT NULL REFERENCES message_threads(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id BIGINT NOT NULL,
+    read_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (thread_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE message_reads;
+DROP TABLE messages;
+DROP TABLE message_threads;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS challenges (
+    id BIGSERIAL PRIMARY KEY,
+    -- NULL for challenges open to everyone
+    org_id BIGINT REFERENCES organizations(id) ON DELETE CASCADE,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    metric VARCHAR(10) NOT NULL,
+    -- only entries of this exercise count when set
+    exercise_name VARCHAR(255),
+    -- when set, participants score the days they reached it rather than
+    -- the metric's total
+    daily_target DECIMAL(12, 2),
+    -- the dates are local to timezone; starts_at and ends_at bound them
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    timezone VARCHAR(64) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finalized_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_challenge_metric CHECK (metric IN ('distance', 'reps', 'volume')),
+    CONSTRAINT valid_challenge_span CHECK (ends_on >= starts_on AND ends_at > starts_at),
+    CONSTRAINT valid_challenge_daily_target CHECK (daily_target IS NULL OR daily_target > 0)
+);
+
+CREATE INDEX IF NOT EXISTS challenges_org_id_idx ON challenges (org_id);
+
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    value DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    -- set when the challenge is finalized
+    final_rank INTEGER,
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (challenge_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS challenge_participants_user_idx ON challenge_participants (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE challenge_participants;
+DROP TABLE challenges;
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN activity_type VARCHAR(20) NOT NULL DEFAULT 'other',
+ADD CONSTRAINT valid_activity_type CHECK (activity_type IN (
+    'running', 'walking', 'cycling', 'swimming', 'rowing', 'strength', 'hiit', 'crossfit', 'yoga', 'pilates', 'other'
+));
+
+-- existing workouts get a type when their title names one; WODs are CrossFit
+UPDATE workouts
+SET activity_type = CASE
+    WHEN wod_format IS NOT NULL OR title ~* '\mcrossfit' THEN 'crossfit'
+    WHEN title ~* '\m(run|jog)' THEN 'running'
+    WHEN title ~* '\m(walk|hik)' THEN 'walking'
+    WHEN title ~* '\m(cycl|ride|bike)' THEN 'cycling'
+    WHEN title ~* '\mswim' THEN 'swimming'
+    WHEN title ~* '\mrow' THEN 'rowing'
+    WHEN title ~* '\m(strength|lift)' THEN 'strength'
+    WHEN title ~* '\mhiit' THEN 'hiit'
+    WHEN title ~* '\myoga' THEN 'yoga'
+    WHEN title ~* '\mpilates' THEN 'pilates'
+    ELSE 'other'
+END;
+
+CREATE INDEX IF NOT EXISTS workouts_user_activity_type_idx ON workouts (user_id, activity_type);
+
+-- tags belong to a user and are unique per user regardless of case
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tags_user_name_idx ON tags (user_id, LOWER(name));
+
+CREATE TABLE IF NOT EXISTS workout_tags (
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (workout_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS workout_tags_tag_idx ON workout_tags (tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_tags;
+DROP TABLE tags;
+ALTER TABLE workouts DROP COLUMN activity_type;
+-- +goose StatementEnd
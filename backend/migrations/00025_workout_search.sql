@@ -0,0 +1,70 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN search_vector TSVECTOR;
+
+-- workout_search_vector weighs the title highest, then the description and
+-- exercise names, then entry notes
+CREATE OR REPLACE FUNCTION workout_search_vector(wid BIGINT, title TEXT, description TEXT)
+RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(string_agg(e.exercise_name, ' '), '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(string_agg(e.notes, ' '), '')), 'C')
+    FROM workout_entries e
+    WHERE e.workout_id = wid
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION workouts_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := workout_search_vector(NEW.id, NEW.title, NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workouts_search_update
+BEFORE INSERT OR UPDATE OF title, description ON workouts
+FOR EACH ROW EXECUTE FUNCTION workouts_search_trigger();
+
+-- entries change without their workout's row changing, so they refresh it
+CREATE OR REPLACE FUNCTION workout_entries_search_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    wid BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        wid := OLD.workout_id;
+    ELSE
+        wid := NEW.workout_id;
+    END IF;
+
+    UPDATE workouts
+    SET search_vector = workout_search_vector(id, title, description)
+    WHERE id = wid;
+
+    IF TG_OP = 'UPDATE' AND OLD.workout_id <> NEW.workout_id THEN
+        UPDATE workouts
+        SET search_vector = workout_search_vector(id, title, description)
+        WHERE id = OLD.workout_id;
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_entries_search_update
+AFTER INSERT OR UPDATE OF exercise_name, notes, workout_id OR DELETE ON workout_entries
+FOR EACH ROW EXECUTE FUNCTION workout_entries_search_trigger();
+
+UPDATE workouts SET search_vector = workout_search_vector(id, title, description);
+
+CREATE INDEX IF NOT EXISTS workouts_search_idx ON workouts USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER workout_entries_search_update ON workout_entries;
+DROP TRIGGER workouts_search_update ON workouts;
+DROP FUNCTION workout_entries_search_trigger();
+DROP FUNCTION workouts_search_trigger();
+DROP FUNCTION workout_search_vector(BIGINT, TEXT, TEXT);
+ALTER TABLE workouts DROP COLUMN search_vector;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- serves the fuzzy % and <% matches of exercise name suggestions
+CREATE INDEX IF NOT EXISTS workout_entries_exercise_name_trgm_idx
+ON workout_entries USING GIN (exercise_name gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS workout_entries_exercise_name_trgm_idx;
+-- +goose StatementEnd
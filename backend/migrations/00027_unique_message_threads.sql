@@ -0,0 +1,120 @@
+-- +goose Up
+-- +goose StatementBegin
+-- merge_message_thread moves everything of thread from_id into into_id and
+-- deletes from_id. Read receipts keep the lower of the two positions, so
+-- no message is marked read that wasn't.
+CREATE OR REPLACE FUNCTION merge_message_thread(from_id BIGINT, into_id BIGINT) RETURNS VOID AS $$
+BEGIN
+    UPDATE messages SET thread_id = into_id WHERE thread_id = from_id;
+
+    INSERT INTO message_reads (thread_id, user_id, last_read_message_id, read_at)
+    SELECT into_id, user_id, last_read_message_id, read_at
+    FROM message_reads
+    WHERE thread_id = from_id
+    ON CONFLICT (thread_id, user_id) DO UPDATE
+    SET last_read_message_id = LEAST(message_reads.last_read_message_id, EXCLUDED.last_read_message_id),
+        read_at = LEAST(message_reads.read_at, EXCLUDED.read_at);
+
+    UPDATE message_threads
+    SET last_message_at = (SELECT MAX(created_at) FROM messages WHERE thread_id = into_id)
+    WHERE id = into_id;
+
+    DELETE FROM message_threads WHERE id = from_id;
+END
+$$ LANGUAGE plpgsql;
+
+-- threads opened before this migration may have duplicates
+DO $$
+DECLARE
+    dup RECORD;
+BEGIN
+    FOR dup IN
+        SELECT id, keep
+        FROM (
+            SELECT id, MIN(id) OVER (
+                PARTITION BY user_low_id, user_high_id, COALESCE(workout_id, 0), COALESCE(entry_id, 0)
+            ) AS keep
+            FROM message_threads
+        ) t
+        WHERE id <> keep
+    LOOP
+        PERFORM merge_message_thread(dup.id, dup.keep);
+    END LOOP;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS message_threads_anchor_idx
+ON message_threads (user_low_id, user_high_id, COALESCE(workout_id, 0), COALESCE(entry_id, 0));
+
+CREATE INDEX IF NOT EXISTS message_threads_workout_idx ON message_threads (workout_id) WHERE workout_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS message_threads_entry_idx ON message_threads (entry_id) WHERE entry_id IS NOT NULL;
+
+-- Deleting an anchor used to set it to NULL through the foreign keys,
+-- which may now collide with the thread the pair already has on the
+-- wider anchor. These run first and fold the thread into that one when it
+-- exists, leaving the foreign keys nothing to do. Entry threads fall back
+-- to their workout, workout threads to the pair's general thread.
+CREATE OR REPLACE FUNCTION message_threads_detach_entry() RETURNS TRIGGER AS $$
+DECLARE
+    t RECORD;
+    target BIGINT;
+BEGIN
+    FOR t IN SELECT * FROM message_threads WHERE entry_id = OLD.id LOOP
+        SELECT id INTO target
+        FROM message_threads
+        WHERE user_low_id = t.user_low_id AND user_high_id = t.user_high_id
+            AND workout_id IS NOT DISTINCT FROM t.workout_id AND entry_id IS NULL;
+
+        IF FOUND THEN
+            PERFORM merge_message_thread(t.id, target);
+        ELSE
+            UPDATE message_threads SET entry_id = NULL WHERE id = t.id;
+        END IF;
+    END LOOP;
+
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION message_threads_detach_workout() RETURNS TRIGGER AS $$
+DECLARE
+    t RECORD;
+    target BIGINT;
+BEGIN
+    FOR t IN SELECT * FROM message_threads WHERE workout_id = OLD.id ORDER BY id LOOP
+        SELECT id INTO target
+        FROM message_threads
+        WHERE user_low_id = t.user_low_id AND user_high_id = t.user_high_id
+            AND workout_id IS NULL AND entry_id IS NULL;
+
+        IF FOUND THEN
+            PERFORM merge_message_thread(t.id, target);
+        ELSE
+            UPDATE message_threads SET workout_id = NULL, entry_id = NULL WHERE id = t.id;
+        END IF;
+    END LOOP;
+
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER message_threads_detach_entry
+BEFORE DELETE ON workout_entries
+FOR EACH ROW EXECUTE FUNCTION message_threads_detach_entry();
+
+CREATE TRIGGER message_threads_detach_workout
+BEFORE DELETE ON workouts
+FOR EACH ROW EXECUTE FUNCTION message_threads_detach_workout();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER message_threads_detach_workout ON workouts;
+DROP TRIGGER message_threads_detach_entry ON workout_entries;
+DROP FUNCTION message_threads_detach_workout();
+DROP FUNCTION message_threads_detach_entry();
+DROP INDEX IF EXISTS message_threads_entry_idx;
+DROP INDEX IF EXISTS message_threads_workout_idx;
+DROP INDEX IF EXISTS message_threads_anchor_idx;
+DROP FUNCTION merge_message_thread(BIGINT, BIGINT);
+-- +goose StatementEnd
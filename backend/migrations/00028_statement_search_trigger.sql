@@ -0,0 +1,87 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Replacing a workout's entries deletes and inserts many rows at once; the
+-- row trigger rebuilt the workout's vector for every one of them. These run
+-- once per statement and rebuild each workout the statement touched once.
+DROP TRIGGER workout_entries_search_update ON workout_entries;
+DROP FUNCTION workout_entries_search_trigger();
+
+CREATE OR REPLACE FUNCTION workout_entries_search_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE workouts
+        SET search_vector = workout_search_vector(id, title, description)
+        WHERE id IN (SELECT workout_id FROM new_entries);
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE workouts
+        SET search_vector = workout_search_vector(id, title, description)
+        WHERE id IN (SELECT workout_id FROM old_entries);
+    ELSE
+        UPDATE workouts
+        SET search_vector = workout_search_vector(id, title, description)
+        WHERE id IN (
+            SELECT o.workout_id FROM old_entries o JOIN new_entries n ON n.id = o.id
+            WHERE (o.exercise_name, o.notes, o.workout_id) IS DISTINCT FROM (n.exercise_name, n.notes, n.workout_id)
+            UNION
+            SELECT n.workout_id FROM old_entries o JOIN new_entries n ON n.id = o.id
+            WHERE (o.exercise_name, o.notes, o.workout_id) IS DISTINCT FROM (n.exercise_name, n.notes, n.workout_id)
+        );
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- transition tables need one trigger per event and no column list, so
+-- updates compare old and new rows themselves
+CREATE TRIGGER workout_entries_search_insert
+AFTER INSERT ON workout_entries
+REFERENCING NEW TABLE AS new_entries
+FOR EACH STATEMENT EXECUTE FUNCTION workout_entries_search_trigger();
+
+CREATE TRIGGER workout_entries_search_update
+AFTER UPDATE ON workout_entries
+REFERENCING OLD TABLE AS old_entries NEW TABLE AS new_entries
+FOR EACH STATEMENT EXECUTE FUNCTION workout_entries_search_trigger();
+
+CREATE TRIGGER workout_entries_search_delete
+AFTER DELETE ON workout_entries
+REFERENCING OLD TABLE AS old_entries
+FOR EACH STATEMENT EXECUTE FUNCTION workout_entries_search_trigger();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER workout_entries_search_delete ON workout_entries;
+DROP TRIGGER workout_entries_search_update ON workout_entries;
+DROP TRIGGER workout_entries_search_insert ON workout_entries;
+DROP FUNCTION workout_entries_search_trigger();
+
+CREATE OR REPLACE FUNCTION workout_entries_search_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    wid BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        wid := OLD.workout_id;
+    ELSE
+        wid := NEW.workout_id;
+    END IF;
+
+    UPDATE workouts
+    SET search_vector = workout_search_vector(id, title, description)
+    WHERE id = wid;
+
+    IF TG_OP = 'UPDATE' AND OLD.workout_id <> NEW.workout_id THEN
+        UPDATE workouts
+        SET search_vector = workout_search_vector(id, title, description)
+        WHERE id = OLD.workout_id;
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_entries_search_update
+AFTER INSERT OR UPDATE OF exercise_name, notes, workout_id OR DELETE ON workout_entries
+FOR EACH ROW EXECUTE FUNCTION workout_entries_search_trigger();
+-- +goose StatementEnd
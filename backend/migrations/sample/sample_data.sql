@@ -7,6 +7,8 @@ DECLARE
     workout_id INT;
     workout_type INT;
     workout_types TEXT[] := ARRAY['Running', 'Strength', 'HIIT', 'Yoga', 'Swimming', 'Cycling', 'CrossFit', 'Pilates'];
+    -- activity_type values matching workout_types
+    activity_types TEXT[] := ARRAY['running', 'strength', 'hiit', 'yoga', 'swimming', 'cycling', 'crossfit', 'pilates'];
     
     -- Use separate arrays instead of multidimensional array
     running_exercises TEXT[] := ARRAY['Easy Run', 'Tempo Run', 'Interval Training', 'Hill Repeats', 'Long Run'];
@@ -29,6 +31,7 @@ DECLARE
     duration INT;
     exercise_array_size INT;
     chosen_exercise_array TEXT[];
+    tag_id INT;
 BEGIN
     -- Loop to create 20 users
     FOR i IN 1..20 LOOP
@@ -53,7 +56,7 @@ BEGIN
             workout_description := 'A ' || adjectives[1 + ((j*3) % 10)] || ' ' || workout_types[1 + workout_type] || ' session at ' || locations[1 + ((i+j*2) % 8)];
             
             -- Insert workout
-            INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned) 
+            INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, activity_type) 
             VALUES (
                 current_user_id,
                 workout_title,
@@ -61,10 +64,20 @@ BEGIN
                 -- Duration between 10 and 90 minutes
                 10 + ((i+j) % 80),
                 -- Calories between 50 and 800
-                50 + ((i*j) % 750)
+                50 + ((i*j) % 750),
+                activity_types[1 + workout_type]
             )
             RETURNING id INTO workout_id;
             
+            -- Tag the workout with its location
+            INSERT INTO tags (user_id, name)
+            VALUES (current_user_id, locations[1 + ((i+j*2) % 8)])
+            ON CONFLICT (user_id, LOWER(name)) DO UPDATE SET name = EXCLUDED.name
+            RETURNING id INTO tag_id;
+            
+            INSERT INTO workout_tags (workout_id, tag_id)
+            VALUES (workout_id, tag_id);
+            
             -- Determine how many exercise entries to add (2-6)
             exercise_count := 2 + (i + j) % 5;
             